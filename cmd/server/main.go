@@ -4,55 +4,64 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"slices"
 	"time"
 
-	"github.com/hazkall/capy-belga/internal/controller"
+	"github.com/hazkall/capy-belga/internal/contract"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
 	"github.com/hazkall/capy-belga/internal/domain/repository"
 	"github.com/hazkall/capy-belga/internal/domain/service"
 	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/internal/notify"
+	"github.com/hazkall/capy-belga/internal/payment"
 	"github.com/hazkall/capy-belga/internal/router"
 	"github.com/hazkall/capy-belga/internal/server"
 	"github.com/hazkall/capy-belga/internal/worker"
+	"github.com/hazkall/capy-belga/pkg/env"
 	"github.com/hazkall/capy-belga/pkg/logger"
 	"github.com/hazkall/capy-belga/pkg/telemetry"
 )
 
 func main() {
 
-	logger.Start("true")
 	ctx := context.Background()
-	clubChannel := make(chan *controller.Message, 100)
 
-	slog.Info("Starting OpenTelemetry Tracing")
-
-	t := telemetry.TraceInit(ctx, "capy-belga-tracer")
+	shutdownLogs := logger.Start(ctx, logger.ConfigFromEnv("capy-belga-logger"))
 
 	defer func() {
-		if err := t.Shutdown(ctx); err != nil {
-			slog.Error("Error shutting down exporter", "error", err)
-			os.Exit(1)
+		if err := shutdownLogs(ctx); err != nil {
+			slog.Error("Error shutting down log exporter", "error", err)
 		}
 	}()
 
-	slog.Info("Starting OpenTelemetry Metrics")
-	me, exp := telemetry.MetricInit(ctx, "capy-belga-metrics")
+	clubChannel := make(chan *mq.Envelope, 100)
 
-	slog.Info("Starting OpenTelemetry Go Runtime Metrics")
-	telemetry.RuntimeStart(me)
+	slog.Info("Starting OpenTelemetry")
 
-	slog.Info("Starting OpenTelemetry Metrics")
-	if err := telemetry.MetricsStart(); err != nil {
-		slog.Error("Error starting metrics", "error", err)
-		os.Exit(1)
-	}
+	shutdownTelemetry, err := telemetry.Setup(ctx, telemetry.ConfigFromEnv("capy-belga-tracer", "capy-belga-metrics"))
 
 	defer func() {
-		if err := exp.Shutdown(ctx); err != nil {
-			slog.Error("Error shutting down exporter", "error", err)
-			os.Exit(1)
+		if err := shutdownTelemetry(ctx); err != nil {
+			slog.Error("Error shutting down telemetry", "error", err)
 		}
 	}()
 
+	if err != nil {
+		slog.Error("Error creating telemetry instruments", "error", err)
+		os.Exit(1)
+	}
+
+	adminAddress := os.Getenv("ADMIN_ADDRESS")
+	if adminAddress == "" {
+		adminAddress = ":9464"
+	}
+
+	server.StartAdminServer(ctx, adminAddress, router.AdminHandlers(&router.AdminDeps{
+		Sampler: telemetry.TraceSampler,
+		Metrics: telemetry.MetricsHandler,
+	}))
+
 	m, err := mq.NewMQ(os.Getenv("RABBITMQ_URL"))
 
 	if err != nil {
@@ -62,13 +71,46 @@ func main() {
 
 	defer m.Close()
 
-	queueNames := []string{"discount_club_create", "users", "discount_club_signup"}
+	if err := contract.Init(); err != nil {
+		slog.Error("Failed to register message contracts", "error", err)
+		return
+	}
+
+	declared := append(contract.Queues(), worker.NotificationsQueue, worker.UnroutableQueue)
 
-	if err := m.DeclareQueues(queueNames); err != nil {
+	if err := m.DeclareQueues(declared); err != nil {
 		slog.Error("Failed to declare queues", "error", err)
 		return
 	}
 
+	queues := slices.Clone(declared)
+	for _, q := range declared {
+		queues = append(queues, mq.DeadLetterQueue(q))
+	}
+
+	if err := m.RegisterQueueMetrics(queues); err != nil {
+		slog.Error("Failed to register queue metrics", "error", err)
+		return
+	}
+
+	if err := m.DeclareExchange(event.Exchange); err != nil {
+		slog.Error("Failed to declare events exchange", "error", err)
+		return
+	}
+
+	if err := m.BindQueue(worker.NotificationsQueue, event.Exchange, worker.NotificationBindings...); err != nil {
+		slog.Error("Failed to bind notifications queue", "error", err)
+		return
+	}
+
+	broker, err := m.NewEventPublisher(event.Exchange)
+	if err != nil {
+		slog.Error("Failed to create events publisher", "error", err)
+		return
+	}
+
+	defer broker.Close()
+
 	serverAddress := ":8080"
 	readTimeout := 5 * time.Second
 	writeTimeout := 10 * time.Second
@@ -77,15 +119,72 @@ func main() {
 	slog.Info("Handlers pipeline initialized")
 
 	repo := repository.NewRepository()
-	clubService := service.ClubService{Repo: repo}
-	userService := service.UserService{Repo: repo}
-	signupService := service.SignupService{Repo: repo}
+
+	// Events the broker doesn't take wait in the outbox for the relay.
+	events := &service.OutboxPublisher{Publisher: broker, Repo: repo}
+
+	if err := telemetry.RegisterActiveMembershipGauge(repo.ActiveMembershipCounts, 30*time.Second); err != nil {
+		slog.Error("Error registering active memberships gauge", "error", err)
+		os.Exit(1)
+	}
+	planChangePolicy := os.Getenv("CLUB_PLAN_CHANGE_POLICY")
+	if planChangePolicy != "" && planChangePolicy != entity.PlanChangeMigrate && planChangePolicy != entity.PlanChangeGrandfather {
+		slog.Warn("Unknown club plan change policy, using migrate", "policy", planChangePolicy)
+		planChangePolicy = entity.PlanChangeMigrate
+	}
+
+	clubService := service.ClubService{Repo: repo, Events: events, PlanChangePolicy: planChangePolicy}
+	userService := service.UserService{Repo: repo, Events: events}
+	signupService := service.SignupService{Repo: repo, Events: events, ReferralReward: referralRewardFromEnv()}
+	planService := service.PlanService{Repo: repo}
+	couponService := service.CouponService{Repo: repo}
+	partnerService := service.PartnerService{Repo: repo, Events: events}
+	attributionService := service.AttributionService{Repo: repo}
+
+	payments, err := payment.NewProviderFromEnv()
+	if err != nil {
+		slog.Error("Failed to create payment provider", "error", err)
+		os.Exit(1)
+	}
+
+	billingService := service.BillingService{
+		Repo:          repo,
+		Events:        events,
+		Payments:      payments,
+		GracePeriod:   env.Duration("BILLING_GRACE_PERIOD", 72*time.Hour),
+		RetryInterval: env.Duration("BILLING_RETRY_INTERVAL", 24*time.Hour),
+	}
+
+	channels, err := notify.ChannelsFromEnv()
+	if err != nil {
+		slog.Error("Failed to create notification channels", "error", err)
+		os.Exit(1)
+	}
+
+	templates, err := notify.LoadTemplates()
+	if err != nil {
+		slog.Error("Failed to load notification templates", "error", err)
+		os.Exit(1)
+	}
+
+	notificationService := service.NotificationService{
+		Repo:         repo,
+		Channels:     channels,
+		Templates:    templates,
+		MaxAttempts:  env.Int("NOTIFY_MAX_ATTEMPTS", 5),
+		RetryBackoff: env.Duration("NOTIFY_RETRY_BACKOFF", time.Minute),
+	}
 
 	deps := &router.HandlerDeps{
-		ClubChannel:   clubChannel,
-		UserService:   &userService,
-		ClubService:   &clubService,
-		SignupService: &signupService,
+		ClubChannel:         clubChannel,
+		UserService:         &userService,
+		ClubService:         &clubService,
+		SignupService:       &signupService,
+		PlanService:         &planService,
+		CouponService:       &couponService,
+		PartnerService:      &partnerService,
+		AttributionService:  &attributionService,
+		NotificationService: &notificationService,
 	}
 
 	router.HandlersPipeline(deps)
@@ -102,7 +201,7 @@ func main() {
 
 	go func() {
 		slog.Info("Starting worker to consume clubs")
-		if err := worker.ConsumeCreateClub(ctx, m, &clubService); err != nil {
+		if err := worker.ConsumeCreateClub(ctx, m, worker.NewConsumerConfig("discount_club_create", 10, 2), &clubService); err != nil {
 			slog.Error("Failed to start consuming worker", "error", err)
 			return
 		}
@@ -110,7 +209,7 @@ func main() {
 
 	go func() {
 		slog.Info("Starting worker to consume users")
-		if err := worker.ConsumeUser(ctx, m, &userService); err != nil {
+		if err := worker.ConsumeUser(ctx, m, worker.NewConsumerConfig("users", 50, 8), &userService); err != nil {
 			slog.Error("Failed to start consuming worker", "error", err)
 			return
 		}
@@ -118,11 +217,77 @@ func main() {
 
 	go func() {
 		slog.Info("Starting worker to consume discount club signups")
-		if err := worker.ConsumeClubSignup(ctx, m, &signupService); err != nil {
+		if err := worker.ConsumeClubSignup(ctx, m, worker.NewConsumerConfig("discount_club_signup", 50, 8), &signupService); err != nil {
+			slog.Error("Failed to start consuming worker", "error", err)
+			return
+		}
+	}()
+
+	go func() {
+		slog.Info("Starting worker to consume membership renewals")
+		if err := worker.ConsumeRenewal(ctx, m, worker.NewConsumerConfig("membership_renewal", 20, 4), &billingService); err != nil {
+			slog.Error("Failed to start consuming worker", "error", err)
+			return
+		}
+	}()
+
+	go func() {
+		slog.Info("Starting worker to consume notifications")
+
+		// The service gives up on a channel after its own attempts, so the
+		// queue allows an event a delivery per attempt on every channel.
+		cfg := worker.NewConsumerConfig(worker.NotificationsQueue, 20, 4)
+		cfg.MaxAttempts = max(cfg.MaxAttempts, notificationService.MaxAttempts*len(channels))
+
+		if err := worker.ConsumeNotifications(ctx, m, cfg, &notificationService); err != nil {
 			slog.Error("Failed to start consuming worker", "error", err)
 			return
 		}
 	}()
 
+	go func() {
+		slog.Info("Starting billing scheduler")
+		if err := worker.StartBillingScheduler(ctx, worker.NewSchedulerConfig(time.Minute, 100), &billingService, clubChannel); err != nil {
+			slog.Error("Billing scheduler stopped", "error", err)
+			return
+		}
+	}()
+
+	go func() {
+		slog.Info("Starting outbox relay")
+		if err := worker.StartOutboxRelay(ctx, worker.NewOutboxRelayConfig(10*time.Second, time.Minute, 100), events); err != nil {
+			slog.Error("Outbox relay stopped", "error", err)
+			return
+		}
+	}()
+
 	server.StartServer(ctx, serverAddress, readTimeout, writeTimeout, idleTimeout)
 }
+
+// referralRewardFromEnv reads the reward of referrers: REFERRAL_REWARD is
+// free_days (the default), with REFERRAL_REWARD_DAYS days, or coupon, with a
+// REFERRAL_REWARD_PERCENT percent discount.
+func referralRewardFromEnv() entity.ReferralReward {
+	reward := entity.ReferralReward{
+		Type:    os.Getenv("REFERRAL_REWARD"),
+		Days:    env.Int("REFERRAL_REWARD_DAYS", 30),
+		Percent: int64(env.Int("REFERRAL_REWARD_PERCENT", 50)),
+	}
+
+	if reward.Type != entity.RewardFreeDays && reward.Type != entity.RewardCoupon {
+		if reward.Type != "" {
+			slog.Warn("Unknown referral reward, using free_days", "reward", reward.Type)
+		}
+		reward.Type = entity.RewardFreeDays
+	}
+
+	if reward.Days < 1 {
+		reward.Days = 30
+	}
+
+	if reward.Percent < 1 || reward.Percent > 100 {
+		reward.Percent = 50
+	}
+
+	return reward
+}
@@ -0,0 +1,137 @@
+package contract
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/mq"
+)
+
+// Message types published to the queues.
+const (
+	TypeCreateClub = "create_discount_club"
+	TypeUser       = "users"
+	TypeClubSignup = "discount_club_signup"
+	TypeRenewal    = "membership_renewal"
+)
+
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// Registry holds the message contracts, built once by Init.
+var Registry *mq.Registry
+
+// contracts lists every message type. The content type is the default codec
+// producers use and can be overridden per queue with <QUEUE>_CONTENT_TYPE;
+// consumers accept any registered codec, so switching is safe while messages
+// are in flight. Every queue defaults to JSON: the protobuf codec is hand
+// written, so it is opt-in.
+var contracts = []struct {
+	msgType     string
+	version     int
+	queue       string
+	contentType string
+	new         func() any
+}{
+	{TypeCreateClub, 1, "discount_club_create", mq.ContentTypeJSON, func() any { return new(entity.Club) }},
+	{TypeUser, 1, "users", mq.ContentTypeJSON, func() any { return new(entity.User) }},
+	{TypeClubSignup, 1, "discount_club_signup", mq.ContentTypeJSON, func() any { return new(entity.SignupPayload) }},
+	{TypeRenewal, 1, "membership_renewal", mq.ContentTypeJSON, func() any { return new(entity.RenewalCommand) }},
+}
+
+// Init registers every message contract and the upcasters for the versions
+// still accepted from the queues.
+func Init() error {
+	r := mq.NewRegistry()
+
+	for _, c := range contracts {
+		doc, err := schemas.ReadFile(fmt.Sprintf("schemas/%s.v%d.json", c.msgType, c.version))
+		if err != nil {
+			return err
+		}
+
+		contentType := c.contentType
+		if ct := os.Getenv(strings.ToUpper(c.queue) + "_CONTENT_TYPE"); ct != "" {
+			contentType = ct
+		}
+
+		if _, err := mq.CodecFor(contentType); err != nil {
+			return fmt.Errorf("%s: %w, available %v", c.queue, err, mq.ContentTypes())
+		}
+
+		if err := r.Register(mq.MessageSchema{
+			Type:        c.msgType,
+			Version:     c.version,
+			Queue:       c.queue,
+			ContentType: contentType,
+			New:         c.new,
+			JSONSchema:  doc,
+		}); err != nil {
+			return err
+		}
+
+		if err := r.RegisterUpcaster(c.msgType, mq.LegacyVersion, unwrapLegacy); err != nil {
+			return err
+		}
+	}
+
+	Registry = r
+
+	return nil
+}
+
+// Queues returns the queues every registered message type is published to.
+func Queues() []string {
+	queues := make([]string, 0, len(contracts))
+	for _, c := range contracts {
+		queues = append(queues, c.queue)
+	}
+	return queues
+}
+
+// NewMessage builds an envelope for v at the current version of msgType,
+// encoded with the codec configured for its queue.
+func NewMessage(msgType, key, correlationID string, v any) (*mq.Envelope, error) {
+	s, err := Registry.Lookup(msgType)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := mq.CodecFor(s.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	e := mq.NewEnvelope(s.Type, s.Version, key, data)
+	e.ContentType = s.ContentType
+	e.CorrelationID = correlationID
+
+	return e, nil
+}
+
+// unwrapLegacy upcasts the pre-envelope {"type": ..., "data": ...} body to
+// the v1 data it wraps.
+func unwrapLegacy(data json.RawMessage) (json.RawMessage, error) {
+	var legacy struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+
+	if len(legacy.Data) == 0 {
+		return nil, fmt.Errorf("legacy message without data")
+	}
+
+	return legacy.Data, nil
+}
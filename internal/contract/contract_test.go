@@ -0,0 +1,45 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/mq"
+)
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{name: "json by default", want: mq.ContentTypeJSON},
+		{name: "protobuf opt-in", env: mq.ContentTypeProtobuf, want: mq.ContentTypeProtobuf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DISCOUNT_CLUB_SIGNUP_CONTENT_TYPE", tt.env)
+
+			if err := Init(); err != nil {
+				t.Fatal(err)
+			}
+
+			e, err := NewMessage(TypeClubSignup, "capy@email.com", "", &entity.SignupPayload{Email: "capy@email.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.ContentType != tt.want {
+				t.Errorf("ContentType = %q, want %q", e.ContentType, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownContentType(t *testing.T) {
+	t.Setenv("USERS_CONTENT_TYPE", "text/xml")
+
+	if err := Init(); err == nil {
+		t.Error("Init() accepted an unknown content type")
+	}
+}
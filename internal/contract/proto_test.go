@@ -0,0 +1,333 @@
+package contract
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/hazkall/capy-belga/internal/mq"
+)
+
+var (
+	protoMessage = regexp.MustCompile(`^message (\w+) \{$`)
+	protoField   = regexp.MustCompile(`^(repeated )?([\w.]+) (\w+) = (\d+);$`)
+	protoImport  = regexp.MustCompile(`^import "([^"]+)";$`)
+	protoPackage = regexp.MustCompile(`^package ([\w.]+);$`)
+)
+
+var protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":  descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32": descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64": descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"float":  descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"double": descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+}
+
+// loadMessagesProto compiles proto/messages.proto. It only understands the
+// subset of the language the file uses: top-level messages of scalar and
+// message fields.
+func loadMessagesProto(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+
+	src, err := os.ReadFile("proto/messages.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:   proto.String("messages.proto"),
+		Syntax: proto.String("proto3"),
+	}
+
+	var msg *descriptorpb.DescriptorProto
+
+	for i, line := range strings.Split(string(src), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		line = strings.Join(strings.Fields(line), " ")
+
+		switch {
+		case line == "" || line == `syntax = "proto3";`:
+		case protoPackage.MatchString(line):
+			file.Package = proto.String(protoPackage.FindStringSubmatch(line)[1])
+		case protoImport.MatchString(line):
+			file.Dependency = append(file.Dependency, protoImport.FindStringSubmatch(line)[1])
+		case protoMessage.MatchString(line):
+			msg = &descriptorpb.DescriptorProto{Name: proto.String(protoMessage.FindStringSubmatch(line)[1])}
+			file.MessageType = append(file.MessageType, msg)
+		case line == "}":
+			msg = nil
+		case msg != nil && protoField.MatchString(line):
+			f := protoField.FindStringSubmatch(line)
+			num, _ := strconv.Atoi(f[4])
+
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(f[3]),
+				Number: proto.Int32(int32(num)),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if f[1] != "" {
+				field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+
+			if typ, ok := protoScalars[f[2]]; ok {
+				field.Type = typ.Enum()
+			} else {
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + f[2])
+				if !strings.Contains(f[2], ".") {
+					field.TypeName = proto.String("." + file.GetPackage() + "." + f[2])
+				}
+			}
+
+			msg.Field = append(msg.Field, field)
+		default:
+			t.Fatalf("proto/messages.proto:%d: cannot parse %q", i+1, line)
+		}
+	}
+
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd
+}
+
+// contractMessages pairs every contract with the message of the same name in
+// messages.proto.
+func contractMessages(t *testing.T) map[string]protoreflect.MessageDescriptor {
+	t.Helper()
+
+	fd := loadMessagesProto(t)
+
+	messages := make(map[string]protoreflect.MessageDescriptor)
+	for _, c := range contracts {
+		name := reflect.TypeOf(c.new()).Elem().Name()
+
+		md := fd.Messages().ByName(protoreflect.Name(name))
+		if md == nil {
+			t.Fatalf("%s: messages.proto has no message %s", c.msgType, name)
+		}
+
+		messages[c.msgType] = md
+	}
+
+	return messages
+}
+
+func TestProtoTagsMatchMessagesProto(t *testing.T) {
+	fd := loadMessagesProto(t)
+	checked := make(map[protoreflect.FullName]bool)
+
+	for msgType, md := range contractMessages(t) {
+		for _, c := range contracts {
+			if c.msgType == msgType {
+				checkMessage(t, reflect.TypeOf(c.new()).Elem(), md, checked)
+			}
+		}
+	}
+
+	for i := 0; i < fd.Messages().Len(); i++ {
+		if md := fd.Messages().Get(i); !checked[md.FullName()] {
+			t.Errorf("message %s is not used by any contract", md.FullName())
+		}
+	}
+}
+
+// checkMessage checks that the tagged fields of typ are the fields of md, by
+// number, name and kind.
+func checkMessage(t *testing.T, typ reflect.Type, md protoreflect.MessageDescriptor, checked map[protoreflect.FullName]bool) {
+	t.Helper()
+
+	checked[md.FullName()] = true
+	seen := make(map[protoreflect.FieldNumber]bool)
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+
+		tag := sf.Tag.Get("proto")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		num, err := strconv.Atoi(tag)
+		if err != nil {
+			t.Errorf("%s.%s: invalid proto tag %q", typ, sf.Name, tag)
+			continue
+		}
+
+		fd := md.Fields().ByNumber(protoreflect.FieldNumber(num))
+		if fd == nil {
+			t.Errorf("%s.%s: %s has no field %d", typ, sf.Name, md.FullName(), num)
+			continue
+		}
+		seen[fd.Number()] = true
+
+		jsonName, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if string(fd.Name()) != jsonName {
+			t.Errorf("%s.%s: field %d of %s is %s, want %s", typ, sf.Name, num, md.FullName(), fd.Name(), jsonName)
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		switch {
+		case ft == reflect.TypeOf(time.Time{}):
+			if fd.Message() == nil || fd.Message().FullName() != "google.protobuf.Timestamp" {
+				t.Errorf("%s.%s: %s is %s, want google.protobuf.Timestamp", typ, sf.Name, fd.FullName(), fd.Kind())
+			}
+		case ft.Kind() == reflect.Struct:
+			if fd.Message() == nil {
+				t.Errorf("%s.%s: %s is %s, want a message", typ, sf.Name, fd.FullName(), fd.Kind())
+				continue
+			}
+			checkMessage(t, ft, fd.Message(), checked)
+		case !kindMatches(ft.Kind(), fd.Kind()):
+			t.Errorf("%s.%s: %s is %s, which %s cannot hold", typ, sf.Name, fd.FullName(), fd.Kind(), ft)
+		}
+	}
+
+	for i := 0; i < md.Fields().Len(); i++ {
+		if fd := md.Fields().Get(i); !seen[fd.Number()] {
+			t.Errorf("%s: no field tagged proto:\"%d\" for %s", typ, fd.Number(), fd.FullName())
+		}
+	}
+}
+
+func kindMatches(k reflect.Kind, pk protoreflect.Kind) bool {
+	switch k {
+	case reflect.String:
+		return pk == protoreflect.StringKind
+	case reflect.Bool:
+		return pk == protoreflect.BoolKind
+	case reflect.Int, reflect.Int64:
+		return pk == protoreflect.Int64Kind
+	case reflect.Int32:
+		return pk == protoreflect.Int32Kind
+	}
+	return false
+}
+
+// fill sets every tagged field of v to a distinct non-zero value.
+func fill(v reflect.Value, seed *int) {
+	for i := 0; i < v.NumField(); i++ {
+		if tag := v.Type().Field(i).Tag.Get("proto"); tag == "" || tag == "-" {
+			continue
+		}
+
+		*seed++
+		f := v.Field(i)
+
+		switch {
+		case f.Type() == reflect.TypeOf(time.Time{}):
+			f.Set(reflect.ValueOf(time.Date(2025, 3, 1, 12, 0, *seed, 500, time.UTC)))
+		case f.Kind() == reflect.String:
+			f.SetString(fmt.Sprintf("%s-%d", v.Type().Field(i).Name, *seed))
+		case f.Kind() == reflect.Int || f.Kind() == reflect.Int64:
+			f.SetInt(int64(*seed) << 33)
+		case f.Kind() == reflect.Pointer:
+			f.Set(reflect.New(f.Type().Elem()))
+			fill(f.Elem(), seed)
+		}
+	}
+}
+
+// dynamicOf builds the message a real protobuf implementation holds for v.
+func dynamicOf(m protoreflect.Message, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("proto")
+		if tag == "" || tag == "-" || v.Field(i).IsZero() {
+			continue
+		}
+
+		num, _ := strconv.Atoi(tag)
+		fd := m.Descriptor().Fields().ByNumber(protoreflect.FieldNumber(num))
+		f := v.Field(i)
+
+		switch {
+		case f.Type() == reflect.TypeOf(time.Time{}):
+			ts := m.Mutable(fd).Message()
+			at := f.Interface().(time.Time)
+			ts.Set(ts.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(at.Unix()))
+			ts.Set(ts.Descriptor().Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(at.Nanosecond())))
+		case f.Kind() == reflect.Pointer:
+			dynamicOf(m.Mutable(fd).Message(), f.Elem())
+		case f.Kind() == reflect.String:
+			m.Set(fd, protoreflect.ValueOfString(f.String()))
+		default:
+			m.Set(fd, protoreflect.ValueOfInt64(f.Int()))
+		}
+	}
+}
+
+func TestProtobufContracts(t *testing.T) {
+	messages := contractMessages(t)
+	codec := mq.ProtobufCodec{}
+
+	for _, c := range contracts {
+		t.Run(c.msgType, func(t *testing.T) {
+			seed := 0
+			want := c.new()
+			fill(reflect.ValueOf(want).Elem(), &seed)
+
+			data, err := codec.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Round trip through the codec.
+			got := c.new()
+			if err := codec.Unmarshal(data, got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %+v, want %+v", got, want)
+			}
+
+			reference := dynamicpb.NewMessage(messages[c.msgType])
+			dynamicOf(reference, reflect.ValueOf(want).Elem())
+
+			// The codec's bytes, read by a real protobuf implementation.
+			decoded := dynamicpb.NewMessage(messages[c.msgType])
+			if err := proto.Unmarshal(data, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(decoded, reference) {
+				t.Errorf("protobuf decoded %v, want %v", decoded, reference)
+			}
+
+			// A real protobuf implementation's bytes, read by the codec.
+			ref, err := proto.Marshal(reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got = c.new()
+			if err := codec.Unmarshal(ref, got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded protobuf bytes = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+type samplingResponse struct {
+	Ratio float64 `json:"ratio"`
+}
+
+func ControllerGetSampling(w http.ResponseWriter, r *http.Request, sampler *telemetry.Sampler) {
+	writeJSON(w, http.StatusOK, samplingResponse{Ratio: sampler.Ratio()})
+}
+
+func ControllerSetSampling(w http.ResponseWriter, r *http.Request, sampler *telemetry.Sampler) {
+	var req struct {
+		Ratio *float64 `json:"ratio"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Ratio == nil || *req.Ratio < 0 || *req.Ratio > 1 {
+		http.Error(w, "Erro de validação: ratio deve estar entre 0 e 1", http.StatusBadRequest)
+		return
+	}
+
+	previous := sampler.Ratio()
+	sampler.SetRatio(*req.Ratio)
+
+	slog.InfoContext(r.Context(), "Trace sampling ratio changed through admin endpoint", "previous", previous, "ratio", *req.Ratio, "remote_addr", r.RemoteAddr)
+
+	writeJSON(w, http.StatusOK, samplingResponse{Ratio: sampler.Ratio()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	responseJSON, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Erro ao gerar resposta: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+)
+
+func ControllerAttributionRegistry(w http.ResponseWriter, r *http.Request, attributionService *service.AttributionService) {
+
+	entries, err := attributionService.Registry(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao listar o registro de atribuição: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func ControllerAddRegistryEntry(w http.ResponseWriter, r *http.Request, attributionService *service.AttributionService) {
+
+	entry := new(entity.RegistryEntry)
+
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := entry.ValidateRegistryEntry(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := attributionService.AddRegistryEntry(r.Context(), entry)
+	if errors.Is(err, repository.ErrRegistryEntryExists) {
+		http.Error(w, "Valor já registrado", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao registrar o valor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+func ControllerRemoveRegistryEntry(w http.ResponseWriter, r *http.Request, attributionService *service.AttributionService) {
+
+	entry := &entity.RegistryEntry{Kind: r.PathValue("kind"), Value: r.PathValue("value")}
+
+	err := attributionService.RemoveRegistryEntry(r.Context(), entry)
+	if errors.Is(err, repository.ErrRegistryEntryNotFound) {
+		http.Error(w, "Valor não registrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao remover o valor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+)
+
+type clubRequest struct {
+	Name string `json:"name"`
+}
+
+func ControllerUpdateClub(w http.ResponseWriter, r *http.Request, clubService *service.ClubService, planService *service.PlanService) {
+
+	update := new(entity.ClubUpdate)
+
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	planCodes, err := planService.PlanCodes(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao obter o catálogo de planos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := update.ValidateClubUpdate(planCodes); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	club, err := clubService.UpdateClub(r.Context(), update)
+	switch {
+	case errors.Is(err, repository.ErrClubNotFound):
+		http.Error(w, "Clube não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrClubArchived):
+		http.Error(w, "Clube arquivado", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao atualizar o clube: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, club)
+}
+
+func ControllerArchiveClub(w http.ResponseWriter, r *http.Request, clubService *service.ClubService) {
+
+	req := new(clubRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, "Erro de validação: nome do clube não pode ser vazio", http.StatusBadRequest)
+		return
+	}
+
+	err := clubService.ArchiveClub(r.Context(), req.Name)
+	if errors.Is(err, repository.ErrClubNotFound) {
+		http.Error(w, "Clube não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao arquivar o clube: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Clube arquivado!"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Connection", "close")
+}
+
+func ControllerClubMembers(w http.ResponseWriter, r *http.Request, clubService *service.ClubService) {
+
+	query := new(entity.ClubMembersQuery)
+
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := query.ValidateClubMembersQuery(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	members, err := clubService.ClubMembers(r.Context(), query)
+	if errors.Is(err, repository.ErrClubNotFound) {
+		http.Error(w, "Clube não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao listar os membros do clube: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
@@ -2,40 +2,59 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 
+	"github.com/hazkall/capy-belga/internal/contract"
 	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
 	"github.com/hazkall/capy-belga/internal/domain/service"
+	"github.com/hazkall/capy-belga/internal/mq"
 	"github.com/hazkall/capy-belga/pkg/telemetry"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Message struct {
-	Type string          `json:"type"`
-	Data json.RawMessage `json:"data"`
+// correlationID returns the caller supplied X-Correlation-ID, falling back to
+// the trace ID so the messages of a request can always be tied together.
+func correlationID(r *http.Request) string {
+	if id := r.Header.Get("X-Correlation-ID"); id != "" {
+		return id
+	}
+
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+
+	return ""
 }
 
-func ControllerCreateDiscountClub(w http.ResponseWriter, r *http.Request, ch chan *Message) {
+func ControllerCreateDiscountClub(w http.ResponseWriter, r *http.Request, ch chan *mq.Envelope, planService *service.PlanService) {
 
 	club := new(entity.Club)
 
-	m := new(Message)
-
 	if err := json.NewDecoder(r.Body).Decode(&club); err != nil {
 		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	m.Type = "create_discount_club"
-	m.Data, _ = json.Marshal(club)
+	planCodes, err := planService.PlanCodes(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao obter o catálogo de planos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	if err := club.ValidateClub(); err != nil {
+	if err := club.ValidateClub(planCodes); err != nil {
 		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	m, err := contract.NewMessage(contract.TypeCreateClub, club.Name, correlationID(r), club)
+	if err != nil {
+		http.Error(w, "Erro ao criar mensagem: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	ch <- m
 
 	w.WriteHeader(http.StatusCreated)
@@ -44,25 +63,26 @@ func ControllerCreateDiscountClub(w http.ResponseWriter, r *http.Request, ch cha
 	w.Header().Set("Connection", "close")
 }
 
-func ControllerCreateUser(w http.ResponseWriter, r *http.Request, ch chan *Message) {
+func ControllerCreateUser(w http.ResponseWriter, r *http.Request, ch chan *mq.Envelope) {
 
 	user := new(entity.User)
 
-	m := new(Message)
-
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
 		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	m.Type = "users"
-	m.Data, _ = json.Marshal(user)
-
 	if err := user.ValidateUser(); err != nil {
 		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	m, err := contract.NewMessage(contract.TypeUser, user.Email, correlationID(r), user)
+	if err != nil {
+		http.Error(w, "Erro ao criar mensagem: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	slog.Info("Publicando mensagem na fila para usuário", "email", user.Email)
 
 	ch <- m
@@ -80,18 +100,34 @@ func ControllerHealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "close")
 }
 
-func ControllerCreateClubSignup(w http.ResponseWriter, r *http.Request, ch chan *Message) {
+func ControllerCreateClubSignup(w http.ResponseWriter, r *http.Request, ch chan *mq.Envelope, attributionService *service.AttributionService) {
 	signup := new(entity.SignupPayload)
 
-	m := new(Message)
-
 	if err := json.NewDecoder(r.Body).Decode(&signup); err != nil {
+		telemetry.RecordSignupFailure(r.Context(), telemetry.SignupFailureInvalidPayload)
 		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	m.Type = "discount_club_signup"
-	m.Data, _ = json.Marshal(signup)
+	if signup.Attribution != nil {
+		registry, err := attributionService.RegistryByKind(r.Context())
+		if err != nil {
+			http.Error(w, "Erro ao obter o registro de atribuição: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := signup.Attribution.ValidateAttribution(registry); err != nil {
+			telemetry.RecordSignupFailure(r.Context(), telemetry.SignupFailureInvalidAttribution)
+			http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	m, err := contract.NewMessage(contract.TypeClubSignup, signup.Email, correlationID(r), signup)
+	if err != nil {
+		http.Error(w, "Erro ao criar mensagem: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	ch <- m
 
@@ -118,6 +154,10 @@ func ControllerUserState(w http.ResponseWriter, r *http.Request, userService *se
 	slog.Info("Verificando estado do usuário", "email", user.Email)
 
 	state, err := userService.UserState(r.Context(), user.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Erro ao obter estado do usuário: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -152,6 +192,10 @@ func ControllerGetClubStatus(w http.ResponseWriter, r *http.Request, signupServi
 	}
 
 	status, plan, err := signupService.UserClubStatus(r.Context(), signup)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Erro ao obter status do clube: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -185,20 +229,23 @@ func ControllerCancelClubSignup(w http.ResponseWriter, r *http.Request, signupSe
 		return
 	}
 
-	if err := signupService.CancelSignup(r.Context(), plan); err != nil {
+	_, err := signupService.CancelSignup(r.Context(), plan)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrInactiveUser):
+		http.Error(w, "Usuário inativo", http.StatusConflict)
+		return
+	case errors.Is(err, service.ErrNoActiveMembership):
+		http.Error(w, "Nenhuma inscrição ativa para cancelar", http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		http.Error(w, "Erro ao cancelar a inscrição: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	telemetry.PlanGauge.Record(
-		r.Context(),
-		-1,
-		metric.WithAttributes(
-			attribute.String("email", plan.Email),
-			attribute.String("club_name", plan.ClubName),
-		),
-	)
-
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Inscrição no Clube de Desconto cancelada!"))
 	w.Header().Set("Content-Type", "application/json")
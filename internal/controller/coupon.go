@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+)
+
+func ControllerListCoupons(w http.ResponseWriter, r *http.Request, couponService *service.CouponService) {
+
+	coupons, err := couponService.ListCoupons(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao listar os cupons: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, coupons)
+}
+
+func ControllerGetCoupon(w http.ResponseWriter, r *http.Request, couponService *service.CouponService) {
+
+	coupon, err := couponService.GetCoupon(r.Context(), r.PathValue("code"))
+	if errors.Is(err, repository.ErrCouponNotFound) {
+		http.Error(w, "Cupom não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao obter o cupom: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, coupon)
+}
+
+func ControllerCreateCoupon(w http.ResponseWriter, r *http.Request, couponService *service.CouponService, planService *service.PlanService) {
+
+	coupon := new(entity.Coupon)
+
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	planCodes, err := planService.PlanCodes(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao obter o catálogo de planos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := coupon.ValidateCoupon(planCodes); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = couponService.CreateCoupon(r.Context(), coupon)
+	if errors.Is(err, repository.ErrCouponExists) {
+		http.Error(w, "Cupom já existe", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao criar o cupom: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, coupon)
+}
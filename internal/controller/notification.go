@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+)
+
+func ControllerNotificationPreferences(w http.ResponseWriter, r *http.Request, notificationService *service.NotificationService) {
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, "Erro de validação: email não pode ser vazio", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := notificationService.Preferences(r.Context(), req.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao obter as preferências de notificação: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+func ControllerUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request, notificationService *service.NotificationService) {
+
+	prefs := new(entity.NotificationPreferences)
+
+	if err := json.NewDecoder(r.Body).Decode(prefs); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := prefs.ValidateNotificationPreferences(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := notificationService.SavePreferences(r.Context(), prefs)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao salvar as preferências de notificação: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+)
+
+func ControllerCreatePartner(w http.ResponseWriter, r *http.Request, partnerService *service.PartnerService) {
+
+	partner := new(entity.Partner)
+
+	if err := json.NewDecoder(r.Body).Decode(&partner); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := partner.ValidatePartner(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := partnerService.CreatePartner(r.Context(), partner)
+	if errors.Is(err, repository.ErrPartnerExists) {
+		http.Error(w, "Parceiro já existe", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao criar o parceiro: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, partner)
+}
+
+func ControllerListPartners(w http.ResponseWriter, r *http.Request, partnerService *service.PartnerService) {
+
+	partners, err := partnerService.ListPartners(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao listar os parceiros: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, partners)
+}
+
+func ControllerCreateBenefit(w http.ResponseWriter, r *http.Request, partnerService *service.PartnerService) {
+
+	benefit := &entity.Benefit{Window: entity.WindowMonth}
+
+	if err := json.NewDecoder(r.Body).Decode(&benefit); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := benefit.ValidateBenefit(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := partnerService.CreateBenefit(r.Context(), benefit)
+	switch {
+	case errors.Is(err, repository.ErrPartnerNotFound):
+		http.Error(w, "Parceiro não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrClubNotFound):
+		http.Error(w, "Clube não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrBenefitExists):
+		http.Error(w, "Benefício já existe", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao criar o benefício: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, benefit)
+}
+
+// ControllerListBenefits lists the benefits of the club in the club query
+// parameter, or of every club without it.
+func ControllerListBenefits(w http.ResponseWriter, r *http.Request, partnerService *service.PartnerService) {
+
+	benefits, err := partnerService.ListBenefits(r.Context(), r.URL.Query().Get("club"))
+	if err != nil {
+		http.Error(w, "Erro ao listar os benefícios: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, benefits)
+}
+
+// ControllerRedeemBenefit is called by a partner when a member uses the
+// benefit in the path.
+func ControllerRedeemBenefit(w http.ResponseWriter, r *http.Request, partnerService *service.PartnerService) {
+
+	req := new(entity.BenefitRedemptionRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := req.ValidateBenefitRedemption(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redemption, err := partnerService.RedeemBenefit(r.Context(), r.PathValue("code"), req)
+	switch {
+	case errors.Is(err, repository.ErrBenefitNotFound):
+		http.Error(w, "Benefício não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrWrongPartner):
+		http.Error(w, "Benefício não é oferecido por este parceiro ou local", http.StatusForbidden)
+		return
+	case errors.Is(err, repository.ErrNotAMember):
+		http.Error(w, "Usuário sem inscrição ativa no clube do benefício", http.StatusForbidden)
+		return
+	case errors.Is(err, repository.ErrBenefitLimitReached):
+		http.Error(w, "Limite de uso do benefício atingido", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao registrar o uso do benefício: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, redemption)
+}
+
+func ControllerMemberRedemptions(w http.ResponseWriter, r *http.Request, partnerService *service.PartnerService) {
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, "Erro de validação: email não pode ser vazio", http.StatusBadRequest)
+		return
+	}
+
+	redemptions, err := partnerService.MemberRedemptions(r.Context(), req.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao listar os benefícios usados: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, redemptions)
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+)
+
+func ControllerListPlans(w http.ResponseWriter, r *http.Request, planService *service.PlanService) {
+
+	plans, err := planService.ListPlans(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao listar os planos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, plans)
+}
+
+func ControllerGetPlan(w http.ResponseWriter, r *http.Request, planService *service.PlanService) {
+
+	plan, err := planService.GetPlan(r.Context(), r.PathValue("code"))
+	if errors.Is(err, repository.ErrPlanNotFound) {
+		http.Error(w, "Plano não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao obter o plano: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, plan)
+}
+
+func ControllerCreatePlan(w http.ResponseWriter, r *http.Request, planService *service.PlanService) {
+
+	plan := new(entity.Plan)
+
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := plan.ValidatePlan(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := planService.CreatePlan(r.Context(), plan)
+	if errors.Is(err, repository.ErrPlanExists) {
+		http.Error(w, "Plano já existe", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao criar o plano: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, plan)
+}
+
+// ControllerUpdatePlan replaces the plan in the path with the body, whose code
+// is ignored.
+func ControllerUpdatePlan(w http.ResponseWriter, r *http.Request, planService *service.PlanService) {
+
+	plan := new(entity.Plan)
+
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan.Code = r.PathValue("code")
+
+	if err := plan.ValidatePlan(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := planService.UpdatePlan(r.Context(), plan)
+	if errors.Is(err, repository.ErrPlanNotFound) {
+		http.Error(w, "Plano não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao atualizar o plano: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, plan)
+}
+
+func ControllerDeletePlan(w http.ResponseWriter, r *http.Request, planService *service.PlanService) {
+
+	err := planService.DeletePlan(r.Context(), r.PathValue("code"))
+	switch {
+	case errors.Is(err, repository.ErrPlanNotFound):
+		http.Error(w, "Plano não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrPlanInUse):
+		http.Error(w, "Plano em uso por clubes ou inscrições", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao remover o plano: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
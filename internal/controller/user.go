@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+)
+
+func ControllerUpdateUser(w http.ResponseWriter, r *http.Request, userService *service.UserService) {
+
+	update := new(entity.UserUpdate)
+
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := update.ValidateUserUpdate(); err != nil {
+		http.Error(w, "Erro de validação: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := userService.UpdateUser(r.Context(), update)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, repository.ErrEmailInUse):
+		http.Error(w, "Email já está em uso", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao atualizar o usuário: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func ControllerDeactivateUser(w http.ResponseWriter, r *http.Request, userService *service.UserService) {
+	userLifecycle(w, r, userService.DeactivateUser, "Usuário desativado!")
+}
+
+func ControllerReactivateUser(w http.ResponseWriter, r *http.Request, userService *service.UserService) {
+	userLifecycle(w, r, userService.ReactivateUser, "Usuário reativado!")
+}
+
+func ControllerEraseUser(w http.ResponseWriter, r *http.Request, userService *service.UserService) {
+	userLifecycle(w, r, userService.EraseUser, "Dados do usuário apagados!")
+}
+
+// userLifecycle runs a state change on the user whose email is in the body.
+func userLifecycle(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, email string) error, done string) {
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, "Erro de validação: email não pode ser vazio", http.StatusBadRequest)
+		return
+	}
+
+	err := change(r.Context(), req.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao alterar o usuário: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(done))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Connection", "close")
+}
+
+func ControllerReferralSummary(w http.ResponseWriter, r *http.Request, userService *service.UserService) {
+
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Erro ao decodificar o JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, "Erro de validação: email não pode ser vazio", http.StatusBadRequest)
+		return
+	}
+
+	summary, err := userService.ReferralSummary(r.Context(), req.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Erro ao obter as indicações do usuário: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
@@ -26,6 +26,10 @@ func NewPostgres(host, port, user, password, dbname string) (*Postgres, error) {
 		return nil, err
 	}
 
+	if err := registerMetrics(db); err != nil {
+		return nil, err
+	}
+
 	slog.Info("Database connection established", "host", host, "port", port)
 
 	return &Postgres{DB: db}, nil
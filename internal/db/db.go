@@ -1,19 +1,33 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 )
 
-func (p *Postgres) Execute(query string, args ...interface{}) (sql.Result, error) {
-	return p.DB.Exec(query, args...)
+// ExecContext runs a statement that returns no rows, traced and timed.
+func (p *Postgres) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	cctx, op := startOperation(ctx, query)
+	res, err := p.DB.ExecContext(cctx, query, args...)
+	op.end(cctx, err)
+	return res, err
 }
 
-func (p *Postgres) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return p.DB.Query(query, args...)
+// QueryContext runs a query that returns rows, traced and timed. The timing
+// covers the round-trip until the first rows are available.
+func (p *Postgres) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	cctx, op := startOperation(ctx, query)
+	rows, err := p.DB.QueryContext(cctx, query, args...)
+	op.end(cctx, err)
+	return rows, err
 }
 
-func (p *Postgres) QueryRow(query string, args ...interface{}) *sql.Row {
-	return p.DB.QueryRow(query, args...)
+// QueryRowContext runs a query that returns at most one row, traced and timed.
+func (p *Postgres) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	cctx, op := startOperation(ctx, query)
+	row := p.DB.QueryRowContext(cctx, query, args...)
+	op.end(cctx, row.Err())
+	return row
 }
 
 func (p *Postgres) Close() error {
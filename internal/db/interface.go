@@ -1,12 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 )
 
 type Pg interface {
-	Execute(query string, args ...interface{}) (sql.Result, error)
-	Query(query string, args ...interface{}) (*sql.Rows, error)
-	QueryRow(query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	WithTx(ctx context.Context, name string, fn func(ctx context.Context, tx *Tx) error) error
 	Close() error
 }
@@ -9,18 +9,64 @@ CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     email VARCHAR(100) NOT NULL,
+    -- email_normalized is the email without case, +tags and, for Gmail, dots;
+    -- referrals use it to spot one person behind several accounts.
+    email_normalized VARCHAR(100),
+    referral_code VARCHAR(20) UNIQUE,
     active BOOLEAN NOT NULL DEFAULT TRUE,
+    erased_at TIMESTAMP,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS plans (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    price_cents INTEGER NOT NULL CHECK (price_cents >= 0),
+    currency CHAR(3) NOT NULL,
+    billing_interval VARCHAR(20) NOT NULL,
+    trial_days INTEGER NOT NULL DEFAULT 0 CHECK (trial_days >= 0),
+    benefits TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (code, name, price_cents, currency, billing_interval, trial_days, benefits)
+VALUES
+    ('basic', 'Básico', 1990, 'BRL', 'month', 7, '{"Descontos em lojas parceiras"}'),
+    ('premium', 'Premium', 4990, 'BRL', 'month', 14, '{"Descontos em lojas parceiras", "Frete grátis", "Atendimento prioritário"}')
+ON CONFLICT (code) DO NOTHING;
+
+-- Values allowed in the attribution of a signup, by kind: store, utm_source,
+-- utm_medium or utm_campaign.
+CREATE TABLE IF NOT EXISTS attribution_registry (
+    kind VARCHAR(30) NOT NULL,
+    value VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, value)
+);
+
+INSERT INTO attribution_registry (kind, value)
+VALUES
+    ('utm_source', 'google'),
+    ('utm_source', 'facebook'),
+    ('utm_source', 'instagram'),
+    ('utm_source', 'newsletter'),
+    ('utm_medium', 'cpc'),
+    ('utm_medium', 'social'),
+    ('utm_medium', 'email'),
+    ('utm_medium', 'organic')
+ON CONFLICT (kind, value) DO NOTHING;
+
 CREATE TABLE IF NOT EXISTS clubs (
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     description TEXT,
     aquisition_channel VARCHAR(100),
     aquisition_location VARCHAR(100),
-    plan_type VARCHAR(50),
+    plan_type VARCHAR(50) REFERENCES plans(code),
+    archived_at TIMESTAMP,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -32,17 +78,189 @@ CREATE TABLE IF NOT EXISTS user_club (
     user_id INTEGER NOT NULL REFERENCES users(id),
     club_id INTEGER NOT NULL REFERENCES clubs(id),
     active BOOLEAN NOT NULL DEFAULT TRUE,
+    suspended BOOLEAN NOT NULL DEFAULT FALSE,
+    -- plan_type is set when the member keeps a plan the club no longer has;
+    -- otherwise the member follows the plan of the club.
+    plan_type VARCHAR(50) REFERENCES plans(code),
+    -- Billing cycle: billing_status is current, grace after a failed
+    -- renewal, or expired once the grace period ran out.
+    billing_status VARCHAR(20) NOT NULL DEFAULT 'current',
+    current_period_end TIMESTAMP,
+    grace_until TIMESTAMP,
+    renewal_attempts INTEGER NOT NULL DEFAULT 0,
+    renewal_requested_at TIMESTAMP,
+    -- Attribution of the signup; channel and location default to the club's.
+    aquisition_channel VARCHAR(50),
+    aquisition_location VARCHAR(50),
+    store_id VARCHAR(100),
+    utm_campaign VARCHAR(100),
+    utm_source VARCHAR(100),
+    utm_medium VARCHAR(100),
+    referrer VARCHAR(255),
     joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 
+CREATE TABLE IF NOT EXISTS coupons (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    -- A percent coupon takes discount_value percent off the plan price, a
+    -- fixed one discount_value minor units of currency.
+    discount_type VARCHAR(20) NOT NULL,
+    discount_value INTEGER NOT NULL CHECK (discount_value > 0),
+    currency CHAR(3),
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    -- NULL limits mean unlimited redemptions.
+    max_redemptions INTEGER,
+    max_per_user INTEGER,
+    -- Empty restrictions mean any club or plan type.
+    clubs TEXT[] NOT NULL DEFAULT '{}',
+    plan_types TEXT[] NOT NULL DEFAULT '{}',
+    -- A coupon with an owner, such as a referral reward, can only be
+    -- redeemed by that user.
+    owner_id INTEGER REFERENCES users(id),
+    redemptions INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id SERIAL PRIMARY KEY,
+    coupon_id INTEGER NOT NULL REFERENCES coupons(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    user_club_id INTEGER NOT NULL UNIQUE REFERENCES user_club(id),
+    discount_cents INTEGER NOT NULL,
+    currency CHAR(3) NOT NULL,
+    -- Set once the discount was taken off the first paid period.
+    applied_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+
+CREATE TABLE IF NOT EXISTS partners (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- kind is store or website, like clubs.aquisition_location; address is the
+-- street address of a store or the URL of a website.
+CREATE TABLE IF NOT EXISTS partner_locations (
+    id SERIAL PRIMARY KEY,
+    partner_id INTEGER NOT NULL REFERENCES partners(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    address VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A benefit is offered by a partner to the members of a club. Each member can
+-- redeem it max_per_member times per redemption_window (day, week, month or
+-- total); a NULL max_per_member means unlimited.
+CREATE TABLE IF NOT EXISTS benefits (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    partner_id INTEGER NOT NULL REFERENCES partners(id),
+    club_id INTEGER NOT NULL REFERENCES clubs(id),
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    max_per_member INTEGER,
+    redemption_window VARCHAR(10) NOT NULL DEFAULT 'month',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS benefit_redemptions (
+    id SERIAL PRIMARY KEY,
+    benefit_id INTEGER NOT NULL REFERENCES benefits(id),
+    user_club_id INTEGER NOT NULL REFERENCES user_club(id),
+    partner_location_id INTEGER REFERENCES partner_locations(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+
+-- A referral is pending until the referred user's first membership becomes
+-- active, when the referrer is rewarded. Rejected referrals keep the reason.
+CREATE TABLE IF NOT EXISTS referrals (
+    id SERIAL PRIMARY KEY,
+    referrer_id INTEGER NOT NULL REFERENCES users(id),
+    referred_id INTEGER NOT NULL UNIQUE REFERENCES users(id),
+    status VARCHAR(20) NOT NULL,
+    reason VARCHAR(50),
+    reward_coupon VARCHAR(50),
+    rewarded_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Users without a row are notified in the default locale on every channel
+-- the server delivers through.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id),
+    locale VARCHAR(5) NOT NULL,
+    channels TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per event and channel, so a redelivered event is not notified
+-- twice and failed deliveries are retried a bounded number of times.
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    kind VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP,
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (event_id, channel)
+);
+
+-- Domain events the broker didn't take, kept until the outbox relay
+-- publishes them.
+CREATE TABLE IF NOT EXISTS outbox (
+    id SERIAL PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL UNIQUE,
+    routing_key VARCHAR(100) NOT NULL,
+    subject TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_audit (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    action VARCHAR(50) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+
 CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE UNIQUE INDEX IF NOT EXISTS idx_clubs_name ON clubs(name);
 CREATE UNIQUE INDEX IF NOT EXISTS idx_user_club_userid_clubid ON user_club(user_id, club_id);
 CREATE INDEX IF NOT EXISTS idx_user_club_user_id ON user_club(user_id);
 CREATE INDEX IF NOT EXISTS idx_user_club_club_id ON user_club(club_id);
+CREATE INDEX IF NOT EXISTS idx_user_club_club_joined ON user_club(club_id, COALESCE(joined_at, created_at) DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_user_audit_user_id ON user_audit(user_id);
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_coupon_user ON coupon_redemptions(coupon_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_partner_locations_partner_id ON partner_locations(partner_id);
+CREATE INDEX IF NOT EXISTS idx_benefits_club_id ON benefits(club_id);
+CREATE INDEX IF NOT EXISTS idx_benefit_redemptions_membership ON benefit_redemptions(user_club_id, benefit_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_users_email_normalized ON users(email_normalized);
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer_id ON referrals(referrer_id);
+CREATE INDEX IF NOT EXISTS idx_user_club_due ON user_club(current_period_end) WHERE active;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id);
 
 ALTER TABLE clubs ADD CONSTRAINT unique_club_name UNIQUE (name);
 ALTER TABLE users ADD CONSTRAINT unique_user_email UNIQUE (email);
@@ -63,6 +281,36 @@ BEFORE UPDATE ON users
 FOR EACH ROW
 EXECUTE FUNCTION set_updated_at();
 
+CREATE TRIGGER trigger_set_updated_at_plans
+BEFORE UPDATE ON plans
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER trigger_set_updated_at_coupons
+BEFORE UPDATE ON coupons
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER trigger_set_updated_at_partners
+BEFORE UPDATE ON partners
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER trigger_set_updated_at_benefits
+BEFORE UPDATE ON benefits
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER trigger_set_updated_at_notification_preferences
+BEFORE UPDATE ON notification_preferences
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER trigger_set_updated_at_notifications
+BEFORE UPDATE ON notifications
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
 CREATE TRIGGER trigger_set_updated_at_clubs
 BEFORE UPDATE ON clubs
 FOR EACH ROW
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const dbSystem = "postgresql"
+
+var (
+	operationDuration metric.Float64Histogram
+	instrumentsOnce   sync.Once
+	instrumentsErr    error
+
+	dbDurationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`([^$\w.])\d+(?:\.\d+)?\b`)
+	comment        = regexp.MustCompile(`--[^\n]*|(?s)/\*.*?\*/`)
+	literalList    = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	whitespace     = regexp.MustCompile(`\s+`)
+	tableName      = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE|JOIN)\s+([a-z_][a-z0-9_.]*)`)
+)
+
+type operation struct {
+	span      trace.Span
+	start     time.Time
+	table     string
+	operation string
+}
+
+// startOperation starts the client span of one database call. The returned
+// context carries the span, so the driver call is cancelled with the caller.
+func startOperation(ctx context.Context, query string) (context.Context, *operation) {
+	op, table := describe(query)
+
+	name := op
+	if table != "" {
+		name = op + " " + table
+	}
+
+	cctx, span := telemetry.Tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", dbSystem),
+			attribute.String("db.operation.name", op),
+			attribute.String("db.collection.name", table),
+			attribute.String("db.query.text", Sanitize(query)),
+		),
+	)
+
+	return cctx, &operation{span: span, start: time.Now(), table: table, operation: op}
+}
+
+func (o *operation) end(ctx context.Context, err error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system.name", dbSystem),
+		attribute.String("db.operation.name", o.operation),
+		attribute.String("db.collection.name", o.table),
+	}
+
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.type", fmt.Sprintf("%T", err)))
+		o.span.RecordError(err)
+		o.span.SetStatus(codes.Error, err.Error())
+	}
+
+	if operationDuration != nil {
+		operationDuration.Record(ctx, time.Since(o.start).Seconds(), metric.WithAttributes(attrs...))
+	}
+
+	o.span.End()
+}
+
+// describe returns the operation (SELECT, INSERT, ...) and the first table a
+// query touches.
+func describe(query string) (op, table string) {
+	query = Sanitize(query)
+
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "UNKNOWN", ""
+	}
+
+	op = strings.ToUpper(fields[0])
+
+	if m := tableName.FindStringSubmatch(query); m != nil {
+		table = strings.ToLower(m[1])
+	}
+
+	return op, table
+}
+
+// Sanitize removes literals and comments from a query and collapses its
+// whitespace, so it can be attached to spans without leaking values that were
+// not bound as parameters. A list of literals, as in IN (1, 2, 3), becomes a
+// single (?), so queries differing only in the length of the list read the
+// same.
+func Sanitize(query string) string {
+	q := stringLiteral.ReplaceAllString(query, "?")
+	q = comment.ReplaceAllString(q, " ")
+	q = numericLiteral.ReplaceAllString(q, "${1}?")
+	q = literalList.ReplaceAllString(q, "(?)")
+	return strings.TrimSpace(whitespace.ReplaceAllString(q, " "))
+}
+
+// registerMetrics creates the operation duration histogram and exports the
+// connection pool statistics of db as observable instruments.
+func registerMetrics(db *sql.DB) error {
+	instrumentsOnce.Do(func() {
+		operationDuration, instrumentsErr = telemetry.Meter.Float64Histogram(
+			"db.client.operation.duration",
+			metric.WithDescription("Duration of database client operations"),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(dbDurationBuckets...),
+		)
+	})
+	if instrumentsErr != nil {
+		return instrumentsErr
+	}
+
+	connections, err := telemetry.Meter.Int64ObservableGauge(
+		"db.client.connection.count",
+		metric.WithDescription("Number of connections in the pool by state, used plus idle being the open connections"),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	maxConnections, err := telemetry.Meter.Int64ObservableGauge(
+		"db.client.connection.max",
+		metric.WithDescription("Maximum number of open connections allowed"),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	waitCount, err := telemetry.Meter.Int64ObservableCounter(
+		"db.client.connection.wait_count",
+		metric.WithDescription("Total number of connections waited for"),
+		metric.WithUnit("{wait}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	waitDuration, err := telemetry.Meter.Float64ObservableCounter(
+		"db.client.connection.wait_duration",
+		metric.WithDescription("Total time blocked waiting for a new connection"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	system := attribute.String("db.system.name", dbSystem)
+
+	_, err = telemetry.Meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := db.Stats()
+
+		o.ObserveInt64(connections, int64(stats.InUse), metric.WithAttributes(system, attribute.String("db.client.connection.state", "used")))
+		o.ObserveInt64(connections, int64(stats.Idle), metric.WithAttributes(system, attribute.String("db.client.connection.state", "idle")))
+		o.ObserveInt64(maxConnections, int64(stats.MaxOpenConnections), metric.WithAttributes(system))
+		o.ObserveInt64(waitCount, stats.WaitCount, metric.WithAttributes(system))
+		o.ObserveFloat64(waitDuration, stats.WaitDuration.Seconds(), metric.WithAttributes(system))
+
+		return nil
+	}, connections, maxConnections, waitCount, waitDuration)
+
+	return err
+}
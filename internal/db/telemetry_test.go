@@ -0,0 +1,95 @@
+package db
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "bound parameters",
+			query: "SELECT id FROM users WHERE email = $1 AND id <> $2",
+			want:  "SELECT id FROM users WHERE email = $1 AND id <> $2",
+		},
+		{
+			name:  "string literals",
+			query: "SELECT id FROM users WHERE email = 'capy@email.com' AND name = 'D''Avila'",
+			want:  "SELECT id FROM users WHERE email = ? AND name = ?",
+		},
+		{
+			name:  "numbers",
+			query: "UPDATE plans SET price_cents = 2990, ratio = 0.5 WHERE id = 7",
+			want:  "UPDATE plans SET price_cents = ?, ratio = ? WHERE id = ?",
+		},
+		{
+			name:  "numbers in identifiers stay",
+			query: "SELECT t1.id FROM user_club t1 LIMIT $1",
+			want:  "SELECT t1.id FROM user_club t1 LIMIT $1",
+		},
+		{
+			name:  "IN lists",
+			query: "SELECT id FROM clubs WHERE id IN (1, 2, 3) AND name IN ('a','b')",
+			want:  "SELECT id FROM clubs WHERE id IN (?) AND name IN (?)",
+		},
+		{
+			name:  "IN list of parameters",
+			query: "SELECT id FROM clubs WHERE id IN ($1, $2)",
+			want:  "SELECT id FROM clubs WHERE id IN ($1, $2)",
+		},
+		{
+			name:  "line comments",
+			query: "-- lookup of capy@email.com\nSELECT id FROM users -- by email\nWHERE email = $1",
+			want:  "SELECT id FROM users WHERE email = $1",
+		},
+		{
+			name:  "block comments",
+			query: "SELECT /* user 42,\ncapy@email.com */ id FROM users",
+			want:  "SELECT id FROM users",
+		},
+		{
+			name:  "comment markers inside literals",
+			query: "SELECT id FROM users WHERE name = '-- not a comment' AND note = '/* nor this */'",
+			want:  "SELECT id FROM users WHERE name = ? AND note = ?",
+		},
+		{
+			name:  "whitespace",
+			query: "\n\t\tSELECT id\n\t\tFROM users\n\t",
+			want:  "SELECT id FROM users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.query); got != tt.want {
+				t.Errorf("Sanitize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantOp    string
+		wantTable string
+	}{
+		{"SELECT id FROM users WHERE email = $1", "SELECT", "users"},
+		{"insert into coupon_redemptions (coupon_id) values ($1)", "INSERT", "coupon_redemptions"},
+		{"UPDATE user_club uc SET active = false FROM clubs c", "UPDATE", "user_club"},
+		{"DELETE FROM outbox WHERE event_id = $1", "DELETE", "outbox"},
+		{"WITH claimed AS (UPDATE outbox SET attempts = 1) SELECT * FROM claimed", "WITH", "outbox"},
+		{"-- leading comment\nSELECT id FROM Users", "SELECT", "users"},
+		{"SELECT 'FROM secrets' FROM users", "SELECT", "users"},
+		{"BEGIN", "BEGIN", ""},
+		{"", "UNKNOWN", ""},
+	}
+
+	for _, tt := range tests {
+		op, table := describe(tt.query)
+		if op != tt.wantOp || table != tt.wantTable {
+			t.Errorf("describe(%q) = %q, %q, want %q, %q", tt.query, op, table, tt.wantOp, tt.wantTable)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Querier runs statements either directly on the pool or inside a
+// transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Tx is a transaction whose statements are traced and timed like the ones
+// run on Postgres.
+type Tx struct {
+	tx *sql.Tx
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	cctx, op := startOperation(ctx, query)
+	res, err := t.tx.ExecContext(cctx, query, args...)
+	op.end(cctx, err)
+	return res, err
+}
+
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	cctx, op := startOperation(ctx, query)
+	rows, err := t.tx.QueryContext(cctx, query, args...)
+	op.end(cctx, err)
+	return rows, err
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	cctx, op := startOperation(ctx, query)
+	row := t.tx.QueryRowContext(cctx, query, args...)
+	op.end(cctx, row.Err())
+	return row
+}
+
+// WithTx runs fn in a transaction, committing when fn returns nil and rolling
+// back otherwise. The transaction gets a span named after it, parent of the
+// spans of its statements.
+func (p *Postgres) WithTx(ctx context.Context, name string, fn func(ctx context.Context, tx *Tx) error) (err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "TX "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", dbSystem),
+			attribute.String("db.transaction.name", name),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	sqlTx, err := p.DB.BeginTx(cctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(cctx, &Tx{tx: sqlTx}); err != nil {
+		span.SetAttributes(attribute.String("db.transaction.outcome", "rollback"))
+		if rbErr := sqlTx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	span.SetAttributes(attribute.String("db.transaction.outcome", "commit"))
+
+	return sqlTx.Commit()
+}
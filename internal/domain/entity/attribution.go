@@ -0,0 +1,38 @@
+package entity
+
+// Acquisition channels, the values of Club.AquisitionChannel.
+const (
+	ChannelOnline  = "online"
+	ChannelOffline = "offline"
+)
+
+// Kinds of value in the attribution registry.
+const (
+	RegistryStore       = "store"
+	RegistryUTMSource   = "utm_source"
+	RegistryUTMMedium   = "utm_medium"
+	RegistryUTMCampaign = "utm_campaign"
+)
+
+// RegistryKinds are the kinds of value in the attribution registry.
+var RegistryKinds = []string{RegistryStore, RegistryUTMSource, RegistryUTMMedium, RegistryUTMCampaign}
+
+// Attribution is how a signup was acquired. Channel and Location default to
+// those of the club.
+type Attribution struct {
+	Channel     string `json:"channel,omitempty" proto:"1"`
+	Location    string `json:"location,omitempty" proto:"2"`
+	StoreID     string `json:"store_id,omitempty" proto:"3"`
+	UTMCampaign string `json:"utm_campaign,omitempty" proto:"4"`
+	UTMSource   string `json:"utm_source,omitempty" proto:"5"`
+	UTMMedium   string `json:"utm_medium,omitempty" proto:"6"`
+	// Referrer is where the signup came from, such as a referral code or the
+	// referring site. It is kept out of the metrics.
+	Referrer string `json:"referrer,omitempty" proto:"7"`
+}
+
+// RegistryEntry is a value allowed in the attribution of a signup.
+type RegistryEntry struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
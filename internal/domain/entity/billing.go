@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+// Billing states of a membership.
+const (
+	// BillingCurrent memberships are paid up to their period end.
+	BillingCurrent = "current"
+	// BillingGrace memberships failed to renew and stay active until their
+	// grace period ends.
+	BillingGrace = "grace"
+	// BillingExpired memberships ran out of grace without a renewal.
+	BillingExpired = "expired"
+)
+
+// RenewalCommand asks for the renewal of a membership whose period ended at
+// PeriodEnd. A command for a period that was already renewed is ignored.
+type RenewalCommand struct {
+	MembershipID int64     `json:"membership_id" proto:"1"`
+	PeriodEnd    time.Time `json:"period_end" proto:"2"`
+	// Attempt is the number of renewals of this period that failed before.
+	Attempt int `json:"attempt" proto:"3"`
+}
+
+// Subscription is the billing view of a membership.
+type Subscription struct {
+	MembershipID  int64
+	Email         string
+	Club          Club
+	Plan          Plan
+	Active        bool
+	BillingStatus string
+	JoinedAt      time.Time
+	PeriodEnd     time.Time
+	GraceUntil    time.Time
+	Attempts      int
+	// DiscountCents is the coupon discount still to be taken off the next
+	// paid period.
+	DiscountCents int64
+}
@@ -0,0 +1,37 @@
+package entity
+
+import "time"
+
+// Discount types of a coupon.
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// Coupon is a promo code that discounts the first paid period of a
+// membership when given at signup.
+type Coupon struct {
+	Code         string `json:"code"`
+	DiscountType string `json:"discount_type"`
+	// DiscountValue is a percentage for DiscountPercent and an amount in the
+	// minor unit of Currency for DiscountFixed.
+	DiscountValue int64      `json:"discount_value"`
+	Currency      string     `json:"currency,omitempty"`
+	ValidFrom     *time.Time `json:"valid_from,omitempty"`
+	ValidUntil    *time.Time `json:"valid_until,omitempty"`
+	// MaxRedemptions and MaxPerUser are unlimited when zero.
+	MaxRedemptions int `json:"max_redemptions,omitempty"`
+	MaxPerUser     int `json:"max_per_user,omitempty"`
+	// Clubs and PlanTypes restrict the coupon to those clubs and plans when
+	// not empty.
+	Clubs       []string `json:"clubs"`
+	PlanTypes   []string `json:"plan_types"`
+	Redemptions int      `json:"redemptions"`
+}
+
+// CouponRedemption is a coupon redeemed by a membership.
+type CouponRedemption struct {
+	Code          string `json:"code"`
+	DiscountCents int64  `json:"discount_cents"`
+	Currency      string `json:"currency"`
+}
@@ -1,15 +1,137 @@
 package entity
 
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Club struct {
-	ID                 int64  `json:"id,omitempty"`
-	Name               string `json:"name"`
-	Description        string `json:"description"`
-	AquisitionChannel  string `json:"aquisition_channel"`
-	AquisitionLocation string `json:"aquisition_location"`
-	PlanType           string `json:"plan_type"`
+	ID                 int64  `json:"id,omitempty" proto:"1"`
+	Name               string `json:"name" proto:"2"`
+	Description        string `json:"description" proto:"3"`
+	AquisitionChannel  string `json:"aquisition_channel" proto:"4"`
+	AquisitionLocation string `json:"aquisition_location" proto:"5"`
+	PlanType           string `json:"plan_type" proto:"6"`
 }
 
 type SignupPayload struct {
-	Email    string `json:"email"`
-	ClubName string `json:"club"`
+	Email    string `json:"email" proto:"1"`
+	ClubName string `json:"club" proto:"2"`
+	// Coupon is an optional promo code redeemed by the signup.
+	Coupon string `json:"coupon,omitempty" proto:"3"`
+	// Attribution is how the signup was acquired, if known.
+	Attribution *Attribution `json:"attribution,omitempty" proto:"4"`
+}
+
+// Membership is the signup of a user to a club.
+type Membership struct {
+	Club     Club
+	JoinedAt time.Time
+	// UserRegisteredAt is when the member registered as a user.
+	UserRegisteredAt time.Time
+	// First is set when this was the first signup of the user.
+	First bool
+	// Coupon is the coupon redeemed by the signup, if any.
+	Coupon *CouponRedemption
+	// Referral is the reward the signup gave to the referrer of the user,
+	// if any.
+	Referral *ReferralGrant
+	// Attribution is the attribution of the signup, with the channel and
+	// location of the club when it had none.
+	Attribution Attribution
+}
+
+// Policies for the existing members of a club whose plan type changes.
+const (
+	// PlanChangeMigrate moves every member to the new plan.
+	PlanChangeMigrate = "migrate"
+	// PlanChangeGrandfather keeps current members on the plan they have.
+	PlanChangeGrandfather = "grandfather"
+)
+
+// ClubUpdate changes the fields of the club with Name that are set.
+type ClubUpdate struct {
+	Name               string `json:"name"`
+	Description        string `json:"description,omitempty"`
+	AquisitionChannel  string `json:"aquisition_channel,omitempty"`
+	AquisitionLocation string `json:"aquisition_location,omitempty"`
+	PlanType           string `json:"plan_type,omitempty"`
+	// PlanChangePolicy overrides the configured policy for this update.
+	PlanChangePolicy string `json:"plan_change_policy,omitempty"`
+}
+
+// States of a membership.
+const (
+	MemberActive    = "active"
+	MemberGrace     = "grace"
+	MemberSuspended = "suspended"
+	MemberExpired   = "expired"
+	MemberCancelled = "cancelled"
+)
+
+type ClubMember struct {
+	// ID is the membership, which orders members joined at the same time.
+	ID       int64     `json:"-"`
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	PlanType string    `json:"plan_type"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Page sizes of the club members listing.
+const (
+	DefaultClubMembersLimit = 50
+	MaxClubMembersLimit     = 500
+)
+
+// ClubMembersQuery asks for a page of the members of a club. Cursor is the
+// NextCursor of the previous page, empty for the first one.
+type ClubMembersQuery struct {
+	Name   string `json:"name"`
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+// MemberCursor is the position after the last member of a page, members
+// being listed by joined_at and then ID, the most recent first.
+type MemberCursor struct {
+	JoinedAt time.Time
+	ID       int64
+}
+
+// String encodes the cursor as the opaque token given to clients.
+func (c MemberCursor) String() string {
+	raw := strconv.FormatInt(c.JoinedAt.UnixNano(), 10) + "." + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseMemberCursor decodes a cursor encoded by MemberCursor.String.
+func ParseMemberCursor(s string) (*MemberCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	at, id, ok := strings.Cut(string(raw), ".")
+	nanos, errAt := strconv.ParseInt(at, 10, 64)
+	memberID, errID := strconv.ParseInt(id, 10, 64)
+	if !ok || errAt != nil || errID != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &MemberCursor{JoinedAt: time.Unix(0, nanos).UTC(), ID: memberID}, nil
+}
+
+// ClubMembers is a page of the members of a club with the count per state of
+// all of them.
+type ClubMembers struct {
+	Club    string         `json:"club"`
+	Counts  map[string]int `json:"counts"`
+	Members []ClubMember   `json:"members"`
+	// NextCursor asks for the next page, empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
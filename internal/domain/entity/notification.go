@@ -0,0 +1,46 @@
+package entity
+
+// Locales notifications are written in.
+const (
+	LocalePortuguese = "pt"
+	LocaleEnglish    = "en"
+
+	DefaultLocale = LocalePortuguese
+)
+
+var Locales = []string{LocalePortuguese, LocaleEnglish}
+
+// Channels notifications are delivered through.
+const (
+	NotifyEmail   = "email"
+	NotifyWebhook = "webhook"
+	// NotifyLog writes notifications to a file or the log, for local
+	// development.
+	NotifyLog = "log"
+)
+
+var NotificationChannels = []string{NotifyEmail, NotifyWebhook, NotifyLog}
+
+// States of a notification on one channel.
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// NotificationPreferences are the locale and the channels a user is notified
+// in. An empty Channels opts the user out of every notification.
+type NotificationPreferences struct {
+	Email    string   `json:"email,omitempty"`
+	Locale   string   `json:"locale"`
+	Channels []string `json:"channels"`
+}
+
+// NotificationRecipient is the user a notification is sent to. Preferences
+// is nil for users who never set theirs.
+type NotificationRecipient struct {
+	UserID      int64
+	Email       string
+	Name        string
+	Preferences *NotificationPreferences
+}
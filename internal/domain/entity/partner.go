@@ -0,0 +1,62 @@
+package entity
+
+import "time"
+
+// Kinds of partner location, the same values as Club.AquisitionLocation.
+const (
+	LocationStore   = "store"
+	LocationWebsite = "website"
+)
+
+// Windows a benefit limit is counted over.
+const (
+	WindowDay   = "day"
+	WindowWeek  = "week"
+	WindowMonth = "month"
+	WindowTotal = "total"
+)
+
+// Partner is a merchant offering benefits to club members.
+type Partner struct {
+	ID        int64             `json:"id,omitempty"`
+	Name      string            `json:"name"`
+	Locations []PartnerLocation `json:"locations"`
+}
+
+type PartnerLocation struct {
+	ID   int64  `json:"id,omitempty"`
+	Kind string `json:"kind"`
+	// Address is the street address of a store or the URL of a website.
+	Address string `json:"address"`
+}
+
+// Benefit is an offer of a partner to the members of a club.
+type Benefit struct {
+	Code        string `json:"code"`
+	Partner     string `json:"partner"`
+	Club        string `json:"club"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// MaxPerMember is how many times a member can redeem the benefit in each
+	// Window, unlimited when zero.
+	MaxPerMember int    `json:"max_per_member,omitempty"`
+	Window       string `json:"window"`
+}
+
+// BenefitRedemptionRequest is sent by a partner when a member uses a benefit.
+type BenefitRedemptionRequest struct {
+	Email   string `json:"email"`
+	Partner string `json:"partner"`
+	// LocationID is the partner location the benefit was used at, if known.
+	LocationID int64 `json:"location_id,omitempty"`
+}
+
+type BenefitRedemption struct {
+	ID         int64     `json:"id"`
+	Benefit    string    `json:"benefit"`
+	Title      string    `json:"title"`
+	Partner    string    `json:"partner"`
+	Club       string    `json:"club"`
+	LocationID int64     `json:"location_id,omitempty"`
+	RedeemedAt time.Time `json:"redeemed_at"`
+}
@@ -0,0 +1,21 @@
+package entity
+
+// Billing intervals of a plan.
+const (
+	BillingMonthly = "month"
+	BillingYearly  = "year"
+)
+
+// Plan is an entry of the plan catalogue. Clubs refer to it by Code through
+// their PlanType.
+type Plan struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// PriceCents is the price per billing interval in the minor unit of
+	// Currency.
+	PriceCents      int64    `json:"price_cents"`
+	Currency        string   `json:"currency"`
+	BillingInterval string   `json:"billing_interval"`
+	TrialDays       int      `json:"trial_days"`
+	Benefits        []string `json:"benefits"`
+}
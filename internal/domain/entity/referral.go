@@ -0,0 +1,82 @@
+package entity
+
+import "strings"
+
+// States of a referral.
+const (
+	ReferralPending  = "pending"
+	ReferralRewarded = "rewarded"
+	ReferralRejected = "rejected"
+)
+
+// Reasons a referral is rejected.
+const (
+	ReferralUnknownCode    = "unknown_code"
+	ReferralSelf           = "self_referral"
+	ReferralDuplicateEmail = "duplicate_email"
+)
+
+// Rewards a referrer can get.
+const (
+	// RewardFreeDays extends the current period of the active memberships of
+	// the referrer.
+	RewardFreeDays = "free_days"
+	// RewardCoupon creates a single-use percent coupon for the referrer.
+	RewardCoupon = "coupon"
+)
+
+// ReferralCouponPrefix starts the code of every coupon created by
+// RewardCoupon.
+const ReferralCouponPrefix = "REF-"
+
+// ReferralReward is the reward given to a referrer when a referred user's
+// first membership becomes active.
+type ReferralReward struct {
+	Type    string
+	Days    int
+	Percent int64
+}
+
+// Referral is how the referral given at user creation turned out.
+type Referral struct {
+	ReferrerID int64
+	Status     string
+	// Reason is why a rejected referral was rejected.
+	Reason string
+}
+
+// ReferralGrant is a reward given to a referrer.
+type ReferralGrant struct {
+	ReferrerEmail string
+	Type          string
+	Days          int
+	CouponCode    string
+}
+
+// ReferralSummary is the referral code of a user and how its referrals went.
+type ReferralSummary struct {
+	Code     string   `json:"referral_code"`
+	Pending  int      `json:"pending"`
+	Rewarded int      `json:"rewarded"`
+	Rejected int      `json:"rejected"`
+	Coupons  []string `json:"coupons"`
+}
+
+// NormalizeEmail lowercases email and drops the +tag of its local part, and
+// the dots too for Gmail, so that aliases of one mailbox compare equal.
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain
+}
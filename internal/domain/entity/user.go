@@ -1,7 +1,16 @@
 package entity
 
 type User struct {
-	ID    int64  `json:"id,omitempty"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID    int64  `json:"id,omitempty" proto:"1"`
+	Name  string `json:"name" proto:"2"`
+	Email string `json:"email" proto:"3"`
+	// ReferredBy is the referral code of the user who referred this one.
+	ReferredBy string `json:"referred_by,omitempty" proto:"4"`
+}
+
+// UserUpdate changes the name and/or the email of the user with Email.
+type UserUpdate struct {
+	Email    string `json:"email"`
+	Name     string `json:"name,omitempty"`
+	NewEmail string `json:"new_email,omitempty"`
 }
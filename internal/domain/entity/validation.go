@@ -3,6 +3,8 @@ package entity
 import (
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 )
 
 func (c *User) ValidateUser() error {
@@ -24,7 +26,9 @@ func (c *User) ValidateUser() error {
 	return nil
 }
 
-func (c *Club) ValidateClub() error {
+// ValidateClub checks the club, whose plan type must be one of the plan codes
+// of the catalogue.
+func (c *Club) ValidateClub(planCodes []string) error {
 	if c == nil {
 		return fmt.Errorf("Club must be provided")
 	}
@@ -45,8 +49,321 @@ func (c *Club) ValidateClub() error {
 		return fmt.Errorf("Club aquisition location must not be empty and must be either 'store' or 'website'")
 	}
 
-	if c.PlanType == "" || (c.PlanType != "basic" && c.PlanType != "premium") {
-		return fmt.Errorf("Club plan type must not be empty and must be either 'basic' or 'premium'")
+	if c.PlanType == "" || !slices.Contains(planCodes, c.PlanType) {
+		return fmt.Errorf("Club plan type must not be empty and must be one of %v", planCodes)
+	}
+
+	return nil
+}
+
+// ValidateClubMembersQuery checks the query and gives it the default limit
+// when it has none.
+func (q *ClubMembersQuery) ValidateClubMembersQuery() error {
+	if q == nil {
+		return fmt.Errorf("Club members query must be provided")
+	}
+
+	if q.Name == "" {
+		return fmt.Errorf("Club name must not be empty")
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultClubMembersLimit
+	}
+
+	if q.Limit < 0 || q.Limit > MaxClubMembersLimit {
+		return fmt.Errorf("Club members limit must be between 1 and %d", MaxClubMembersLimit)
+	}
+
+	if q.Cursor != "" {
+		if _, err := ParseMemberCursor(q.Cursor); err != nil {
+			return fmt.Errorf("Club members cursor is invalid")
+		}
+	}
+
+	return nil
+}
+
+func (u *UserUpdate) ValidateUserUpdate() error {
+	if u == nil {
+		return fmt.Errorf("User update must be provided")
+	}
+
+	if u.Email == "" {
+		return fmt.Errorf("User email must not be empty")
+	}
+
+	if u.Name == "" && u.NewEmail == "" {
+		return fmt.Errorf("User update must change the name or the email")
+	}
+
+	if u.Name != "" && len(u.Name) < 3 {
+		return fmt.Errorf("User name must be at least 3 characters long")
+	}
+
+	return nil
+}
+
+// ValidateClubUpdate checks the update, whose plan type, when set, must be
+// one of the plan codes of the catalogue.
+func (u *ClubUpdate) ValidateClubUpdate(planCodes []string) error {
+	if u == nil {
+		return fmt.Errorf("Club update must be provided")
+	}
+
+	if u.Name == "" {
+		return fmt.Errorf("Club name must not be empty")
+	}
+
+	if u.Description == "" && u.AquisitionChannel == "" && u.AquisitionLocation == "" && u.PlanType == "" {
+		return fmt.Errorf("Club update must change at least one field")
+	}
+
+	if u.AquisitionChannel != "" && u.AquisitionChannel != "online" && u.AquisitionChannel != "offline" {
+		return fmt.Errorf("Club aquisition channel must be either 'online' or 'offline'")
+	}
+
+	if u.AquisitionLocation != "" && u.AquisitionLocation != "store" && u.AquisitionLocation != "website" {
+		return fmt.Errorf("Club aquisition location must be either 'store' or 'website'")
+	}
+
+	if u.PlanType != "" && !slices.Contains(planCodes, u.PlanType) {
+		return fmt.Errorf("Club plan type must be one of %v", planCodes)
+	}
+
+	if u.PlanChangePolicy != "" && u.PlanChangePolicy != PlanChangeMigrate && u.PlanChangePolicy != PlanChangeGrandfather {
+		return fmt.Errorf("Club plan change policy must be either 'migrate' or 'grandfather'")
+	}
+
+	return nil
+}
+
+func (p *Plan) ValidatePlan() error {
+	if p == nil {
+		return fmt.Errorf("Plan must be provided")
+	}
+
+	if p.Code == "" || len(p.Code) > 50 {
+		return fmt.Errorf("Plan code must not be empty and must be at most 50 characters long")
+	}
+
+	if p.Name == "" || len(p.Name) < 3 {
+		return fmt.Errorf("Plan name must not be empty and must be at least 3 characters long")
+	}
+
+	if p.PriceCents < 0 {
+		return fmt.Errorf("Plan price must not be negative")
+	}
+
+	if len(p.Currency) != 3 || strings.ToUpper(p.Currency) != p.Currency {
+		return fmt.Errorf("Plan currency must be an uppercase ISO 4217 code, such as 'BRL'")
+	}
+
+	if p.BillingInterval != BillingMonthly && p.BillingInterval != BillingYearly {
+		return fmt.Errorf("Plan billing interval must be either 'month' or 'year'")
+	}
+
+	if p.TrialDays < 0 {
+		return fmt.Errorf("Plan trial days must not be negative")
+	}
+
+	return nil
+}
+
+// ValidateCoupon checks the coupon, whose plan type restrictions must be plan
+// codes of the catalogue.
+func (c *Coupon) ValidateCoupon(planCodes []string) error {
+	if c == nil {
+		return fmt.Errorf("Coupon must be provided")
+	}
+
+	if c.Code == "" || len(c.Code) > 50 {
+		return fmt.Errorf("Coupon code must not be empty and must be at most 50 characters long")
+	}
+
+	switch c.DiscountType {
+	case DiscountPercent:
+		if c.DiscountValue < 1 || c.DiscountValue > 100 {
+			return fmt.Errorf("Coupon percent discount must be between 1 and 100")
+		}
+		if c.Currency != "" {
+			return fmt.Errorf("Coupon currency only applies to fixed discounts")
+		}
+	case DiscountFixed:
+		if c.DiscountValue < 1 {
+			return fmt.Errorf("Coupon fixed discount must be positive")
+		}
+		if len(c.Currency) != 3 || strings.ToUpper(c.Currency) != c.Currency {
+			return fmt.Errorf("Coupon currency must be an uppercase ISO 4217 code, such as 'BRL'")
+		}
+	default:
+		return fmt.Errorf("Coupon discount type must be either 'percent' or 'fixed'")
+	}
+
+	if c.ValidFrom != nil && c.ValidUntil != nil && !c.ValidFrom.Before(*c.ValidUntil) {
+		return fmt.Errorf("Coupon valid_from must be before valid_until")
+	}
+
+	if c.MaxRedemptions < 0 || c.MaxPerUser < 0 {
+		return fmt.Errorf("Coupon redemption limits must not be negative")
+	}
+
+	for _, planType := range c.PlanTypes {
+		if !slices.Contains(planCodes, planType) {
+			return fmt.Errorf("Coupon plan types must be among %v", planCodes)
+		}
+	}
+
+	return nil
+}
+
+func (p *Partner) ValidatePartner() error {
+	if p == nil {
+		return fmt.Errorf("Partner must be provided")
+	}
+
+	if p.Name == "" || len(p.Name) < 3 {
+		return fmt.Errorf("Partner name must not be empty and must be at least 3 characters long")
+	}
+
+	if len(p.Locations) == 0 {
+		return fmt.Errorf("Partner must have at least one location")
+	}
+
+	for _, l := range p.Locations {
+		if l.Kind != LocationStore && l.Kind != LocationWebsite {
+			return fmt.Errorf("Partner location kind must be either 'store' or 'website'")
+		}
+		if l.Address == "" {
+			return fmt.Errorf("Partner location address must not be empty")
+		}
+	}
+
+	return nil
+}
+
+func (b *Benefit) ValidateBenefit() error {
+	if b == nil {
+		return fmt.Errorf("Benefit must be provided")
+	}
+
+	if b.Code == "" || len(b.Code) > 50 {
+		return fmt.Errorf("Benefit code must not be empty and must be at most 50 characters long")
+	}
+
+	if b.Partner == "" || b.Club == "" {
+		return fmt.Errorf("Benefit partner and club must not be empty")
+	}
+
+	if b.Title == "" || len(b.Title) < 3 {
+		return fmt.Errorf("Benefit title must not be empty and must be at least 3 characters long")
+	}
+
+	if b.MaxPerMember < 0 {
+		return fmt.Errorf("Benefit max_per_member must not be negative")
+	}
+
+	if !slices.Contains([]string{WindowDay, WindowWeek, WindowMonth, WindowTotal}, b.Window) {
+		return fmt.Errorf("Benefit window must be one of 'day', 'week', 'month' or 'total'")
+	}
+
+	return nil
+}
+
+func (r *BenefitRedemptionRequest) ValidateBenefitRedemption() error {
+	if r == nil {
+		return fmt.Errorf("Redemption must be provided")
+	}
+
+	if r.Email == "" || r.Partner == "" {
+		return fmt.Errorf("Redemption email and partner must not be empty")
+	}
+
+	return nil
+}
+
+// ValidateAttribution checks the attribution of a signup, whose store and
+// UTM values must be in registry, keyed by kind. A nil attribution is valid.
+func (a *Attribution) ValidateAttribution(registry map[string][]string) error {
+	if a == nil {
+		return nil
+	}
+
+	if a.Channel != "" && a.Channel != ChannelOnline && a.Channel != ChannelOffline {
+		return fmt.Errorf("Attribution channel must be either 'online' or 'offline'")
+	}
+
+	if a.Location != "" && a.Location != LocationStore && a.Location != LocationWebsite {
+		return fmt.Errorf("Attribution location must be either 'store' or 'website'")
+	}
+
+	if a.StoreID != "" && a.Location == LocationWebsite {
+		return fmt.Errorf("Attribution store_id only applies to the 'store' location")
+	}
+
+	values := map[string]string{
+		RegistryStore:       a.StoreID,
+		RegistryUTMSource:   a.UTMSource,
+		RegistryUTMMedium:   a.UTMMedium,
+		RegistryUTMCampaign: a.UTMCampaign,
+	}
+
+	for _, kind := range RegistryKinds {
+		if v := values[kind]; v != "" && !slices.Contains(registry[kind], v) {
+			return fmt.Errorf("Attribution %s '%s' is not in the attribution registry", kind, v)
+		}
+	}
+
+	if len(a.Referrer) > 255 {
+		return fmt.Errorf("Attribution referrer must be at most 255 characters long")
+	}
+
+	return nil
+}
+
+func (e *RegistryEntry) ValidateRegistryEntry() error {
+	if e == nil {
+		return fmt.Errorf("Registry entry must be provided")
+	}
+
+	if !slices.Contains(RegistryKinds, e.Kind) {
+		return fmt.Errorf("Registry kind must be one of %v", RegistryKinds)
+	}
+
+	if e.Value == "" || len(e.Value) > 100 {
+		return fmt.Errorf("Registry value must not be empty and must be at most 100 characters long")
+	}
+
+	return nil
+}
+
+// ValidateNotificationPreferences checks the preferences, whose channels must
+// be known, and fills in the default locale.
+func (p *NotificationPreferences) ValidateNotificationPreferences() error {
+	if p == nil {
+		return fmt.Errorf("Notification preferences must be provided")
+	}
+
+	if p.Email == "" {
+		return fmt.Errorf("Notification preferences email must not be empty")
+	}
+
+	if p.Locale == "" {
+		p.Locale = DefaultLocale
+	}
+
+	if !slices.Contains(Locales, p.Locale) {
+		return fmt.Errorf("Notification locale must be one of %v", Locales)
+	}
+
+	if p.Channels == nil {
+		return fmt.Errorf("Notification channels must be provided, empty to opt out")
+	}
+
+	for _, c := range p.Channels {
+		if !slices.Contains(NotificationChannels, c) {
+			return fmt.Errorf("Notification channels must be among %v", NotificationChannels)
+		}
 	}
 
 	return nil
@@ -0,0 +1,270 @@
+// Package event defines the domain events published to the events topic
+// exchange after successful state changes. The JSON encoding of each type is
+// the payload contract downstream consumers bind against; fields are only
+// ever added, never renamed or removed, without bumping Version.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Exchange is the topic exchange every domain event is published to.
+const Exchange = "capybelga.events"
+
+// Version is the schema version of the event payloads below.
+const Version = 1
+
+// Routing keys follow <aggregate>[.<entity>].<past tense verb>, so consumers
+// can bind with patterns such as "club.membership.*" or "user.#".
+const (
+	UserRegisteredKey      = "user.registered"
+	UserAuditedKey         = "user.audited"
+	ReferralRewardedKey    = "user.referral.rewarded"
+	ClubCreatedKey         = "club.created"
+	ClubUpdatedKey         = "club.updated"
+	ClubArchivedKey        = "club.archived"
+	MembershipActivatedKey = "club.membership.activated"
+	MembershipRejectedKey  = "club.membership.rejected"
+	MembershipCancelledKey = "club.membership.cancelled"
+	MembershipSuspendedKey = "club.membership.suspended"
+	MembershipResumedKey   = "club.membership.resumed"
+	MembershipRenewedKey   = "club.membership.renewed"
+	MembershipPastDueKey   = "club.membership.past_due"
+	MembershipExpiredKey   = "club.membership.expired"
+	BenefitRedeemedKey     = "club.benefit.redeemed"
+)
+
+type Event interface {
+	RoutingKey() string
+	// Subject is the key events are ordered by, usually the user email.
+	Subject() string
+}
+
+// Identified is implemented by events whose ID is derived from what caused
+// them, so an event published again for the same cause keeps its ID and
+// consumers drop it as a duplicate. Other events get a new ID each time.
+type Identified interface {
+	EventID() string
+}
+
+// Encoded is an event already encoded to its JSON payload, with the ID it is
+// published under, so publishing it again keeps that ID.
+type Encoded struct {
+	ID   string
+	Key  string
+	Subj string
+	Data json.RawMessage
+}
+
+// Encode encodes e under its own ID when it is Identified, or a new one.
+func Encode(e Event) (*Encoded, error) {
+	if enc, ok := e.(*Encoded); ok {
+		return enc, nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := &Encoded{ID: uuid.NewString(), Key: e.RoutingKey(), Subj: e.Subject(), Data: data}
+	if id, ok := e.(Identified); ok && id.EventID() != "" {
+		enc.ID = id.EventID()
+	}
+
+	return enc, nil
+}
+
+func (e *Encoded) RoutingKey() string           { return e.Key }
+func (e *Encoded) Subject() string              { return e.Subj }
+func (e *Encoded) EventID() string              { return e.ID }
+func (e *Encoded) MarshalJSON() ([]byte, error) { return e.Data, nil }
+
+// Publisher delivers events to downstream consumers.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+type UserRegistered struct {
+	Email      string    `json:"email"`
+	Name       string    `json:"name"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (UserRegistered) RoutingKey() string { return UserRegisteredKey }
+func (e UserRegistered) Subject() string  { return e.Email }
+
+// UserAudited records a change to a user account, with one of the
+// repository Audit* actions. It carries the user ID instead of the email so
+// it stays valid, and free of personal data, after an erasure.
+type UserAudited struct {
+	UserID     int64     `json:"user_id"`
+	Action     string    `json:"action"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (UserAudited) RoutingKey() string { return UserAuditedKey }
+func (e UserAudited) Subject() string  { return strconv.FormatInt(e.UserID, 10) }
+
+type ClubCreated struct {
+	Name               string    `json:"name"`
+	PlanType           string    `json:"plan_type"`
+	AquisitionChannel  string    `json:"aquisition_channel"`
+	AquisitionLocation string    `json:"aquisition_location"`
+	OccurredAt         time.Time `json:"occurred_at"`
+}
+
+func (ClubCreated) RoutingKey() string { return ClubCreatedKey }
+func (e ClubCreated) Subject() string  { return e.Name }
+
+type ClubUpdated struct {
+	Name               string `json:"name"`
+	Description        string `json:"description"`
+	PlanType           string `json:"plan_type"`
+	AquisitionChannel  string `json:"aquisition_channel"`
+	AquisitionLocation string `json:"aquisition_location"`
+	// PreviousPlanType and PlanChangePolicy are only set when the plan type
+	// changed.
+	PreviousPlanType string    `json:"previous_plan_type,omitempty"`
+	PlanChangePolicy string    `json:"plan_change_policy,omitempty"`
+	OccurredAt       time.Time `json:"occurred_at"`
+}
+
+func (ClubUpdated) RoutingKey() string { return ClubUpdatedKey }
+func (e ClubUpdated) Subject() string  { return e.Name }
+
+type ClubArchived struct {
+	Name       string    `json:"name"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (ClubArchived) RoutingKey() string { return ClubArchivedKey }
+func (e ClubArchived) Subject() string  { return e.Name }
+
+type MembershipActivated struct {
+	Email    string `json:"email"`
+	ClubName string `json:"club"`
+	// Coupon is the coupon redeemed by the signup, which takes DiscountCents,
+	// in Currency, off the first paid period.
+	Coupon        string    `json:"coupon,omitempty"`
+	DiscountCents int64     `json:"discount_cents,omitempty"`
+	Currency      string    `json:"currency,omitempty"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+func (MembershipActivated) RoutingKey() string { return MembershipActivatedKey }
+func (e MembershipActivated) Subject() string  { return e.Email }
+
+// MembershipRejected is published when a signup fails for good, with one of
+// the telemetry.SignupFailure* reasons.
+type MembershipRejected struct {
+	// ID identifies the rejected signup.
+	ID         string    `json:"-"`
+	Email      string    `json:"email"`
+	ClubName   string    `json:"club"`
+	Reason     string    `json:"reason"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (MembershipRejected) RoutingKey() string { return MembershipRejectedKey }
+func (e MembershipRejected) Subject() string  { return e.Email }
+func (e MembershipRejected) EventID() string  { return e.ID }
+
+type MembershipCancelled struct {
+	Email      string    `json:"email"`
+	ClubName   string    `json:"club"`
+	PlanType   string    `json:"plan_type"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (MembershipCancelled) RoutingKey() string { return MembershipCancelledKey }
+func (e MembershipCancelled) Subject() string  { return e.Email }
+
+// MembershipSuspended is published for each active membership of a user who
+// is deactivated. It is resumed, with MembershipResumed, when the user is
+// reactivated.
+type MembershipSuspended struct {
+	Email      string    `json:"email"`
+	ClubName   string    `json:"club"`
+	PlanType   string    `json:"plan_type"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (MembershipSuspended) RoutingKey() string { return MembershipSuspendedKey }
+func (e MembershipSuspended) Subject() string  { return e.Email }
+
+type MembershipResumed struct {
+	Email      string    `json:"email"`
+	ClubName   string    `json:"club"`
+	PlanType   string    `json:"plan_type"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (MembershipResumed) RoutingKey() string { return MembershipResumedKey }
+func (e MembershipResumed) Subject() string  { return e.Email }
+
+type MembershipRenewed struct {
+	Email       string    `json:"email"`
+	ClubName    string    `json:"club"`
+	PlanType    string    `json:"plan_type"`
+	AmountCents int64     `json:"amount_cents"`
+	Currency    string    `json:"currency"`
+	PeriodEnd   time.Time `json:"period_end"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+func (MembershipRenewed) RoutingKey() string { return MembershipRenewedKey }
+func (e MembershipRenewed) Subject() string  { return e.Email }
+
+// MembershipPastDue is published for each declined renewal. The membership
+// stays active until GraceUntil.
+type MembershipPastDue struct {
+	Email      string    `json:"email"`
+	ClubName   string    `json:"club"`
+	Attempts   int       `json:"attempts"`
+	GraceUntil time.Time `json:"grace_until"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (MembershipPastDue) RoutingKey() string { return MembershipPastDueKey }
+func (e MembershipPastDue) Subject() string  { return e.Email }
+
+type MembershipExpired struct {
+	Email      string    `json:"email"`
+	ClubName   string    `json:"club"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (MembershipExpired) RoutingKey() string { return MembershipExpiredKey }
+func (e MembershipExpired) Subject() string  { return e.Email }
+
+// BenefitRedeemed is published when a member uses a benefit at a partner.
+type BenefitRedeemed struct {
+	Email      string    `json:"email"`
+	ClubName   string    `json:"club"`
+	Partner    string    `json:"partner"`
+	Benefit    string    `json:"benefit"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (BenefitRedeemed) RoutingKey() string { return BenefitRedeemedKey }
+func (e BenefitRedeemed) Subject() string  { return e.Email }
+
+// ReferralRewarded is published when a referred user's first membership
+// becomes active and the referrer gets a reward, either Days added to their
+// memberships or the single-use CouponCode.
+type ReferralRewarded struct {
+	ReferrerEmail string    `json:"referrer_email"`
+	Reward        string    `json:"reward"`
+	Days          int       `json:"days,omitempty"`
+	CouponCode    string    `json:"coupon_code,omitempty"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+func (ReferralRewarded) RoutingKey() string { return ReferralRewardedKey }
+func (e ReferralRewarded) Subject() string  { return e.ReferrerEmail }
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrRegistryEntryNotFound = errors.New("attribution registry entry not found")
+	ErrRegistryEntryExists   = errors.New("attribution registry entry already exists")
+)
+
+// AttributionRegistry returns the values allowed in the attribution of a
+// signup.
+func (r *Repository) AttributionRegistry(ctx context.Context) ([]entity.RegistryEntry, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.AttributionRegistry",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+		),
+	)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(cctx, `SELECT kind, value FROM attribution_registry ORDER BY kind, value`)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []entity.RegistryEntry{}
+	for rows.Next() {
+		var e entity.RegistryEntry
+		if err := rows.Scan(&e.Kind, &e.Value); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// InsertRegistryEntry allows a value in the attribution of a signup. It
+// returns ErrRegistryEntryExists when the value is already allowed.
+func (r *Repository) InsertRegistryEntry(ctx context.Context, e *entity.RegistryEntry) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertRegistryEntry",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("kind", e.Kind),
+			attribute.String("value", e.Value),
+		),
+	)
+	defer span.End()
+
+	_, err := r.db.ExecContext(cctx, `INSERT INTO attribution_registry (kind, value) VALUES ($1, $2)`, e.Kind, e.Value)
+	if db.IsUniqueViolation(err) {
+		err = ErrRegistryEntryExists
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// DeleteRegistryEntry stops allowing a value in the attribution of new
+// signups; existing signups keep it. It returns ErrRegistryEntryNotFound when
+// the value wasn't allowed.
+func (r *Repository) DeleteRegistryEntry(ctx context.Context, e *entity.RegistryEntry) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.DeleteRegistryEntry",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("kind", e.Kind),
+			attribute.String("value", e.Value),
+		),
+	)
+	defer span.End()
+
+	res, err := r.db.ExecContext(cctx, `DELETE FROM attribution_registry WHERE kind = $1 AND value = $2`, e.Kind, e.Value)
+	if err == nil {
+		err = errIfNoRows(res, ErrRegistryEntryNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrMembershipNotFound = errors.New("membership not found")
+
+// ErrStaleRenewal is returned when a renewal no longer applies, because the
+// period was renewed meanwhile or the membership is no longer active.
+var ErrStaleRenewal = errors.New("renewal no longer applies")
+
+// periodInterval is the length of a billing period of plan p.
+const periodInterval = `CASE p.billing_interval WHEN 'year' THEN INTERVAL '1 year' ELSE INTERVAL '1 month' END`
+
+// ClaimDueRenewals marks up to limit active memberships whose period ended as
+// requested and returns a renewal command for each. A membership is claimed
+// again once retryAfter passed without its renewal succeeding, which covers
+// both lost commands and retries during the grace period. Concurrent callers
+// never claim the same membership.
+func (r *Repository) ClaimDueRenewals(ctx context.Context, retryAfter time.Duration, limit int) ([]entity.RenewalCommand, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ClaimDueRenewals",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int("limit", limit),
+		),
+	)
+	defer span.End()
+
+	query := `
+		UPDATE user_club
+		SET renewal_requested_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id
+			FROM user_club
+			WHERE active AND billing_status IN ($1, $2)
+				AND current_period_end <= CURRENT_TIMESTAMP
+				AND (renewal_requested_at IS NULL OR renewal_requested_at <= CURRENT_TIMESTAMP - make_interval(secs => $3))
+			ORDER BY current_period_end
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, current_period_end, renewal_attempts
+	`
+
+	rows, err := r.db.QueryContext(cctx, query, entity.BillingCurrent, entity.BillingGrace, retryAfter.Seconds(), limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []entity.RenewalCommand
+	for rows.Next() {
+		var c entity.RenewalCommand
+		if err := rows.Scan(&c.MembershipID, &c.PeriodEnd, &c.Attempt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("claimed", len(commands)))
+
+	return commands, nil
+}
+
+// Subscription returns the billing view of a membership, with the plan the
+// member is on and the coupon discount it has yet to get.
+func (r *Repository) Subscription(ctx context.Context, membershipID int64) (*entity.Subscription, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.Subscription",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int64("membership_id", membershipID),
+		),
+	)
+	defer span.End()
+
+	query := `
+		SELECT uc.id, u.email, c.id, c.name, COALESCE(c.aquisition_channel, ''), COALESCE(c.aquisition_location, ''),
+			p.code, p.name, p.price_cents, p.currency, p.billing_interval, p.trial_days, p.benefits,
+			uc.active, uc.billing_status, COALESCE(uc.joined_at, uc.created_at),
+			COALESCE(uc.current_period_end, 'epoch'), COALESCE(uc.grace_until, 'epoch'), uc.renewal_attempts,
+			COALESCE(cr.discount_cents, 0)
+		FROM user_club uc
+		JOIN users u ON u.id = uc.user_id
+		JOIN clubs c ON c.id = uc.club_id
+		JOIN plans p ON p.code = COALESCE(uc.plan_type, c.plan_type)
+		LEFT JOIN coupon_redemptions cr ON cr.user_club_id = uc.id AND cr.applied_at IS NULL
+		WHERE uc.id = $1
+	`
+
+	s := new(entity.Subscription)
+	err := r.db.QueryRowContext(cctx, query, membershipID).Scan(
+		&s.MembershipID, &s.Email, &s.Club.ID, &s.Club.Name, &s.Club.AquisitionChannel, &s.Club.AquisitionLocation,
+		&s.Plan.Code, &s.Plan.Name, &s.Plan.PriceCents, &s.Plan.Currency, &s.Plan.BillingInterval, &s.Plan.TrialDays, pq.Array(&s.Plan.Benefits),
+		&s.Active, &s.BillingStatus, &s.JoinedAt, &s.PeriodEnd, &s.GraceUntil, &s.Attempts,
+		&s.DiscountCents,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrMembershipNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	s.Club.PlanType = s.Plan.Code
+
+	return s, nil
+}
+
+// CompleteRenewal starts the next period of a membership whose period ending
+// at periodEnd was paid and returns when the new period ends. A membership
+// renewed after its period ended, such as one reactivated after a suspension,
+// starts the new period now instead of paying for the time it was off. A
+// pending coupon discount is marked as applied. It returns ErrStaleRenewal
+// when the period was already renewed.
+func (r *Repository) CompleteRenewal(ctx context.Context, membershipID int64, periodEnd time.Time) (time.Time, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.CompleteRenewal",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int64("membership_id", membershipID),
+		),
+	)
+	defer span.End()
+
+	query := `
+		WITH renewed AS (
+			UPDATE user_club uc
+			SET current_period_end = GREATEST(uc.current_period_end, CURRENT_TIMESTAMP) + ` + periodInterval + `,
+				billing_status = $3, grace_until = NULL, renewal_attempts = 0, renewal_requested_at = NULL
+			FROM clubs c, plans p
+			WHERE uc.id = $1 AND uc.current_period_end = $2 AND uc.active
+				AND c.id = uc.club_id AND p.code = COALESCE(uc.plan_type, c.plan_type)
+			RETURNING uc.id, uc.current_period_end
+		), applied AS (
+			UPDATE coupon_redemptions
+			SET applied_at = CURRENT_TIMESTAMP
+			WHERE user_club_id IN (SELECT id FROM renewed) AND applied_at IS NULL
+		)
+		SELECT current_period_end FROM renewed
+	`
+
+	var next time.Time
+	err := r.db.QueryRowContext(cctx, query, membershipID, periodEnd, entity.BillingCurrent).Scan(&next)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrStaleRenewal
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return time.Time{}, err
+	}
+
+	return next, nil
+}
+
+// FailRenewal records a declined renewal of the period ending at periodEnd.
+// The first failure moves the membership to the grace period, which lasts
+// grace; later ones keep the grace period it got. It returns when the grace
+// period ends and the number of failed attempts, or ErrStaleRenewal when the
+// period was renewed meanwhile.
+func (r *Repository) FailRenewal(ctx context.Context, membershipID int64, periodEnd time.Time, grace time.Duration) (graceUntil time.Time, attempts int, err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.FailRenewal",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int64("membership_id", membershipID),
+		),
+	)
+	defer span.End()
+
+	query := `
+		UPDATE user_club
+		SET billing_status = $3,
+			grace_until = COALESCE(grace_until, CURRENT_TIMESTAMP + make_interval(secs => $4)),
+			renewal_attempts = renewal_attempts + 1
+		WHERE id = $1 AND current_period_end = $2 AND active
+		RETURNING grace_until, renewal_attempts
+	`
+
+	err = r.db.QueryRowContext(cctx, query, membershipID, periodEnd, entity.BillingGrace, grace.Seconds()).Scan(&graceUntil, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrStaleRenewal
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return time.Time{}, 0, err
+	}
+
+	return graceUntil, attempts, nil
+}
+
+// ExpireMemberships ends up to limit memberships whose grace period ran out
+// and returns them.
+func (r *Repository) ExpireMemberships(ctx context.Context, limit int) ([]entity.Subscription, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ExpireMemberships",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int("limit", limit),
+		),
+	)
+	defer span.End()
+
+	query := `
+		UPDATE user_club uc
+		SET active = false, billing_status = $2, renewal_requested_at = NULL
+		FROM users u, clubs c
+		WHERE uc.id IN (
+				SELECT id
+				FROM user_club
+				WHERE active AND billing_status = $1 AND grace_until <= CURRENT_TIMESTAMP
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			AND u.id = uc.user_id AND c.id = uc.club_id
+		RETURNING uc.id, u.email, c.id, c.name, COALESCE(uc.plan_type, c.plan_type, ''),
+			COALESCE(c.aquisition_channel, ''), COALESCE(c.aquisition_location, ''),
+			COALESCE(uc.joined_at, uc.created_at), uc.renewal_attempts
+	`
+
+	rows, err := r.db.QueryContext(cctx, query, entity.BillingGrace, entity.BillingExpired, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []entity.Subscription
+	for rows.Next() {
+		s := entity.Subscription{BillingStatus: entity.BillingExpired}
+		if err := rows.Scan(&s.MembershipID, &s.Email, &s.Club.ID, &s.Club.Name, &s.Club.PlanType,
+			&s.Club.AquisitionChannel, &s.Club.AquisitionLocation, &s.JoinedAt, &s.Attempts); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		s.Plan.Code = s.Club.PlanType
+		expired = append(expired, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("expired", len(expired)))
+
+	return expired, nil
+}
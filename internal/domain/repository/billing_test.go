@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+var periodEnd = time.Date(2025, 2, 10, 9, 0, 0, 0, time.UTC)
+
+func TestClaimDueRenewals(t *testing.T) {
+	r, mock := mockRepository(t)
+
+	mock.ExpectQuery(`UPDATE user_club\s+SET renewal_requested_at = CURRENT_TIMESTAMP\s+WHERE id IN \(.*FOR UPDATE SKIP LOCKED`).
+		WithArgs(entity.BillingCurrent, entity.BillingGrace, float64(86400), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "current_period_end", "renewal_attempts"}).
+			AddRow(11, periodEnd, 0).
+			AddRow(12, periodEnd, 2))
+
+	commands, err := r.ClaimDueRenewals(context.Background(), 24*time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []entity.RenewalCommand{
+		{MembershipID: 11, PeriodEnd: periodEnd, Attempt: 0},
+		{MembershipID: 12, PeriodEnd: periodEnd, Attempt: 2},
+	}
+	if len(commands) != len(want) {
+		t.Fatalf("claimed %d renewals, want %d", len(commands), len(want))
+	}
+	for i := range want {
+		if commands[i] != want[i] {
+			t.Errorf("command %d = %+v, want %+v", i, commands[i], want[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRenewalTransitions(t *testing.T) {
+	graceUntil := periodEnd.Add(72 * time.Hour)
+	nextPeriodEnd := periodEnd.AddDate(0, 1, 0)
+
+	t.Run("renewed", func(t *testing.T) {
+		r, mock := mockRepository(t)
+		mock.ExpectQuery(`UPDATE user_club uc\s+SET current_period_end = GREATEST`).
+			WithArgs(int64(11), periodEnd, entity.BillingCurrent).
+			WillReturnRows(sqlmock.NewRows([]string{"current_period_end"}).AddRow(nextPeriodEnd))
+
+		next, err := r.CompleteRenewal(context.Background(), 11, periodEnd)
+		if err != nil || !next.Equal(nextPeriodEnd) {
+			t.Errorf("CompleteRenewal() = %v, %v, want %v", next, err, nextPeriodEnd)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("renewed twice", func(t *testing.T) {
+		r, mock := mockRepository(t)
+		mock.ExpectQuery(`UPDATE user_club uc\s+SET current_period_end = GREATEST`).
+			WillReturnRows(sqlmock.NewRows([]string{"current_period_end"}))
+
+		if _, err := r.CompleteRenewal(context.Background(), 11, periodEnd); !errors.Is(err, ErrStaleRenewal) {
+			t.Errorf("CompleteRenewal() error = %v, want %v", err, ErrStaleRenewal)
+		}
+	})
+
+	t.Run("declined moves to grace", func(t *testing.T) {
+		r, mock := mockRepository(t)
+		mock.ExpectQuery(`UPDATE user_club\s+SET billing_status = \$3,\s+grace_until = COALESCE\(grace_until`).
+			WithArgs(int64(11), periodEnd, entity.BillingGrace, float64(72*3600)).
+			WillReturnRows(sqlmock.NewRows([]string{"grace_until", "renewal_attempts"}).AddRow(graceUntil, 1))
+
+		until, attempts, err := r.FailRenewal(context.Background(), 11, periodEnd, 72*time.Hour)
+		if err != nil || !until.Equal(graceUntil) || attempts != 1 {
+			t.Errorf("FailRenewal() = %v, %d, %v, want %v, 1", until, attempts, err, graceUntil)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("declined after renewal", func(t *testing.T) {
+		r, mock := mockRepository(t)
+		mock.ExpectQuery(`UPDATE user_club\s+SET billing_status = \$3`).
+			WillReturnRows(sqlmock.NewRows([]string{"grace_until", "renewal_attempts"}))
+
+		if _, _, err := r.FailRenewal(context.Background(), 11, periodEnd, 72*time.Hour); !errors.Is(err, ErrStaleRenewal) {
+			t.Errorf("FailRenewal() error = %v, want %v", err, ErrStaleRenewal)
+		}
+	})
+
+	t.Run("grace runs out", func(t *testing.T) {
+		r, mock := mockRepository(t)
+		mock.ExpectQuery(`UPDATE user_club uc\s+SET active = false, billing_status = \$2.*grace_until <= CURRENT_TIMESTAMP`).
+			WithArgs(entity.BillingGrace, entity.BillingExpired, 100).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "club_id", "club", "plan_type", "channel", "location", "joined_at", "attempts"}).
+				AddRow(11, "capy@email.com", 3, "Clube Capy", "premium", "online", "store", registeredAt, 3))
+
+		expired, err := r.ExpireMemberships(context.Background(), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expired) != 1 || expired[0].BillingStatus != entity.BillingExpired || expired[0].Plan.Code != "premium" ||
+			expired[0].Attempts != 3 {
+			t.Errorf("ExpireMemberships() = %+v, want membership 11 expired after 3 attempts", expired)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestSignupStartsTheTrial(t *testing.T) {
+	r, mock := mockRepository(t)
+
+	mock.ExpectBegin()
+	expectUser(mock, true)
+	expectClub(mock, false)
+	// The period ends after the trial days of the plan, so a plan without a
+	// trial is due right away and charged at the next billing run.
+	mock.ExpectQuery(`INSERT INTO user_club \(user_id, club_id, current_period_end,.*\s+VALUES \(\$1, \$2, CURRENT_TIMESTAMP \+ \(\s+SELECT make_interval\(days => p.trial_days\)\s+FROM plans p\s+WHERE p.code = \$3`).
+		WithArgs(int64(7), int64(3), "premium", "online", "store", "", "", "", "", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "joined_at", "first"}).AddRow(11, registeredAt, false))
+	mock.ExpectCommit()
+
+	if _, err := r.SignupUserClub(context.Background(), &entity.SignupPayload{Email: "capy@email.com", ClubName: "Clube Capy"},
+		entity.ReferralReward{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
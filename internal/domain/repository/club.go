@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UpdateClub changes the fields of a club that are set in update. When the
+// plan type changes, current members move to the new plan with
+// PlanChangeMigrate and keep their plan with PlanChangeGrandfather. Cancelled
+// memberships always keep the plan they had. The plan type the club had
+// before is returned too. It returns ErrClubNotFound or ErrClubArchived when
+// the club can't be updated.
+func (r *Repository) UpdateClub(ctx context.Context, update *entity.ClubUpdate, policy string) (club *entity.Club, previousPlanType string, err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.UpdateClub",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("name", update.Name),
+		),
+	)
+	defer span.End()
+
+	club = new(entity.Club)
+
+	err = r.db.WithTx(cctx, "update_club", func(ctx context.Context, tx *db.Tx) error {
+		query := `
+			SELECT id, COALESCE(plan_type, ''), archived_at IS NOT NULL
+			FROM clubs
+			WHERE name = $1
+			FOR UPDATE
+		`
+
+		var clubID int64
+		var archived bool
+		err := tx.QueryRowContext(ctx, query, update.Name).Scan(&clubID, &previousPlanType, &archived)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrClubNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if archived {
+			return ErrClubArchived
+		}
+
+		if update.PlanType != "" && update.PlanType != previousPlanType {
+			if err := changeMembersPlan(ctx, tx, clubID, previousPlanType, policy); err != nil {
+				return err
+			}
+			span.SetAttributes(
+				attribute.String("plan_change_policy", policy),
+				attribute.String("previous_plan_type", previousPlanType),
+			)
+		}
+
+		query = `
+			UPDATE clubs
+			SET description = COALESCE(NULLIF($2, ''), description),
+				aquisition_channel = COALESCE(NULLIF($3, ''), aquisition_channel),
+				aquisition_location = COALESCE(NULLIF($4, ''), aquisition_location),
+				plan_type = COALESCE(NULLIF($5, ''), plan_type)
+			WHERE id = $1
+			RETURNING id, name, COALESCE(description, ''), COALESCE(aquisition_channel, ''),
+				COALESCE(aquisition_location, ''), COALESCE(plan_type, '')
+		`
+
+		return tx.QueryRowContext(ctx, query, clubID, update.Description, update.AquisitionChannel, update.AquisitionLocation, update.PlanType).
+			Scan(&club.ID, &club.Name, &club.Description, &club.AquisitionChannel, &club.AquisitionLocation, &club.PlanType)
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, "", err
+	}
+
+	return club, previousPlanType, nil
+}
+
+// changeMembersPlan applies policy to the memberships of a club whose plan
+// type is about to change from previous. Memberships with a NULL plan_type
+// follow the club, so they are the ones that change with it.
+func changeMembersPlan(ctx context.Context, q db.Querier, clubID int64, previous, policy string) error {
+	query := `
+		UPDATE user_club
+		SET plan_type = $2
+		WHERE club_id = $1 AND plan_type IS NULL AND NOT (active OR suspended)
+	`
+
+	if _, err := q.ExecContext(ctx, query, clubID, previous); err != nil {
+		return err
+	}
+
+	switch policy {
+	case entity.PlanChangeGrandfather:
+		query = `
+			UPDATE user_club
+			SET plan_type = $2
+			WHERE club_id = $1 AND plan_type IS NULL AND (active OR suspended)
+		`
+		_, err := q.ExecContext(ctx, query, clubID, previous)
+		return err
+	default:
+		query = `
+			UPDATE user_club
+			SET plan_type = NULL
+			WHERE club_id = $1 AND plan_type IS NOT NULL AND (active OR suspended)
+		`
+		_, err := q.ExecContext(ctx, query, clubID)
+		return err
+	}
+}
+
+// ArchiveClub archives a club so it takes no new signups. Its memberships are
+// kept. Archiving an archived club changes nothing.
+func (r *Repository) ArchiveClub(ctx context.Context, name string) (*entity.Club, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ArchiveClub",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("name", name),
+		),
+	)
+	defer span.End()
+
+	query := `
+		UPDATE clubs
+		SET archived_at = COALESCE(archived_at, CURRENT_TIMESTAMP)
+		WHERE name = $1
+		RETURNING id, name, COALESCE(description, ''), COALESCE(aquisition_channel, ''),
+			COALESCE(aquisition_location, ''), COALESCE(plan_type, '')
+	`
+
+	club := new(entity.Club)
+	err := r.db.QueryRowContext(cctx, query, name).
+		Scan(&club.ID, &club.Name, &club.Description, &club.AquisitionChannel, &club.AquisitionLocation, &club.PlanType)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrClubNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return club, nil
+}
+
+// memberState is the state of the membership uc, with the states and billing
+// statuses it is built from as $2 to $8, in the order of memberStateArgs.
+const memberState = `
+	CASE
+		WHEN uc.active AND uc.billing_status = $5 THEN $6
+		WHEN uc.active THEN $2
+		WHEN uc.suspended THEN $3
+		WHEN uc.billing_status = $7 THEN $8
+		ELSE $4
+	END`
+
+var memberStateArgs = []any{entity.MemberActive, entity.MemberSuspended, entity.MemberCancelled,
+	entity.BillingGrace, entity.MemberGrace, entity.BillingExpired, entity.MemberExpired}
+
+// ClubMembers returns up to limit memberships of a club, the most recent
+// first, starting after the cursor when there is one. It also returns the
+// cursor of the next page, nil on the last one.
+func (r *Repository) ClubMembers(ctx context.Context, clubID int64, limit int, after *entity.MemberCursor) ([]entity.ClubMember, *entity.MemberCursor, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ClubMembers",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int64("club_id", clubID),
+			attribute.Int("limit", limit),
+			attribute.Bool("cursor", after != nil),
+		),
+	)
+	defer span.End()
+
+	query := `
+		SELECT uc.id, u.email, u.name, ` + memberState + `,
+			COALESCE(uc.plan_type, c.plan_type, ''), COALESCE(uc.joined_at, uc.created_at)
+		FROM user_club uc
+		JOIN users u ON u.id = uc.user_id
+		JOIN clubs c ON c.id = uc.club_id
+		WHERE uc.club_id = $1
+			AND ($9::timestamp IS NULL OR (COALESCE(uc.joined_at, uc.created_at), uc.id) < ($9::timestamp, $10))
+		ORDER BY COALESCE(uc.joined_at, uc.created_at) DESC, uc.id DESC
+		LIMIT $11
+	`
+
+	var afterJoined *time.Time
+	var afterID int64
+	if after != nil {
+		afterJoined, afterID = &after.JoinedAt, after.ID
+	}
+
+	// One more row than asked tells whether there is a next page.
+	args := append([]any{clubID}, memberStateArgs...)
+	args = append(args, afterJoined, afterID, limit+1)
+
+	rows, err := r.db.QueryContext(cctx, query, args...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var members []entity.ClubMember
+	for rows.Next() {
+		var m entity.ClubMember
+		if err := rows.Scan(&m.ID, &m.Email, &m.Name, &m.State, &m.PlanType, &m.JoinedAt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, nil, err
+		}
+		members = append(members, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+
+	var next *entity.MemberCursor
+	if len(members) > limit {
+		members = members[:limit]
+		last := members[limit-1]
+		next = &entity.MemberCursor{JoinedAt: last.JoinedAt, ID: last.ID}
+	}
+
+	span.SetAttributes(attribute.Int("members", len(members)))
+
+	return members, next, nil
+}
+
+// ClubMemberCounts returns the number of memberships of a club per state.
+// States without memberships are left out.
+func (r *Repository) ClubMemberCounts(ctx context.Context, clubID int64) (map[string]int, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ClubMemberCounts",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int64("club_id", clubID),
+		),
+	)
+	defer span.End()
+
+	query := `
+		SELECT ` + memberState + `, COUNT(*)
+		FROM user_club uc
+		WHERE uc.club_id = $1
+		GROUP BY 1
+	`
+
+	rows, err := r.db.QueryContext(cctx, query, append([]any{clubID}, memberStateArgs...)...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		counts[state] = n
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+func TestClubMembers(t *testing.T) {
+	columns := []string{"id", "email", "name", "state", "plan_type", "joined_at"}
+	joined := registeredAt.Add(time.Hour)
+	cursor := &entity.MemberCursor{JoinedAt: joined, ID: 12}
+
+	tests := []struct {
+		name      string
+		after     *entity.MemberCursor
+		rows      int
+		wantCount int
+		wantNext  *entity.MemberCursor
+	}{
+		{name: "first page with more to come", rows: 3, wantCount: 2, wantNext: &entity.MemberCursor{JoinedAt: joined, ID: 11}},
+		{name: "last page", after: cursor, rows: 1, wantCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mock := mockRepository(t)
+
+			var afterJoined driver.Value
+			afterID := int64(0)
+			if tt.after != nil {
+				afterJoined, afterID = tt.after.JoinedAt, tt.after.ID
+			}
+
+			rows := sqlmock.NewRows(columns)
+			for i := range tt.rows {
+				rows.AddRow(int64(12-i), "capy@email.com", "Capy", entity.MemberActive, "premium", joined)
+			}
+
+			mock.ExpectQuery(`ORDER BY COALESCE\(uc.joined_at, uc.created_at\) DESC, uc.id DESC\s+LIMIT \$11`).
+				WithArgs(int64(3), entity.MemberActive, entity.MemberSuspended, entity.MemberCancelled, entity.BillingGrace,
+					entity.MemberGrace, entity.BillingExpired, entity.MemberExpired, afterJoined, afterID, 3).
+				WillReturnRows(rows)
+
+			members, next, err := r.ClubMembers(context.Background(), 3, 2, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(members) != tt.wantCount {
+				t.Errorf("got %d members, want %d", len(members), tt.wantCount)
+			}
+			switch {
+			case tt.wantNext == nil && next != nil:
+				t.Errorf("next cursor = %+v on the last page", next)
+			case tt.wantNext != nil && (next == nil || *next != *tt.wantNext):
+				t.Errorf("next cursor = %+v, want %+v", next, tt.wantNext)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestClubMemberCounts(t *testing.T) {
+	r, mock := mockRepository(t)
+
+	mock.ExpectQuery(`SELECT\s+CASE .* END, COUNT\(\*\)\s+FROM user_club uc\s+WHERE uc.club_id = \$1\s+GROUP BY 1`).
+		WithArgs(int64(3), entity.MemberActive, entity.MemberSuspended, entity.MemberCancelled, entity.BillingGrace,
+			entity.MemberGrace, entity.BillingExpired, entity.MemberExpired).
+		WillReturnRows(sqlmock.NewRows([]string{"state", "count"}).
+			AddRow(entity.MemberActive, 1200).
+			AddRow(entity.MemberCancelled, 30))
+
+	counts, err := r.ClubMemberCounts(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[entity.MemberActive] != 1200 || counts[entity.MemberCancelled] != 30 {
+		t.Errorf("counts = %v, want 1200 active and 30 cancelled", counts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemberCursor(t *testing.T) {
+	c := entity.MemberCursor{JoinedAt: time.Date(2025, 3, 1, 12, 0, 0, 123456000, time.UTC), ID: 42}
+
+	got, err := entity.ParseMemberCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.JoinedAt.Equal(c.JoinedAt) || got.ID != c.ID {
+		t.Errorf("ParseMemberCursor(%q) = %+v, want %+v", c.String(), got, c)
+	}
+
+	for _, bad := range []string{"not base64!", "MTIz", ""} {
+		if _, err := entity.ParseMemberCursor(bad); err == nil {
+			t.Errorf("ParseMemberCursor(%q) accepted a bad cursor", bad)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrCouponExists = errors.New("coupon already exists")
+
+// ErrInvalidCoupon is wrapped by every reason a coupon can't be redeemed.
+var ErrInvalidCoupon = errors.New("invalid coupon")
+
+var (
+	ErrCouponNotFound      = fmt.Errorf("%w: not found", ErrInvalidCoupon)
+	ErrCouponExpired       = fmt.Errorf("%w: outside its validity window", ErrInvalidCoupon)
+	ErrCouponExhausted     = fmt.Errorf("%w: no redemptions left", ErrInvalidCoupon)
+	ErrCouponUsedUp        = fmt.Errorf("%w: no redemptions left for the user", ErrInvalidCoupon)
+	ErrCouponNotApplicable = fmt.Errorf("%w: not applicable to the club", ErrInvalidCoupon)
+	ErrCouponNotOwned      = fmt.Errorf("%w: belongs to another user", ErrInvalidCoupon)
+)
+
+const couponColumns = `code, discount_type, discount_value, COALESCE(currency, ''), valid_from, valid_until,
+	COALESCE(max_redemptions, 0), COALESCE(max_per_user, 0), clubs, plan_types, redemptions`
+
+func scanCoupon(row interface{ Scan(...any) error }, c *entity.Coupon) error {
+	var validFrom, validUntil sql.NullTime
+	err := row.Scan(&c.Code, &c.DiscountType, &c.DiscountValue, &c.Currency, &validFrom, &validUntil,
+		&c.MaxRedemptions, &c.MaxPerUser, pq.Array(&c.Clubs), pq.Array(&c.PlanTypes), &c.Redemptions)
+	if err != nil {
+		return err
+	}
+	if validFrom.Valid {
+		c.ValidFrom = &validFrom.Time
+	}
+	if validUntil.Valid {
+		c.ValidUntil = &validUntil.Time
+	}
+	return nil
+}
+
+func (r *Repository) ListCoupons(ctx context.Context) ([]entity.Coupon, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ListCoupons",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+		),
+	)
+	defer span.End()
+
+	query := `SELECT ` + couponColumns + ` FROM coupons ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(cctx, query)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := []entity.Coupon{}
+	for rows.Next() {
+		var c entity.Coupon
+		if err := scanCoupon(rows, &c); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		coupons = append(coupons, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return coupons, nil
+}
+
+func (r *Repository) GetCoupon(ctx context.Context, code string) (*entity.Coupon, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.GetCoupon",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("coupon_code", code),
+		),
+	)
+	defer span.End()
+
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE code = $1`
+
+	c := new(entity.Coupon)
+	err := scanCoupon(r.db.QueryRowContext(cctx, query, code), c)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrCouponNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// InsertCoupon adds a coupon. It returns ErrCouponExists when the code is
+// taken.
+func (r *Repository) InsertCoupon(ctx context.Context, c *entity.Coupon) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertCoupon",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("coupon_code", c.Code),
+		),
+	)
+	defer span.End()
+
+	query := `
+		INSERT INTO coupons (code, discount_type, discount_value, currency, valid_from, valid_until,
+			max_redemptions, max_per_user, clubs, plan_types)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, 0), NULLIF($8, 0), $9, $10)
+	`
+
+	_, err := r.db.ExecContext(cctx, query, c.Code, c.DiscountType, c.DiscountValue, c.Currency, c.ValidFrom, c.ValidUntil,
+		c.MaxRedemptions, c.MaxPerUser, pq.Array(nonNil(c.Clubs)), pq.Array(nonNil(c.PlanTypes)))
+	if db.IsUniqueViolation(err) {
+		err = ErrCouponExists
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// redeemCoupon redeems the coupon with code for the membership of userID in
+// club, which must be on a plan the coupon applies to. A coupon with an owner
+// can only be redeemed by its owner. The coupon is locked
+// until the transaction of q ends, so its limits hold under concurrent
+// signups. The discount is worked out against the current plan price.
+func redeemCoupon(ctx context.Context, q db.Querier, code string, userID, membershipID int64, club entity.Club) (*entity.CouponRedemption, error) {
+	query := `
+		SELECT c.id, c.discount_type, c.discount_value, COALESCE(c.currency, ''),
+			(c.valid_from IS NULL OR c.valid_from <= CURRENT_TIMESTAMP) AND (c.valid_until IS NULL OR c.valid_until > CURRENT_TIMESTAMP),
+			c.max_redemptions IS NULL OR c.redemptions < c.max_redemptions,
+			c.max_per_user IS NULL OR c.max_per_user > (
+				SELECT COUNT(*) FROM coupon_redemptions cr WHERE cr.coupon_id = c.id AND cr.user_id = $2
+			),
+			(cardinality(c.clubs) = 0 OR $3 = ANY(c.clubs)) AND (cardinality(c.plan_types) = 0 OR $4 = ANY(c.plan_types)),
+			c.owner_id IS NULL OR c.owner_id = $2
+		FROM coupons c
+		WHERE c.code = $1
+		FOR UPDATE
+	`
+
+	var couponID int64
+	var discountType, currency string
+	var value int64
+	var valid, available, availableToUser, applicable, owned bool
+	err := q.QueryRowContext(ctx, query, code, userID, club.Name, club.PlanType).
+		Scan(&couponID, &discountType, &value, &currency, &valid, &available, &availableToUser, &applicable, &owned)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !owned:
+		return nil, ErrCouponNotOwned
+	case !valid:
+		return nil, ErrCouponExpired
+	case !available:
+		return nil, ErrCouponExhausted
+	case !availableToUser:
+		return nil, ErrCouponUsedUp
+	case !applicable:
+		return nil, ErrCouponNotApplicable
+	}
+
+	var price int64
+	var planCurrency string
+	err = q.QueryRowContext(ctx, `SELECT price_cents, currency FROM plans WHERE code = $1`, club.PlanType).Scan(&price, &planCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	redemption := &entity.CouponRedemption{Code: code, Currency: planCurrency}
+	switch discountType {
+	case entity.DiscountPercent:
+		redemption.DiscountCents = price * value / 100
+	default:
+		if currency != planCurrency {
+			return nil, ErrCouponNotApplicable
+		}
+		redemption.DiscountCents = min(value, price)
+	}
+
+	if _, err := q.ExecContext(ctx, `UPDATE coupons SET redemptions = redemptions + 1 WHERE id = $1`, couponID); err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO coupon_redemptions (coupon_id, user_id, user_club_id, discount_cents, currency)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err = q.ExecContext(ctx, query, couponID, userID, membershipID, redemption.DiscountCents, redemption.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return redemption, nil
+}
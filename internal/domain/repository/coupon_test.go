@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+func TestRedeemCoupon(t *testing.T) {
+	club := entity.Club{ID: 3, Name: "Clube Capy", PlanType: "premium"}
+
+	// coupon is a redeemable coupon as redeemCoupon reads it; each case
+	// changes the part it is about.
+	type coupon struct {
+		discountType                                         string
+		value                                                int64
+		currency                                             string
+		valid, available, availableToUser, applicable, owned bool
+	}
+	redeemable := coupon{entity.DiscountPercent, 10, "", true, true, true, true, true}
+
+	tests := []struct {
+		name         string
+		coupon       func(c *coupon)
+		planCurrency string
+		wantErr      error
+		wantCents    int64
+	}{
+		{name: "percent discount", wantCents: 299},
+		{
+			name:      "fixed discount is capped at the price",
+			coupon:    func(c *coupon) { c.discountType, c.value, c.currency = entity.DiscountFixed, 5000, "BRL" },
+			wantCents: 2990,
+		},
+		{name: "outside its validity window", coupon: func(c *coupon) { c.valid = false }, wantErr: ErrCouponExpired},
+		{name: "max_redemptions reached", coupon: func(c *coupon) { c.available = false }, wantErr: ErrCouponExhausted},
+		{name: "max_per_user reached", coupon: func(c *coupon) { c.availableToUser = false }, wantErr: ErrCouponUsedUp},
+		{name: "restricted to other clubs or plans", coupon: func(c *coupon) { c.applicable = false }, wantErr: ErrCouponNotApplicable},
+		{name: "owned by another user", coupon: func(c *coupon) { c.owned = false }, wantErr: ErrCouponNotOwned},
+		{
+			name:         "fixed discount in another currency",
+			coupon:       func(c *coupon) { c.discountType, c.value, c.currency = entity.DiscountFixed, 500, "USD" },
+			planCurrency: "BRL",
+			wantErr:      ErrCouponNotApplicable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mock := mockRepository(t)
+
+			c := redeemable
+			if tt.coupon != nil {
+				tt.coupon(&c)
+			}
+
+			mock.ExpectQuery(`FROM coupons c\s+WHERE c.code = \$1\s+FOR UPDATE`).
+				WithArgs("BEMVINDO", int64(7), "Clube Capy", "premium").
+				WillReturnRows(sqlmock.NewRows(redeemColumns).
+					AddRow(5, c.discountType, c.value, c.currency, c.valid, c.available, c.availableToUser, c.applicable, c.owned))
+
+			// Rejections on the coupon itself are found before the plan is
+			// read.
+			if tt.wantErr == nil || tt.planCurrency != "" {
+				mock.ExpectQuery(`SELECT price_cents, currency FROM plans`).
+					WithArgs("premium").
+					WillReturnRows(sqlmock.NewRows([]string{"price_cents", "currency"}).AddRow(2990, "BRL"))
+			}
+			if tt.wantErr == nil {
+				mock.ExpectExec(`UPDATE coupons SET redemptions = redemptions \+ 1`).
+					WithArgs(int64(5)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO coupon_redemptions`).
+					WithArgs(int64(5), int64(7), int64(11), tt.wantCents, "BRL").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			redemption, err := redeemCoupon(context.Background(), r.db, "BEMVINDO", 7, 11, club)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrInvalidCoupon) {
+					t.Errorf("redeemCoupon() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("redeemCoupon() error = %v", err)
+			} else if redemption.DiscountCents != tt.wantCents {
+				t.Errorf("DiscountCents = %d, want %d", redemption.DiscountCents, tt.wantCents)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRedeemUnknownCoupon(t *testing.T) {
+	r, mock := mockRepository(t)
+
+	mock.ExpectQuery(`FROM coupons c\s+WHERE c.code = \$1`).WillReturnRows(sqlmock.NewRows(redeemColumns))
+
+	_, err := redeemCoupon(context.Background(), r.db, "NOPE", 7, 11, entity.Club{Name: "Clube Capy", PlanType: "premium"})
+	if !errors.Is(err, ErrCouponNotFound) {
+		t.Errorf("redeemCoupon() error = %v, want %v", err, ErrCouponNotFound)
+	}
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNotificationDone is returned when claiming a notification that was
+// already sent, or given up on, on the channel.
+var ErrNotificationDone = errors.New("notification already handled")
+
+// NotificationRecipient returns the user with email, with the preferences
+// they set, if any. Erased users are not found.
+func (r *Repository) NotificationRecipient(ctx context.Context, email string) (*entity.NotificationRecipient, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.NotificationRecipient",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	query := `
+		SELECT u.id, u.email, u.name, p.user_id IS NOT NULL, COALESCE(p.locale, ''), COALESCE(p.channels, '{}')
+		FROM users u
+		LEFT JOIN notification_preferences p ON p.user_id = u.id
+		WHERE u.email = $1 AND u.erased_at IS NULL
+	`
+
+	var (
+		recipient entity.NotificationRecipient
+		custom    bool
+		prefs     entity.NotificationPreferences
+	)
+
+	err := r.db.QueryRowContext(cctx, query, email).Scan(&recipient.UserID, &recipient.Email, &recipient.Name,
+		&custom, &prefs.Locale, pq.Array(&prefs.Channels))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if custom {
+		prefs.Channels = nonNil(prefs.Channels)
+		recipient.Preferences = &prefs
+	}
+
+	return &recipient, nil
+}
+
+// SaveNotificationPreferences sets the preferences of the user with
+// prefs.Email. It returns ErrUserNotFound when there is no such user.
+func (r *Repository) SaveNotificationPreferences(ctx context.Context, prefs *entity.NotificationPreferences) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.SaveNotificationPreferences",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(prefs.Email),
+			attribute.String("locale", prefs.Locale),
+			attribute.StringSlice("channels", prefs.Channels),
+		),
+	)
+	defer span.End()
+
+	query := `
+		INSERT INTO notification_preferences (user_id, locale, channels)
+		SELECT id, $2, $3
+		FROM users
+		WHERE email = $1 AND erased_at IS NULL
+		ON CONFLICT (user_id) DO UPDATE
+		SET locale = EXCLUDED.locale, channels = EXCLUDED.channels
+	`
+
+	res, err := r.db.ExecContext(cctx, query, prefs.Email, prefs.Locale, pq.Array(prefs.Channels))
+	if err == nil {
+		err = errIfNoRows(res, ErrUserNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ClaimNotification records an attempt to send the notification of the event
+// eventID on channel and returns its number, starting at 1. A notification
+// still backing off from its last attempt is not claimed; the time left is
+// returned as wait instead. It returns ErrNotificationDone when the
+// notification is no longer pending.
+func (r *Repository) ClaimNotification(ctx context.Context, eventID, channel string, userID int64, kind string) (attempt int, wait time.Duration, err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ClaimNotification",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("event_id", eventID),
+			attribute.String("channel", channel),
+		),
+	)
+	defer span.End()
+
+	query := `
+		INSERT INTO notifications (event_id, channel, user_id, kind, status, attempts)
+		VALUES ($1, $2, $3, $4, $5, 1)
+		ON CONFLICT (event_id, channel) DO UPDATE
+		SET attempts = notifications.attempts +
+			CASE WHEN notifications.next_attempt_at > CURRENT_TIMESTAMP THEN 0 ELSE 1 END
+		WHERE notifications.status = $5
+		RETURNING attempts, COALESCE(EXTRACT(EPOCH FROM next_attempt_at - CURRENT_TIMESTAMP), 0)
+	`
+
+	var waitSecs float64
+	err = r.db.QueryRowContext(cctx, query, eventID, channel, userID, kind, entity.NotificationPending).Scan(&attempt, &waitSecs)
+	if errors.Is(err, sql.ErrNoRows) {
+		span.SetAttributes(attribute.Bool("notification.done", true))
+		return 0, 0, ErrNotificationDone
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, 0, err
+	}
+
+	if waitSecs > 0 {
+		wait = time.Duration(waitSecs * float64(time.Second))
+		span.SetAttributes(attribute.Float64("notification.wait_seconds", waitSecs))
+		return attempt, wait, nil
+	}
+
+	span.SetAttributes(attribute.Int("attempt", attempt))
+
+	return attempt, 0, nil
+}
+
+// FinishNotificationAttempt stores how the last attempt to send the
+// notification of eventID on channel went: sent, failed for good, or still
+// pending after sendErr, in which case it is not claimed again for retryIn.
+func (r *Repository) FinishNotificationAttempt(ctx context.Context, eventID, channel, status string, sendErr error, retryIn time.Duration) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.FinishNotificationAttempt",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("event_id", eventID),
+			attribute.String("channel", channel),
+			attribute.String("status", status),
+		),
+	)
+	defer span.End()
+
+	var lastError sql.NullString
+	if sendErr != nil {
+		lastError = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+
+	query := `
+		UPDATE notifications
+		SET status = $3, last_error = $4,
+			sent_at = CASE WHEN $3 = $5 THEN CURRENT_TIMESTAMP END,
+			next_attempt_at = CASE WHEN $3 = $6 THEN CURRENT_TIMESTAMP + make_interval(secs => $7) END
+		WHERE event_id = $1 AND channel = $2
+	`
+
+	_, err := r.db.ExecContext(cctx, query, eventID, channel, status, lastError, entity.NotificationSent,
+		entity.NotificationPending, retryIn.Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// eraseNotifications removes the preferences of userID and the delivery
+// errors of the notifications sent to them, on erasure.
+func eraseNotifications(ctx context.Context, q db.Querier, userID int64) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM notification_preferences WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	_, err := q.ExecContext(ctx, `UPDATE notifications SET last_error = NULL WHERE user_id = $1 AND last_error IS NOT NULL`, userID)
+	return err
+}
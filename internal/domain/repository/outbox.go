@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InsertOutboxEvent keeps e, which failed to publish with publishErr, in the
+// outbox. Keeping an event that is already there changes nothing.
+func (r *Repository) InsertOutboxEvent(ctx context.Context, e *event.Encoded, publishErr error) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertOutboxEvent",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("event.id", e.ID),
+			attribute.String("event.routing_key", e.Key),
+		),
+	)
+	defer span.End()
+
+	query := `
+		INSERT INTO outbox (event_id, routing_key, subject, payload, last_error)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (event_id) DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(cctx, query, e.ID, e.Key, e.Subj, []byte(e.Data), publishErr.Error())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// ClaimOutboxEvents returns up to limit events of the outbox, the oldest
+// first, and holds them back for retryAfter in case their publication fails
+// again. Concurrent callers never claim the same event.
+func (r *Repository) ClaimOutboxEvents(ctx context.Context, retryAfter time.Duration, limit int) ([]event.Encoded, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ClaimOutboxEvents",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.Int("limit", limit),
+		),
+	)
+	defer span.End()
+
+	query := `
+		WITH claimed AS (
+			UPDATE outbox
+			SET attempts = attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1)
+			WHERE id IN (
+				SELECT id
+				FROM outbox
+				WHERE next_attempt_at <= CURRENT_TIMESTAMP
+				ORDER BY id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, event_id, routing_key, subject, payload
+		)
+		SELECT event_id, routing_key, subject, payload FROM claimed ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(cctx, query, retryAfter.Seconds(), limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []event.Encoded
+	for rows.Next() {
+		var e event.Encoded
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Key, &e.Subj, &payload); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		e.Data = payload
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("claimed", len(events)))
+
+	return events, nil
+}
+
+// FinishOutboxEvent removes the event id from the outbox once it is
+// published, or records why it failed again and leaves it for a later claim.
+func (r *Repository) FinishOutboxEvent(ctx context.Context, id string, publishErr error) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.FinishOutboxEvent",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("event.id", id),
+			attribute.Bool("published", publishErr == nil),
+		),
+	)
+	defer span.End()
+
+	var err error
+	if publishErr == nil {
+		_, err = r.db.ExecContext(cctx, `DELETE FROM outbox WHERE event_id = $1`, id)
+	} else {
+		_, err = r.db.ExecContext(cctx, `UPDATE outbox SET last_error = $2 WHERE event_id = $1`, id, publishErr.Error())
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,389 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrPartnerNotFound = errors.New("partner not found")
+	ErrPartnerExists   = errors.New("partner already exists")
+	ErrBenefitNotFound = errors.New("benefit not found")
+	ErrBenefitExists   = errors.New("benefit already exists")
+	// ErrWrongPartner is returned when a partner redeems a benefit offered by
+	// another partner, or at a location it doesn't have.
+	ErrWrongPartner = errors.New("benefit not offered by the partner")
+	// ErrNotAMember is returned when a benefit is redeemed for a user without
+	// an active membership in the club of the benefit.
+	ErrNotAMember          = errors.New("no active membership in the club")
+	ErrBenefitLimitReached = errors.New("benefit redemption limit reached")
+)
+
+// InsertPartner adds a partner and its locations, filling in their IDs. It
+// returns ErrPartnerExists when the name is taken.
+func (r *Repository) InsertPartner(ctx context.Context, p *entity.Partner) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertPartner",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("partner", p.Name),
+		),
+	)
+	defer span.End()
+
+	err := r.db.WithTx(cctx, "insert_partner", func(ctx context.Context, tx *db.Tx) error {
+		err := tx.QueryRowContext(ctx, `INSERT INTO partners (name) VALUES ($1) RETURNING id`, p.Name).Scan(&p.ID)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO partner_locations (partner_id, kind, address)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`
+
+		for i := range p.Locations {
+			l := &p.Locations[i]
+			if err := tx.QueryRowContext(ctx, query, p.ID, l.Kind, l.Address).Scan(&l.ID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if db.IsUniqueViolation(err) {
+		err = ErrPartnerExists
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// ListPartners returns every partner with its locations.
+func (r *Repository) ListPartners(ctx context.Context) ([]entity.Partner, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ListPartners",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+		),
+	)
+	defer span.End()
+
+	query := `
+		SELECT p.id, p.name, l.id, l.kind, l.address
+		FROM partners p
+		JOIN partner_locations l ON l.partner_id = p.id
+		ORDER BY p.name, l.id
+	`
+
+	rows, err := r.db.QueryContext(cctx, query)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	partners := []entity.Partner{}
+	for rows.Next() {
+		var p entity.Partner
+		var l entity.PartnerLocation
+		if err := rows.Scan(&p.ID, &p.Name, &l.ID, &l.Kind, &l.Address); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		if n := len(partners); n > 0 && partners[n-1].ID == p.ID {
+			partners[n-1].Locations = append(partners[n-1].Locations, l)
+			continue
+		}
+		p.Locations = []entity.PartnerLocation{l}
+		partners = append(partners, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return partners, nil
+}
+
+// InsertBenefit adds a benefit of a partner to a club. It returns
+// ErrPartnerNotFound or ErrClubNotFound when either doesn't exist and
+// ErrBenefitExists when the code is taken.
+func (r *Repository) InsertBenefit(ctx context.Context, b *entity.Benefit) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertBenefit",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("benefit", b.Code),
+			attribute.String("partner", b.Partner),
+			attribute.String("club_name", b.Club),
+		),
+	)
+	defer span.End()
+
+	err := r.db.WithTx(cctx, "insert_benefit", func(ctx context.Context, tx *db.Tx) error {
+		var partnerID, clubID int64
+
+		err := tx.QueryRowContext(ctx, `SELECT id FROM partners WHERE name = $1`, b.Partner).Scan(&partnerID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPartnerNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT id FROM clubs WHERE name = $1`, b.Club).Scan(&clubID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrClubNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO benefits (code, partner_id, club_id, title, description, max_per_member, redemption_window)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), $7)
+		`
+
+		_, err = tx.ExecContext(ctx, query, b.Code, partnerID, clubID, b.Title, b.Description, b.MaxPerMember, b.Window)
+		return err
+	})
+	if db.IsUniqueViolation(err) {
+		err = ErrBenefitExists
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// ListBenefits returns the benefits of the club named club, or of every club
+// when club is empty.
+func (r *Repository) ListBenefits(ctx context.Context, club string) ([]entity.Benefit, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ListBenefits",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("club_name", club),
+		),
+	)
+	defer span.End()
+
+	query := `
+		SELECT b.code, p.name, c.name, b.title, COALESCE(b.description, ''), COALESCE(b.max_per_member, 0), b.redemption_window
+		FROM benefits b
+		JOIN partners p ON p.id = b.partner_id
+		JOIN clubs c ON c.id = b.club_id
+		WHERE $1 = '' OR c.name = $1
+		ORDER BY c.name, b.code
+	`
+
+	rows, err := r.db.QueryContext(cctx, query, club)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	benefits := []entity.Benefit{}
+	for rows.Next() {
+		var b entity.Benefit
+		if err := rows.Scan(&b.Code, &b.Partner, &b.Club, &b.Title, &b.Description, &b.MaxPerMember, &b.Window); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		benefits = append(benefits, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return benefits, nil
+}
+
+// RedeemBenefit records that the member with req.Email used the benefit with
+// code at req.Partner. The membership is locked while its redemptions are
+// counted, so the limit of the benefit holds under concurrent redemptions.
+func (r *Repository) RedeemBenefit(ctx context.Context, code string, req *entity.BenefitRedemptionRequest) (*entity.BenefitRedemption, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.RedeemBenefit",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("benefit", code),
+			attribute.String("partner", req.Partner),
+			telemetry.EmailAttribute(req.Email),
+		),
+	)
+	defer span.End()
+
+	red := &entity.BenefitRedemption{Benefit: code, LocationID: req.LocationID}
+
+	err := r.db.WithTx(cctx, "redeem_benefit", func(ctx context.Context, tx *db.Tx) error {
+		query := `
+			SELECT b.id, b.title, p.id, p.name, c.id, c.name, COALESCE(b.max_per_member, 0), b.redemption_window
+			FROM benefits b
+			JOIN partners p ON p.id = b.partner_id
+			JOIN clubs c ON c.id = b.club_id
+			WHERE b.code = $1
+		`
+
+		var benefitID, partnerID, clubID int64
+		var limit int
+		var window string
+		err := tx.QueryRowContext(ctx, query, code).
+			Scan(&benefitID, &red.Title, &partnerID, &red.Partner, &clubID, &red.Club, &limit, &window)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrBenefitNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if red.Partner != req.Partner {
+			return ErrWrongPartner
+		}
+
+		if req.LocationID != 0 {
+			var ok bool
+			query = `SELECT EXISTS (SELECT 1 FROM partner_locations WHERE id = $1 AND partner_id = $2)`
+			if err := tx.QueryRowContext(ctx, query, req.LocationID, partnerID).Scan(&ok); err != nil {
+				return err
+			}
+			if !ok {
+				return ErrWrongPartner
+			}
+		}
+
+		// Members in their grace period are still active.
+		query = `
+			SELECT uc.id
+			FROM user_club uc
+			JOIN users u ON u.id = uc.user_id
+			WHERE u.email = $1 AND u.erased_at IS NULL AND uc.club_id = $2 AND uc.active
+			FOR UPDATE OF uc
+		`
+
+		var membershipID int64
+		err = tx.QueryRowContext(ctx, query, req.Email, clubID).Scan(&membershipID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotAMember
+		}
+		if err != nil {
+			return err
+		}
+
+		if limit > 0 {
+			query = `
+				SELECT COUNT(*)
+				FROM benefit_redemptions
+				WHERE user_club_id = $1 AND benefit_id = $2
+					AND ($3 = 'total' OR created_at > CURRENT_TIMESTAMP - ('1 ' || $3)::interval)
+			`
+
+			var used int
+			if err := tx.QueryRowContext(ctx, query, membershipID, benefitID, window).Scan(&used); err != nil {
+				return err
+			}
+			if used >= limit {
+				return ErrBenefitLimitReached
+			}
+		}
+
+		query = `
+			INSERT INTO benefit_redemptions (benefit_id, user_club_id, partner_location_id)
+			VALUES ($1, $2, NULLIF($3, 0))
+			RETURNING id, created_at
+		`
+
+		return tx.QueryRowContext(ctx, query, benefitID, membershipID, req.LocationID).Scan(&red.ID, &red.RedeemedAt)
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return red, nil
+}
+
+// MemberRedemptions returns the benefits redeemed by the user with email in
+// every club, the most recent first. It returns ErrUserNotFound when there is
+// no such user.
+func (r *Repository) MemberRedemptions(ctx context.Context, email string) ([]entity.BenefitRedemption, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.MemberRedemptions",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	var userID int64
+	err := r.db.QueryRowContext(cctx, `SELECT id FROM users WHERE email = $1 AND erased_at IS NULL`, email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	query := `
+		SELECT br.id, b.code, b.title, p.name, c.name, COALESCE(br.partner_location_id, 0), br.created_at
+		FROM benefit_redemptions br
+		JOIN user_club uc ON uc.id = br.user_club_id
+		JOIN benefits b ON b.id = br.benefit_id
+		JOIN partners p ON p.id = b.partner_id
+		JOIN clubs c ON c.id = b.club_id
+		WHERE uc.user_id = $1
+		ORDER BY br.created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(cctx, query, userID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	redemptions := []entity.BenefitRedemption{}
+	for rows.Next() {
+		var red entity.BenefitRedemption
+		if err := rows.Scan(&red.ID, &red.Benefit, &red.Title, &red.Partner, &red.Club, &red.LocationID, &red.RedeemedAt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		redemptions = append(redemptions, red)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("redemptions", len(redemptions)))
+
+	return redemptions, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+func TestRedeemBenefit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		window  string
+		member  bool
+		used    int
+		wantErr error
+	}{
+		{name: "unlimited", window: "month", member: true},
+		{name: "under the limit of the window", limit: 2, window: "month", member: true, used: 1},
+		{name: "limit of the window reached", limit: 2, window: "month", member: true, used: 2, wantErr: ErrBenefitLimitReached},
+		{name: "total limit reached", limit: 1, window: "total", member: true, used: 1, wantErr: ErrBenefitLimitReached},
+		{name: "inactive membership", limit: 1, window: "month", wantErr: ErrNotAMember},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mock := mockRepository(t)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`FROM benefits b\s+JOIN partners p`).
+				WithArgs("CAFE10").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "partner_id", "partner", "club_id", "club", "limit", "window"}).
+					AddRow(9, "10% no café", 4, "Café Capy", 3, "Clube Capy", tt.limit, tt.window))
+
+			// Only an active membership, which includes the grace period,
+			// can redeem.
+			membership := sqlmock.NewRows([]string{"id"})
+			if tt.member {
+				membership.AddRow(11)
+			}
+			mock.ExpectQuery(`FROM user_club uc\s+JOIN users u ON u.id = uc.user_id\s+WHERE .* AND uc.active\s+FOR UPDATE OF uc`).
+				WithArgs("capy@email.com", int64(3)).
+				WillReturnRows(membership)
+
+			if tt.member && tt.limit > 0 {
+				mock.ExpectQuery(`SELECT COUNT\(\*\)\s+FROM benefit_redemptions`).
+					WithArgs(int64(11), int64(9), tt.window).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.used))
+			}
+
+			if tt.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectQuery(`INSERT INTO benefit_redemptions`).
+					WithArgs(int64(9), int64(11), int64(0)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(21, registeredAt))
+				mock.ExpectCommit()
+			}
+
+			red, err := r.RedeemBenefit(context.Background(), "CAFE10", &entity.BenefitRedemptionRequest{
+				Email:   "capy@email.com",
+				Partner: "Café Capy",
+			})
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("RedeemBenefit() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("RedeemBenefit() error = %v", err)
+			} else if red.ID != 21 || red.Club != "Clube Capy" {
+				t.Errorf("RedeemBenefit() = %+v, want redemption 21 in Clube Capy", red)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRedeemBenefitAtAnotherPartner(t *testing.T) {
+	r, mock := mockRepository(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM benefits b`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "partner_id", "partner", "club_id", "club", "limit", "window"}).
+			AddRow(9, "10% no café", 4, "Café Capy", 3, "Clube Capy", 0, "month"))
+	mock.ExpectRollback()
+
+	_, err := r.RedeemBenefit(context.Background(), "CAFE10", &entity.BenefitRedemptionRequest{
+		Email:   "capy@email.com",
+		Partner: "Padaria Belga",
+	})
+	if !errors.Is(err, ErrWrongPartner) {
+		t.Errorf("RedeemBenefit() error = %v, want %v", err, ErrWrongPartner)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
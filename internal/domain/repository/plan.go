@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrPlanNotFound = errors.New("plan not found")
+	ErrPlanExists   = errors.New("plan already exists")
+	ErrPlanInUse    = errors.New("plan is in use")
+)
+
+const planColumns = `code, name, price_cents, currency, billing_interval, trial_days, benefits`
+
+func scanPlan(row interface{ Scan(...any) error }, p *entity.Plan) error {
+	return row.Scan(&p.Code, &p.Name, &p.PriceCents, &p.Currency, &p.BillingInterval, &p.TrialDays, pq.Array(&p.Benefits))
+}
+
+func (r *Repository) ListPlans(ctx context.Context) ([]entity.Plan, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ListPlans",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+		),
+	)
+	defer span.End()
+
+	query := `SELECT ` + planColumns + ` FROM plans ORDER BY price_cents, code`
+
+	rows, err := r.db.QueryContext(cctx, query)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []entity.Plan{}
+	for rows.Next() {
+		var p entity.Plan
+		if err := scanPlan(rows, &p); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+func (r *Repository) GetPlan(ctx context.Context, code string) (*entity.Plan, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.GetPlan",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("plan_code", code),
+		),
+	)
+	defer span.End()
+
+	query := `SELECT ` + planColumns + ` FROM plans WHERE code = $1`
+
+	p := new(entity.Plan)
+	err := scanPlan(r.db.QueryRowContext(cctx, query, code), p)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrPlanNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// InsertPlan adds a plan to the catalogue. It returns ErrPlanExists when the
+// code is taken.
+func (r *Repository) InsertPlan(ctx context.Context, p *entity.Plan) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertPlan",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("plan_code", p.Code),
+		),
+	)
+	defer span.End()
+
+	query := `
+		INSERT INTO plans (` + planColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(cctx, query, p.Code, p.Name, p.PriceCents, p.Currency, p.BillingInterval, p.TrialDays, pq.Array(nonNil(p.Benefits)))
+	if db.IsUniqueViolation(err) {
+		err = ErrPlanExists
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// UpdatePlan replaces every field of the plan with p.Code. It returns
+// ErrPlanNotFound when there is no such plan.
+func (r *Repository) UpdatePlan(ctx context.Context, p *entity.Plan) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.UpdatePlan",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("plan_code", p.Code),
+		),
+	)
+	defer span.End()
+
+	query := `
+		UPDATE plans
+		SET name = $2, price_cents = $3, currency = $4, billing_interval = $5, trial_days = $6, benefits = $7
+		WHERE code = $1
+	`
+
+	res, err := r.db.ExecContext(cctx, query, p.Code, p.Name, p.PriceCents, p.Currency, p.BillingInterval, p.TrialDays, pq.Array(nonNil(p.Benefits)))
+	if err == nil {
+		err = errIfNoRows(res, ErrPlanNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// DeletePlan removes a plan from the catalogue. It returns ErrPlanNotFound
+// when there is no such plan and ErrPlanInUse when a club or membership still
+// refers to it.
+func (r *Repository) DeletePlan(ctx context.Context, code string) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.DeletePlan",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			attribute.String("plan_code", code),
+		),
+	)
+	defer span.End()
+
+	res, err := r.db.ExecContext(cctx, `DELETE FROM plans WHERE code = $1`, code)
+	switch {
+	case db.IsForeignKeyViolation(err):
+		err = ErrPlanInUse
+	case err == nil:
+		err = errIfNoRows(res, ErrPlanNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// nonNil never returns nil, which pq.Array would store as NULL.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func errIfNoRows(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newReferralCode returns a random code of 10 uppercase letters and digits.
+func newReferralCode() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b[:])
+}
+
+// referUser records that the user userID, whose normalized email is
+// normalized, was referred with code. Unknown codes, referrals of oneself and
+// referrals of someone who already has an account under another alias of the
+// same email are rejected; only the last two are stored.
+func referUser(ctx context.Context, q db.Querier, userID int64, normalized, code string) (*entity.Referral, error) {
+	query := `
+		SELECT id, COALESCE(email_normalized, '')
+		FROM users
+		WHERE referral_code = UPPER($1) AND erased_at IS NULL
+	`
+
+	var referrerEmail string
+	referral := &entity.Referral{Status: entity.ReferralPending}
+	err := q.QueryRowContext(ctx, query, code).Scan(&referral.ReferrerID, &referrerEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &entity.Referral{Status: entity.ReferralRejected, Reason: entity.ReferralUnknownCode}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicate bool
+	query = `SELECT EXISTS (SELECT 1 FROM users WHERE email_normalized = $1 AND id <> $2)`
+	if err := q.QueryRowContext(ctx, query, normalized, userID).Scan(&duplicate); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case referrerEmail == normalized:
+		referral.Status, referral.Reason = entity.ReferralRejected, entity.ReferralSelf
+	case duplicate:
+		referral.Status, referral.Reason = entity.ReferralRejected, entity.ReferralDuplicateEmail
+	}
+
+	query = `
+		INSERT INTO referrals (referrer_id, referred_id, status, reason)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+	`
+
+	if _, err := q.ExecContext(ctx, query, referral.ReferrerID, userID, referral.Status, referral.Reason); err != nil {
+		return nil, err
+	}
+
+	return referral, nil
+}
+
+// rewardReferral rewards the referrer of the user referredID, when the user
+// has a pending referral, and returns the reward. Referrers who were erased
+// get nothing and their referral stays pending. Free days go to a referrer
+// without an active membership as a coupon instead, since there is no period
+// to extend.
+func rewardReferral(ctx context.Context, q db.Querier, referredID int64, reward entity.ReferralReward) (*entity.ReferralGrant, error) {
+	query := `
+		UPDATE referrals r
+		SET status = $2, rewarded_at = CURRENT_TIMESTAMP
+		FROM users u
+		WHERE r.referred_id = $1 AND r.status = $3 AND u.id = r.referrer_id AND u.erased_at IS NULL
+		RETURNING r.id, u.id, u.email
+	`
+
+	var referralID, referrerID int64
+	grant := &entity.ReferralGrant{Type: reward.Type}
+	err := q.QueryRowContext(ctx, query, referredID, entity.ReferralRewarded, entity.ReferralPending).
+		Scan(&referralID, &referrerID, &grant.ReferrerEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reward.Type != entity.RewardCoupon {
+		query = `
+			UPDATE user_club
+			SET current_period_end = current_period_end + make_interval(days => $2)
+			WHERE user_id = $1 AND active
+		`
+
+		res, err := q.ExecContext(ctx, query, referrerID, reward.Days)
+		if err != nil {
+			return nil, err
+		}
+
+		extended, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if extended > 0 {
+			grant.Days = reward.Days
+			return grant, nil
+		}
+
+		grant.Type = entity.RewardCoupon
+	}
+
+	grant.CouponCode = entity.ReferralCouponPrefix + newReferralCode()
+
+	query = `
+		INSERT INTO coupons (code, discount_type, discount_value, max_redemptions, max_per_user, owner_id)
+		VALUES ($1, $2, $3, 1, 1, $4)
+	`
+
+	if _, err := q.ExecContext(ctx, query, grant.CouponCode, entity.DiscountPercent, reward.Percent, referrerID); err != nil {
+		return nil, err
+	}
+
+	_, err = q.ExecContext(ctx, `UPDATE referrals SET reward_coupon = $2 WHERE id = $1`, referralID, grant.CouponCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// scrubReferrals clears, on erasure, why the referrals of userID were
+// rejected and the coupons userID was rewarded with. The rows and their
+// status are kept for the counts of the other side, as is the coupon of a
+// referrer whose referred user is erased.
+func scrubReferrals(ctx context.Context, q db.Querier, userID int64) error {
+	query := `
+		UPDATE referrals
+		SET reason = CASE WHEN referred_id = $1 THEN NULL ELSE reason END,
+			reward_coupon = CASE WHEN referrer_id = $1 THEN NULL ELSE reward_coupon END
+		WHERE referred_id = $1 OR referrer_id = $1
+	`
+
+	_, err := q.ExecContext(ctx, query, userID)
+	return err
+}
+
+// ReferralSummary returns the referral code of the user with email, giving a
+// code to users created before they had one, and how its referrals went. It
+// returns ErrUserNotFound when there is no such user.
+func (r *Repository) ReferralSummary(ctx context.Context, email string) (*entity.ReferralSummary, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ReferralSummary",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	summary := &entity.ReferralSummary{Coupons: []string{}}
+
+	err := r.db.WithTx(cctx, "referral_summary", func(ctx context.Context, tx *db.Tx) error {
+		query := `
+			UPDATE users
+			SET referral_code = COALESCE(referral_code, $2)
+			WHERE email = $1 AND erased_at IS NULL
+			RETURNING id, referral_code
+		`
+
+		var userID int64
+		err := tx.QueryRowContext(ctx, query, email, newReferralCode()).Scan(&userID, &summary.Code)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query = `
+			SELECT status, COALESCE(reward_coupon, '')
+			FROM referrals
+			WHERE referrer_id = $1
+			ORDER BY created_at
+		`
+
+		rows, err := tx.QueryContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var status, coupon string
+			if err := rows.Scan(&status, &coupon); err != nil {
+				return err
+			}
+			switch status {
+			case entity.ReferralPending:
+				summary.Pending++
+			case entity.ReferralRewarded:
+				summary.Rewarded++
+			case entity.ReferralRejected:
+				summary.Rejected++
+			}
+			if coupon != "" {
+				summary.Coupons = append(summary.Coupons, coupon)
+			}
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return summary, nil
+}
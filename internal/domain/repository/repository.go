@@ -2,17 +2,28 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/hazkall/capy-belga/internal/db"
 	"github.com/hazkall/capy-belga/internal/domain/entity"
 	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"github.com/lib/pq"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrClubNotFound = errors.New("club not found")
+	ErrInactiveUser = errors.New("user is not active")
+	ErrClubArchived = errors.New("club is archived")
+)
+
 type Repository struct {
 	db *db.Postgres
 }
@@ -32,51 +43,27 @@ func NewRepository() *Repository {
 	return &Repository{db: dbConn}
 }
 
-func (r *Repository) GetUserIdClubID(ctx context.Context, email, clubName string) (clubId, userId int64, err error) {
-
-	_, span := telemetry.Tracer.Start(ctx, "Repository.GetUserIdClubID",
-		trace.WithAttributes(
-			attribute.String("entity", "repository"),
-			attribute.String("email", email),
-			attribute.String("club_name", clubName),
-		),
-	)
-
-	defer span.End()
-
-	query := `
-		SELECT u.id, c.id
-		FROM users u
-		JOIN clubs c ON 1=1
-		WHERE u.email = $1 AND c.name = $2
-	`
-
-	span.SetAttributes(attribute.String("db.statement", query))
-
-	row := r.db.DB.QueryRow(query, email, clubName)
-	err = row.Scan(&userId, &clubId)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-	}
-	return
+// New returns a repository on an open database.
+func New(conn *db.Postgres) *Repository {
+	return &Repository{db: conn}
 }
 
 func (r *Repository) GetUserID(ctx context.Context, email string) (int64, error) {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.GetUserID",
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.GetUserID",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
-			attribute.String("email", email),
+			telemetry.EmailAttribute(email),
 		),
 	)
 	defer span.End()
 
 	query := `SELECT id FROM users WHERE email = $1`
 
-	span.SetAttributes(attribute.String("db.statement", query))
-
 	var userID int64
-	err := r.db.DB.QueryRow(query, email).Scan(&userID)
+	err := r.db.QueryRowContext(cctx, query, email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -86,7 +73,7 @@ func (r *Repository) GetUserID(ctx context.Context, email string) (int64, error)
 }
 
 func (r *Repository) GetClubID(ctx context.Context, name string) (int64, error) {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.GetClubID",
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.GetClubID",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
 			attribute.String("name", name),
@@ -100,10 +87,11 @@ func (r *Repository) GetClubID(ctx context.Context, name string) (int64, error)
 		WHERE name = $1
 	`
 
-	span.SetAttributes(attribute.String("db.statement", query))
-
 	var clubID int64
-	err := r.db.DB.QueryRow(query, name).Scan(&clubID)
+	err := r.db.QueryRowContext(cctx, query, name).Scan(&clubID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrClubNotFound
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -113,7 +101,7 @@ func (r *Repository) GetClubID(ctx context.Context, name string) (int64, error)
 }
 
 func (r *Repository) UserState(ctx context.Context, userID int64) (active bool, err error) {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.UserState",
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.UserState",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
 			attribute.Int64("user_id", userID),
@@ -126,9 +114,8 @@ func (r *Repository) UserState(ctx context.Context, userID int64) (active bool,
 		FROM users
 		WHERE id = $1
 	`
-	span.SetAttributes(attribute.String("db.statement", query))
 
-	err = r.db.DB.QueryRow(query, userID).Scan(&active)
+	err = r.db.QueryRowContext(cctx, query, userID).Scan(&active)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
@@ -137,86 +124,214 @@ func (r *Repository) UserState(ctx context.Context, userID int64) (active bool,
 	return active, nil
 }
 
-func (r *Repository) UserPlanStatus(ctx context.Context, userID int64) (active bool, planType string, err error) {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.UserPlanStatus",
+// UserPlanStatus returns the status and plan of the membership of a user,
+// preferring an active membership and then the most recent one. A user
+// without memberships is reported as inactive with a nil plan. It is a single
+// statement, so it reads one consistent snapshot.
+func (r *Repository) UserPlanStatus(ctx context.Context, email string) (active bool, plan *entity.Plan, err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.UserPlanStatus",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
-			attribute.Int64("user_id", userID),
+			telemetry.EmailAttribute(email),
 		),
 	)
 	defer span.End()
 
 	query := `
-		SELECT uc.active, c.plan_type
-		FROM user_club uc
-		JOIN clubs c ON uc.club_id = c.id
-		WHERE uc.user_id = $1
+		SELECT COALESCE(uc.active, false), p.code, COALESCE(p.name, ''), COALESCE(p.price_cents, 0),
+			COALESCE(p.currency, ''), COALESCE(p.billing_interval, ''), COALESCE(p.trial_days, 0),
+			COALESCE(p.benefits, '{}')
+		FROM users u
+		LEFT JOIN user_club uc ON uc.user_id = u.id
+		LEFT JOIN clubs c ON c.id = uc.club_id
+		LEFT JOIN plans p ON p.code = COALESCE(uc.plan_type, c.plan_type)
+		WHERE u.email = $1
+		ORDER BY uc.active DESC NULLS LAST, uc.joined_at DESC NULLS LAST
 		LIMIT 1
 	`
-	span.SetAttributes(attribute.String("db.statement", query))
 
-	err = r.db.DB.QueryRow(query, userID).Scan(&active, &planType)
+	var code sql.NullString
+	p := new(entity.Plan)
+	err = r.db.QueryRowContext(cctx, query, email).
+		Scan(&active, &code, &p.Name, &p.PriceCents, &p.Currency, &p.BillingInterval, &p.TrialDays, pq.Array(&p.Benefits))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+		return false, nil, err
 	}
 
-	return
+	if code.Valid {
+		p.Code = code.String
+		plan = p
+	}
+
+	return active, plan, nil
 }
 
-func (r *Repository) InsertUserClub(ctx context.Context, userID int64, clubID int64) error {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.InsertUserClub",
+// lockActiveUser returns the ID and registration time of the user, locking
+// its row until the transaction ends so signups and cancellations of the same
+// user don't interleave.
+func lockActiveUser(ctx context.Context, q db.Querier, email string) (int64, time.Time, error) {
+	userID, active, registeredAt, err := lockUser(ctx, q, email)
+	switch {
+	case err != nil:
+		return 0, time.Time{}, err
+	case !active:
+		return 0, time.Time{}, ErrInactiveUser
+	}
+
+	return userID, registeredAt, nil
+}
+
+// SignupUserClub signs the user up to the club in one transaction and returns
+// the membership, including whether it is the first signup of the user. It
+// returns ErrUserNotFound, ErrClubNotFound, ErrClubArchived or ErrInactiveUser
+// when the signup is not possible, and a unique violation when the user is
+// already a member. A non-empty coupon is redeemed by the membership, and an
+// error wrapping ErrInvalidCoupon when it can't be fails the whole signup.
+// The first signup of a referred user gives reward to the referrer.
+func (r *Repository) SignupUserClub(ctx context.Context, signup *entity.SignupPayload, reward entity.ReferralReward) (*entity.Membership, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.SignupUserClub",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
-			attribute.Int64("user_id", userID),
-			attribute.Int64("club_id", clubID),
+			telemetry.EmailAttribute(signup.Email),
+			attribute.String("club_name", signup.ClubName),
 		),
 	)
 	defer span.End()
 
-	query := `
-		INSERT INTO user_club (user_id, club_id)
-		VALUES ($1, $2)
-	`
-	span.SetAttributes(attribute.String("db.statement", query))
-
-	_, err := r.db.DB.Exec(query, userID, clubID)
+	m := new(entity.Membership)
+
+	err := r.db.WithTx(cctx, "signup", func(ctx context.Context, tx *db.Tx) error {
+		userID, registeredAt, err := lockActiveUser(ctx, tx, signup.Email)
+		if err != nil {
+			return err
+		}
+		m.UserRegisteredAt = registeredAt
+
+		query := `
+			SELECT id, name, plan_type, aquisition_channel, aquisition_location, archived_at IS NOT NULL
+			FROM clubs
+			WHERE name = $1
+		`
+
+		var archived bool
+		err = tx.QueryRowContext(ctx, query, signup.ClubName).Scan(&m.Club.ID, &m.Club.Name, &m.Club.PlanType, &m.Club.AquisitionChannel, &m.Club.AquisitionLocation, &archived)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrClubNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if archived {
+			return ErrClubArchived
+		}
+
+		if signup.Attribution != nil {
+			m.Attribution = *signup.Attribution
+		}
+		if m.Attribution.Channel == "" {
+			m.Attribution.Channel = m.Club.AquisitionChannel
+		}
+		if m.Attribution.Location == "" {
+			m.Attribution.Location = m.Club.AquisitionLocation
+		}
+		a := m.Attribution
+
+		// First is whether the user had no membership in another club; there
+		// can't be an earlier one in this club because of the unique index.
+		// The first period is the trial of the plan. A plan without one starts
+		// with its period already due, so the next billing run charges it.
+		query = `
+			INSERT INTO user_club (user_id, club_id, current_period_end, aquisition_channel, aquisition_location,
+				store_id, utm_campaign, utm_source, utm_medium, referrer)
+			VALUES ($1, $2, CURRENT_TIMESTAMP + (
+				SELECT make_interval(days => p.trial_days)
+				FROM plans p
+				WHERE p.code = $3
+			), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''))
+			RETURNING id, joined_at, NOT EXISTS (SELECT 1 FROM user_club WHERE user_id = $1 AND club_id <> $2)
+		`
+
+		var membershipID int64
+		err = tx.QueryRowContext(ctx, query, userID, m.Club.ID, m.Club.PlanType, a.Channel, a.Location,
+			a.StoreID, a.UTMCampaign, a.UTMSource, a.UTMMedium, a.Referrer).Scan(&membershipID, &m.JoinedAt, &m.First)
+		if err != nil {
+			return err
+		}
+
+		if signup.Coupon != "" {
+			m.Coupon, err = redeemCoupon(ctx, tx, signup.Coupon, userID, membershipID, m.Club)
+			if err != nil {
+				return err
+			}
+		}
+
+		if m.First {
+			m.Referral, err = rewardReferral(ctx, tx, userID, reward)
+		}
+		return err
+	})
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return err
+		return nil, err
 	}
-	return nil
+
+	span.SetAttributes(attribute.Bool("first_signup", m.First))
+	if m.Coupon != nil {
+		span.SetAttributes(attribute.String("coupon_code", m.Coupon.Code), attribute.Int64("discount_cents", m.Coupon.DiscountCents))
+	}
+
+	return m, nil
 }
 
-func (r *Repository) InsertUser(ctx context.Context, user *entity.User) error {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.InsertUser",
+// InsertUser adds a user with a new referral code. When the user was
+// referred, it returns how the referral turned out; a rejected referral
+// doesn't fail the insert.
+func (r *Repository) InsertUser(ctx context.Context, user *entity.User) (*entity.Referral, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertUser",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
-			attribute.String("email", user.Email),
+			telemetry.EmailAttribute(user.Email),
 		),
 	)
 	defer span.End()
 
-	query := `
-		INSERT INTO users (name, email)
-		VALUES ($1, $2)
-	`
+	var referral *entity.Referral
+
+	err := r.db.WithTx(cctx, "insert_user", func(ctx context.Context, tx *db.Tx) error {
+		query := `
+			INSERT INTO users (name, email, email_normalized, referral_code)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`
 
-	span.SetAttributes(attribute.String("db.statement", query))
+		normalized := entity.NormalizeEmail(user.Email)
 
-	_, err := r.db.DB.Exec(query, user.Name, user.Email)
+		var userID int64
+		err := tx.QueryRowContext(ctx, query, user.Name, user.Email, normalized, newReferralCode()).Scan(&userID)
+		if err != nil || user.ReferredBy == "" {
+			return err
+		}
 
+		referral, err = referUser(ctx, tx, userID, normalized, user.ReferredBy)
+		return err
+	})
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+		return nil, err
 	}
 
-	return err
+	return referral, nil
 }
 
 func (r *Repository) InsertClub(ctx context.Context, club *entity.Club) error {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.InsertClub",
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.InsertClub",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
 			attribute.String("name", club.Name),
@@ -228,9 +343,8 @@ func (r *Repository) InsertClub(ctx context.Context, club *entity.Club) error {
 		INSERT INTO clubs (name, description, aquisition_channel, aquisition_location, plan_type)
 		VALUES ($1, $2, $3, $4, $5)
 	`
-	span.SetAttributes(attribute.String("db.statement", query))
 
-	_, err := r.db.DB.Exec(query, club.Name, club.Description, club.AquisitionChannel, club.AquisitionLocation, club.PlanType)
+	_, err := r.db.ExecContext(cctx, query, club.Name, club.Description, club.AquisitionChannel, club.AquisitionLocation, club.PlanType)
 
 	if err != nil {
 		span.RecordError(err)
@@ -240,26 +354,117 @@ func (r *Repository) InsertClub(ctx context.Context, club *entity.Club) error {
 	return err
 }
 
-func (r *Repository) CancelUserClub(ctx context.Context, userID int64) error {
-	_, span := telemetry.Tracer.Start(ctx, "Repository.CancelUserClub",
+// CancelUserClub deactivates the active memberships of a user in one
+// transaction and returns the memberships that were actually cancelled, which
+// is empty when there was nothing to cancel. It returns ErrUserNotFound or
+// ErrInactiveUser when the user can't cancel.
+func (r *Repository) CancelUserClub(ctx context.Context, email string) ([]entity.Membership, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.CancelUserClub",
 		trace.WithAttributes(
 			attribute.String("entity", "repository"),
-			attribute.Int64("user_id", userID),
+			telemetry.EmailAttribute(email),
 		),
 	)
 	defer span.End()
 
+	var memberships []entity.Membership
+
+	err := r.db.WithTx(cctx, "cancel", func(ctx context.Context, tx *db.Tx) error {
+		userID, _, err := lockActiveUser(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		memberships, err = cancelMemberships(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("cancelled", len(memberships)))
+
+	return memberships, nil
+}
+
+func cancelMemberships(ctx context.Context, q db.Querier, userID int64) ([]entity.Membership, error) {
 	query := `
-		UPDATE user_club
+		UPDATE user_club uc
 		SET active = false
-		WHERE user_id = $1
+		FROM clubs c
+		WHERE uc.club_id = c.id AND uc.user_id = $1 AND uc.active
+		RETURNING c.id, c.name, COALESCE(uc.plan_type, c.plan_type), c.aquisition_channel, c.aquisition_location,
+			COALESCE(uc.joined_at, uc.created_at)
+	`
+	return scanMemberships(q.QueryContext(ctx, query, userID))
+}
+
+// scanMemberships reads the club and join time of each row returned by a
+// membership query.
+func scanMemberships(rows *sql.Rows, err error) ([]entity.Membership, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []entity.Membership
+	for rows.Next() {
+		var m entity.Membership
+		if err := rows.Scan(&m.Club.ID, &m.Club.Name, &m.Club.PlanType, &m.Club.AquisitionChannel, &m.Club.AquisitionLocation, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+
+	return memberships, rows.Err()
+}
+
+// ActiveMembershipCounts returns the number of active memberships per club,
+// plan type and acquisition channel. The channel is the one the membership
+// was attributed to at signup, or the club's for memberships without one.
+func (r *Repository) ActiveMembershipCounts(ctx context.Context) ([]telemetry.MembershipCount, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ActiveMembershipCounts",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+		),
+	)
+	defer span.End()
+
+	query := `
+		SELECT c.name, COALESCE(uc.plan_type, c.plan_type) AS plan_type,
+			COALESCE(uc.aquisition_channel, c.aquisition_channel) AS aquisition_channel, COUNT(*)
+		FROM user_club uc
+		JOIN clubs c ON uc.club_id = c.id
+		WHERE uc.active
+		GROUP BY c.name, 2, 3
 	`
-	span.SetAttributes(attribute.String("db.statement", query))
-	_, err := r.db.DB.Exec(query, userID)
 
+	rows, err := r.db.QueryContext(cctx, query)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+		return nil, err
 	}
-	return err
+	defer rows.Close()
+
+	var counts []telemetry.MembershipCount
+	for rows.Next() {
+		var c telemetry.MembershipCount
+		if err := rows.Scan(&c.Club, &c.PlanType, &c.Channel, &c.Count); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return counts, nil
 }
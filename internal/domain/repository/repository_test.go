@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+func TestMain(m *testing.M) {
+	telemetry.Tracer = tracenoop.NewTracerProvider().Tracer("test")
+	telemetry.Meter = metricnoop.NewMeterProvider().Meter("test")
+
+	if err := telemetry.MetricsStart(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+// mockRepository returns a repository on a mock database that expects the
+// statements in the order they are declared.
+func mockRepository(t *testing.T) (*Repository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &Repository{db: &db.Postgres{DB: conn}}, mock
+}
+
+var registeredAt = time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+func expectUser(mock sqlmock.Sqlmock, active bool) {
+	mock.ExpectQuery(`SELECT id, active, created_at\s+FROM users`).
+		WithArgs("capy@email.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "active", "created_at"}).AddRow(7, active, registeredAt))
+}
+
+func expectClub(mock sqlmock.Sqlmock, archived bool) {
+	mock.ExpectQuery(`FROM clubs\s+WHERE name = \$1`).
+		WithArgs("Clube Capy").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "plan_type", "aquisition_channel", "aquisition_location", "archived"}).
+			AddRow(3, "Clube Capy", "premium", "online", "store", archived))
+}
+
+func expectMembership(mock sqlmock.Sqlmock, first bool) {
+	mock.ExpectQuery(`INSERT INTO user_club`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "joined_at", "first"}).AddRow(11, registeredAt.Add(time.Hour), first))
+}
+
+// redeemColumns are the columns redeemCoupon reads a coupon with.
+var redeemColumns = []string{"id", "discount_type", "discount_value", "currency", "valid", "available", "available_to_user",
+	"applicable", "owned"}
+
+func expectCoupon(mock sqlmock.Sqlmock, valid bool) {
+	mock.ExpectQuery(`FROM coupons c\s+WHERE c.code = \$1\s+FOR UPDATE`).
+		WithArgs("BEMVINDO", int64(7), "Clube Capy", "premium").
+		WillReturnRows(sqlmock.NewRows(redeemColumns).
+			AddRow(5, entity.DiscountPercent, 10, "", valid, true, true, true, true))
+}
+
+func expectReferral(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`UPDATE referrals r\s+SET status = \$2`).
+		WithArgs(int64(7), entity.ReferralRewarded, entity.ReferralPending).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "referrer_id", "email"}).AddRow(2, 1, "referrer@email.com"))
+}
+
+func TestSignupUserClub(t *testing.T) {
+	errReset := errors.New("connection reset")
+	coupon := entity.ReferralReward{Type: entity.RewardCoupon, Percent: 20}
+	days := entity.ReferralReward{Type: entity.RewardFreeDays, Days: 30}
+
+	tests := []struct {
+		name    string
+		coupon  string
+		reward  entity.ReferralReward
+		expect  func(sqlmock.Sqlmock)
+		wantErr error
+		check   func(*testing.T, *entity.Membership)
+	}{
+		{
+			name: "user not found",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM users`).WillReturnRows(sqlmock.NewRows([]string{"id", "active", "created_at"}))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name: "inactive user",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, false)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrInactiveUser,
+		},
+		{
+			name: "archived club",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, true)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrClubArchived,
+		},
+		{
+			name:   "invalid coupon rolls the membership back",
+			coupon: "BEMVINDO",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, false)
+				expectCoupon(mock, false)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrCouponExpired,
+		},
+		{
+			name:   "coupon redeemed with the membership",
+			coupon: "BEMVINDO",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, false)
+				expectCoupon(mock, true)
+				mock.ExpectQuery(`SELECT price_cents, currency FROM plans`).
+					WithArgs("premium").
+					WillReturnRows(sqlmock.NewRows([]string{"price_cents", "currency"}).AddRow(2990, "BRL"))
+				mock.ExpectExec(`UPDATE coupons SET redemptions = redemptions \+ 1`).
+					WithArgs(int64(5)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO coupon_redemptions`).
+					WithArgs(int64(5), int64(7), int64(11), int64(299), "BRL").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			check: func(t *testing.T, m *entity.Membership) {
+				if m.Coupon == nil || m.Coupon.DiscountCents != 299 || m.Coupon.Currency != "BRL" {
+					t.Errorf("Coupon = %+v, want 299 BRL", m.Coupon)
+				}
+				if m.Referral != nil {
+					t.Errorf("a signup that isn't the first rewarded %+v", m.Referral)
+				}
+			},
+		},
+		{
+			name:   "first signup rewards the referrer with a coupon",
+			reward: coupon,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, true)
+				expectReferral(mock)
+				mock.ExpectExec(`INSERT INTO coupons`).
+					WithArgs(sqlmock.AnyArg(), entity.DiscountPercent, int64(20), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE referrals SET reward_coupon = \$2`).
+					WithArgs(int64(2), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			check: func(t *testing.T, m *entity.Membership) {
+				if m.Referral == nil || m.Referral.ReferrerEmail != "referrer@email.com" || !strings.HasPrefix(m.Referral.CouponCode, "REF-") {
+					t.Errorf("Referral = %+v, want a REF- coupon for referrer@email.com", m.Referral)
+				}
+			},
+		},
+		{
+			name:   "first signup rewards the referrer with free days",
+			reward: days,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, true)
+				expectReferral(mock)
+				mock.ExpectExec(`UPDATE user_club\s+SET current_period_end = current_period_end \+ make_interval`).
+					WithArgs(int64(1), 30).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+			check: func(t *testing.T, m *entity.Membership) {
+				if m.Referral == nil || m.Referral.Days != 30 {
+					t.Errorf("Referral = %+v, want 30 days", m.Referral)
+				}
+			},
+		},
+		{
+			name:   "free days for a referrer without an active membership become a coupon",
+			reward: entity.ReferralReward{Type: entity.RewardFreeDays, Days: 30, Percent: 50},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, true)
+				expectReferral(mock)
+				mock.ExpectExec(`UPDATE user_club\s+SET current_period_end = current_period_end \+ make_interval`).
+					WithArgs(int64(1), 30).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO coupons`).
+					WithArgs(sqlmock.AnyArg(), entity.DiscountPercent, int64(50), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE referrals SET reward_coupon = \$2`).
+					WithArgs(int64(2), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			check: func(t *testing.T, m *entity.Membership) {
+				g := m.Referral
+				if g == nil || g.Type != entity.RewardCoupon || g.Days != 0 || !strings.HasPrefix(g.CouponCode, "REF-") {
+					t.Errorf("Referral = %+v, want a REF- coupon instead of days", g)
+				}
+			},
+		},
+		{
+			name:   "coupon of another user",
+			coupon: "BEMVINDO",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, false)
+				mock.ExpectQuery(`FROM coupons c\s+WHERE c.code = \$1\s+FOR UPDATE`).
+					WithArgs("BEMVINDO", int64(7), "Clube Capy", "premium").
+					WillReturnRows(sqlmock.NewRows(redeemColumns).
+						AddRow(5, entity.DiscountPercent, 50, "", true, true, true, true, false))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrCouponNotOwned,
+		},
+		{
+			name:   "first signup without a pending referral",
+			reward: coupon,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, true)
+				mock.ExpectQuery(`UPDATE referrals r`).WillReturnRows(sqlmock.NewRows([]string{"id", "referrer_id", "email"}))
+				mock.ExpectCommit()
+			},
+			check: func(t *testing.T, m *entity.Membership) {
+				if !m.First || m.Referral != nil {
+					t.Errorf("First = %t, Referral = %+v, want a first signup without reward", m.First, m.Referral)
+				}
+				if m.Attribution.Channel != "online" || m.Attribution.Location != "store" {
+					t.Errorf("Attribution = %+v, want the club's channel and location", m.Attribution)
+				}
+			},
+		},
+		{
+			name:   "failed reward rolls the membership back",
+			reward: coupon,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectUser(mock, true)
+				expectClub(mock, false)
+				expectMembership(mock, true)
+				expectReferral(mock)
+				mock.ExpectExec(`INSERT INTO coupons`).WillReturnError(errReset)
+				mock.ExpectRollback()
+			},
+			wantErr: errReset,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, mock := mockRepository(t)
+			tt.expect(mock)
+
+			m, err := r.SignupUserClub(context.Background(), &entity.SignupPayload{
+				Email:    "capy@email.com",
+				ClubName: "Clube Capy",
+				Coupon:   tt.coupon,
+			}, tt.reward)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SignupUserClub() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("SignupUserClub() error = %v", err)
+			}
+
+			if tt.check != nil {
+				if !m.UserRegisteredAt.Equal(registeredAt) {
+					t.Errorf("UserRegisteredAt = %v, want %v", m.UserRegisteredAt, registeredAt)
+				}
+				tt.check(t, m)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestActiveMembershipCounts(t *testing.T) {
+	r, mock := mockRepository(t)
+
+	mock.ExpectQuery(`COALESCE\(uc.aquisition_channel, c.aquisition_channel\) AS aquisition_channel`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "plan_type", "aquisition_channel", "count"}).
+			AddRow("Clube Capy", "premium", "offline", 4).
+			AddRow("Clube Capy", "premium", "online", 2))
+
+	counts, err := r.ActiveMembershipCounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[0].Channel != "offline" || counts[0].Count != 4 {
+		t.Errorf("ActiveMembershipCounts() = %+v", counts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
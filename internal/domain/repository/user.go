@@ -0,0 +1,300 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrEmailInUse is returned when a user is updated to the email of another
+// user.
+var ErrEmailInUse = errors.New("email already in use")
+
+// Actions recorded in user_audit.
+const (
+	AuditUpdate     = "update"
+	AuditDeactivate = "deactivate"
+	AuditReactivate = "reactivate"
+	AuditErase      = "erase"
+)
+
+// lockUser returns the ID, state and registration time of the user, locking
+// its row until the transaction ends. Erased users are not found.
+func lockUser(ctx context.Context, q db.Querier, email string) (userID int64, active bool, registeredAt time.Time, err error) {
+	query := `
+		SELECT id, active, created_at
+		FROM users
+		WHERE email = $1 AND erased_at IS NULL
+		FOR UPDATE
+	`
+
+	err = q.QueryRowContext(ctx, query, email).Scan(&userID, &active, &registeredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUserNotFound
+	}
+
+	return userID, active, registeredAt, err
+}
+
+func insertAudit(ctx context.Context, q db.Querier, userID int64, action string, details map[string]any) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_audit (user_id, action, details)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err = q.ExecContext(ctx, query, userID, action, string(data))
+	return err
+}
+
+// UpdateUser changes the name and/or the email of a user. Empty values are
+// left unchanged. The previous values are kept in user_audit.
+func (r *Repository) UpdateUser(ctx context.Context, email, name, newEmail string) (*entity.User, error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.UpdateUser",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	user := new(entity.User)
+
+	err := r.db.WithTx(cctx, "update_user", func(ctx context.Context, tx *db.Tx) error {
+		userID, _, _, err := lockUser(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		var previousName string
+
+		query := `
+			UPDATE users u
+			SET name = COALESCE(NULLIF($2, ''), u.name),
+				email = COALESCE(NULLIF($3, ''), u.email),
+				email_normalized = COALESCE(NULLIF($4, ''), u.email_normalized)
+			FROM users old
+			WHERE u.id = $1 AND old.id = u.id
+			RETURNING u.id, u.name, u.email, old.name
+		`
+
+		var normalized string
+		if newEmail != "" {
+			normalized = entity.NormalizeEmail(newEmail)
+		}
+
+		err = tx.QueryRowContext(ctx, query, userID, name, newEmail, normalized).Scan(&user.ID, &user.Name, &user.Email, &previousName)
+		if db.IsUniqueViolation(err) {
+			return ErrEmailInUse
+		}
+		if err != nil {
+			return err
+		}
+
+		details := map[string]any{}
+		if user.Name != previousName {
+			details["previous_name"] = previousName
+		}
+		if user.Email != email {
+			details["previous_email"] = email
+		}
+
+		return insertAudit(ctx, tx, userID, AuditUpdate, details)
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// DeactivateUser deactivates a user and suspends its active memberships,
+// which are returned. Deactivating an inactive user changes nothing.
+func (r *Repository) DeactivateUser(ctx context.Context, email string) (userID int64, suspended []entity.Membership, err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.DeactivateUser",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	err = r.db.WithTx(cctx, "deactivate_user", func(ctx context.Context, tx *db.Tx) error {
+		var active bool
+		userID, active, _, err = lockUser(ctx, tx, email)
+		if err != nil || !active {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET active = false WHERE id = $1`, userID); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE user_club uc
+			SET active = false, suspended = true
+			FROM clubs c
+			WHERE uc.club_id = c.id AND uc.user_id = $1 AND uc.active
+			RETURNING c.id, c.name, COALESCE(uc.plan_type, c.plan_type), c.aquisition_channel, c.aquisition_location,
+				COALESCE(uc.joined_at, uc.created_at)
+		`
+
+		if suspended, err = scanMemberships(tx.QueryContext(ctx, query, userID)); err != nil {
+			return err
+		}
+
+		return insertAudit(ctx, tx, userID, AuditDeactivate, map[string]any{"suspended_memberships": len(suspended)})
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, nil, err
+	}
+
+	span.SetAttributes(attribute.Int("suspended", len(suspended)))
+
+	return userID, suspended, nil
+}
+
+// ReactivateUser reactivates a user and the memberships suspended by its
+// deactivation, which are returned. Memberships the user cancelled stay
+// cancelled. Reactivating an active user changes nothing.
+func (r *Repository) ReactivateUser(ctx context.Context, email string) (userID int64, resumed []entity.Membership, err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.ReactivateUser",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	err = r.db.WithTx(cctx, "reactivate_user", func(ctx context.Context, tx *db.Tx) error {
+		var active bool
+		userID, active, _, err = lockUser(ctx, tx, email)
+		if err != nil || active {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET active = true WHERE id = $1`, userID); err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE user_club uc
+			SET active = true, suspended = false
+			FROM clubs c
+			WHERE uc.club_id = c.id AND uc.user_id = $1 AND uc.suspended
+			RETURNING c.id, c.name, COALESCE(uc.plan_type, c.plan_type), c.aquisition_channel, c.aquisition_location,
+				COALESCE(uc.joined_at, uc.created_at)
+		`
+
+		if resumed, err = scanMemberships(tx.QueryContext(ctx, query, userID)); err != nil {
+			return err
+		}
+
+		return insertAudit(ctx, tx, userID, AuditReactivate, map[string]any{"resumed_memberships": len(resumed)})
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, nil, err
+	}
+
+	span.SetAttributes(attribute.Int("resumed", len(resumed)))
+
+	return userID, resumed, nil
+}
+
+// EraseUser anonymizes the personal data of a user: the name, email and
+// referral code in users, the previous values kept in user_audit, the
+// referrer of each signup, the delivery errors of notifications, which can
+// quote the address, and the reasons and reward coupons of the referrals the
+// user took part in. The rows themselves are kept, deactivated, so aggregates
+// over users, memberships and referrals don't change.
+// The memberships that were still active or suspended are cancelled and
+// returned.
+func (r *Repository) EraseUser(ctx context.Context, email string) (userID int64, cancelled []entity.Membership, err error) {
+	cctx, span := telemetry.Tracer.Start(ctx, "Repository.EraseUser",
+		trace.WithAttributes(
+			attribute.String("entity", "repository"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	err = r.db.WithTx(cctx, "erase_user", func(ctx context.Context, tx *db.Tx) error {
+		userID, _, _, err = lockUser(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		// The email keeps the unique index satisfied without being
+		// derived from the original one.
+		query := `
+			UPDATE users
+			SET name = '', email = 'erased-' || id || '@erased.invalid', email_normalized = NULL,
+				referral_code = NULL, active = false, erased_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE user_club uc
+			SET active = false, suspended = false
+			FROM clubs c
+			WHERE uc.club_id = c.id AND uc.user_id = $1 AND (uc.active OR uc.suspended)
+			RETURNING c.id, c.name, COALESCE(uc.plan_type, c.plan_type), c.aquisition_channel, c.aquisition_location,
+				COALESCE(uc.joined_at, uc.created_at)
+		`
+
+		if cancelled, err = scanMemberships(tx.QueryContext(ctx, query, userID)); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE user_audit SET details = '{}' WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		query = `UPDATE user_club SET referrer = NULL WHERE user_id = $1 AND referrer IS NOT NULL`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		if err := scrubReferrals(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		if err := eraseNotifications(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		return insertAudit(ctx, tx, userID, AuditErase, map[string]any{"cancelled_memberships": len(cancelled)})
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, nil, err
+	}
+
+	span.SetAttributes(attribute.Int64("user_id", userID), attribute.Int("cancelled", len(cancelled)))
+
+	return userID, cancelled, nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEraseUser(t *testing.T) {
+	errReset := errors.New("connection reset")
+
+	// expectErase expects the erasure statements up to the failing one, when
+	// there is one.
+	expectErase := func(mock sqlmock.Sqlmock, fail string) {
+		mock.ExpectBegin()
+		expectUser(mock, true)
+
+		mock.ExpectExec(`UPDATE users\s+SET name = '', email = 'erased-' .* referral_code = NULL`).
+			WithArgs(int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectQuery(`UPDATE user_club uc\s+SET active = false, suspended = false`).
+			WithArgs(int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "plan_type", "channel", "location", "joined_at"}).
+				AddRow(3, "Clube Capy", "premium", "online", "store", registeredAt))
+
+		steps := []struct {
+			name   string
+			expect func() *sqlmock.ExpectedExec
+		}{
+			{"user_audit", func() *sqlmock.ExpectedExec {
+				return mock.ExpectExec(`UPDATE user_audit SET details = '\{\}'`)
+			}},
+			{"user_club", func() *sqlmock.ExpectedExec {
+				return mock.ExpectExec(`UPDATE user_club SET referrer = NULL WHERE user_id = \$1`)
+			}},
+			{"referrals", func() *sqlmock.ExpectedExec {
+				return mock.ExpectExec(`UPDATE referrals\s+SET reason = CASE WHEN referred_id = \$1 THEN NULL ELSE reason END,\s+reward_coupon = CASE WHEN referrer_id = \$1`)
+			}},
+			{"notification_preferences", func() *sqlmock.ExpectedExec {
+				return mock.ExpectExec(`DELETE FROM notification_preferences WHERE user_id = \$1`)
+			}},
+			{"notifications", func() *sqlmock.ExpectedExec {
+				return mock.ExpectExec(`UPDATE notifications SET last_error = NULL WHERE user_id = \$1`)
+			}},
+			{"audit", func() *sqlmock.ExpectedExec {
+				return mock.ExpectExec(`INSERT INTO user_audit`).WithArgs(int64(7), AuditErase, `{"cancelled_memberships":1}`)
+			}},
+		}
+		for _, step := range steps {
+			e := step.expect()
+			if step.name == fail {
+				e.WillReturnError(errReset)
+				mock.ExpectRollback()
+				return
+			}
+			e.WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+
+		mock.ExpectCommit()
+	}
+
+	for _, fail := range []string{"", "user_audit", "user_club", "referrals", "notifications", "audit"} {
+		name := fail
+		if name == "" {
+			name = "erased"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			r, mock := mockRepository(t)
+			expectErase(mock, fail)
+
+			userID, cancelled, err := r.EraseUser(context.Background(), "capy@email.com")
+
+			if fail != "" {
+				if !errors.Is(err, errReset) {
+					t.Fatalf("EraseUser() error = %v, want %v", err, errReset)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if userID != 7 || len(cancelled) != 1 || cancelled[0].Club.Name != "Clube Capy" {
+					t.Errorf("EraseUser() = %d, %+v", userID, cancelled)
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AttributionService manages the registry of values allowed in the
+// attribution of a signup.
+type AttributionService struct {
+	Repo *repository.Repository
+}
+
+func (s *AttributionService) Registry(ctx context.Context) ([]entity.RegistryEntry, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "AttributionService.Registry",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+		),
+	)
+	defer span.End()
+
+	entries, err := s.Repo.AttributionRegistry(cctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RegistryByKind returns the allowed values keyed by kind, which is what
+// signup attributions are validated against.
+func (s *AttributionService) RegistryByKind(ctx context.Context) (map[string][]string, error) {
+	entries, err := s.Registry(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := make(map[string][]string, len(entity.RegistryKinds))
+	for _, e := range entries {
+		registry[e.Kind] = append(registry[e.Kind], e.Value)
+	}
+
+	return registry, nil
+}
+
+func (s *AttributionService) AddRegistryEntry(ctx context.Context, e *entity.RegistryEntry) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "AttributionService.AddRegistryEntry",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("kind", e.Kind),
+			attribute.String("value", e.Value),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.InsertRegistryEntry(cctx, e); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *AttributionService) RemoveRegistryEntry(ctx context.Context, e *entity.RegistryEntry) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "AttributionService.RemoveRegistryEntry",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("kind", e.Kind),
+			attribute.String("value", e.Value),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.DeleteRegistryEntry(cctx, e); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
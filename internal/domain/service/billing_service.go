@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/payment"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BillingService runs the billing cycle of memberships: renewing them at the
+// end of each period, keeping them in a grace period while renewals are
+// declined and expiring them when the grace period runs out.
+type BillingService struct {
+	Repo     *repository.Repository
+	Events   event.Publisher
+	Payments payment.Provider
+	// GracePeriod is how long a membership stays active after its first
+	// declined renewal.
+	GracePeriod time.Duration
+	// RetryInterval is how long after a renewal request the renewal is
+	// requested again when it did not succeed.
+	RetryInterval time.Duration
+}
+
+// ClaimRenewals returns renewal commands for up to limit memberships whose
+// period ended.
+func (s *BillingService) ClaimRenewals(ctx context.Context, limit int) ([]entity.RenewalCommand, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "BillingService.ClaimRenewals",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+		),
+	)
+	defer span.End()
+
+	commands, err := s.Repo.ClaimDueRenewals(cctx, s.RetryInterval, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return commands, nil
+}
+
+// Renew charges the next period of a membership. A declined charge moves the
+// membership to its grace period and is not an error; other payment errors
+// are returned so the command is retried. Commands for a period that was
+// renewed meanwhile are ignored.
+func (s *BillingService) Renew(ctx context.Context, cmd *entity.RenewalCommand) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "BillingService.Renew",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.Int64("membership_id", cmd.MembershipID),
+			attribute.Int("attempt", cmd.Attempt),
+		),
+	)
+	defer span.End()
+
+	sub, err := s.Repo.Subscription(cctx, cmd.MembershipID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetAttributes(attribute.String("plan_type", sub.Plan.Code), attribute.String("billing_status", sub.BillingStatus))
+
+	if !sub.Active || !sub.PeriodEnd.Equal(cmd.PeriodEnd) {
+		s.stale(cctx, span, sub)
+		return nil
+	}
+
+	// A coupon discount is taken off the first paid period. It stays pending
+	// until that period is renewed, so retries charge the same amount.
+	amount := max(sub.Plan.PriceCents-sub.DiscountCents, 0)
+	span.SetAttributes(attribute.Int64("amount_cents", amount))
+
+	if amount > 0 {
+		_, err = s.Payments.Charge(cctx, payment.Charge{
+			IdempotencyKey: fmt.Sprintf("renewal-%d-%d-%d", sub.MembershipID, cmd.PeriodEnd.Unix(), cmd.Attempt),
+			Customer:       sub.Email,
+			Amount:         amount,
+			Currency:       sub.Plan.Currency,
+			Description:    sub.Club.Name + " " + sub.Plan.Name,
+		})
+	}
+
+	if errors.Is(err, payment.ErrDeclined) {
+		return s.declined(cctx, span, sub)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	periodEnd, err := s.Repo.CompleteRenewal(cctx, sub.MembershipID, sub.PeriodEnd)
+	if errors.Is(err, repository.ErrStaleRenewal) {
+		// The charge is keyed by period, so this only happens when the
+		// membership ended while it was being charged.
+		slog.WarnContext(cctx, "Membership changed while its renewal was charged", "membership_id", sub.MembershipID)
+		s.stale(cctx, span, sub)
+		return nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetAttributes(attribute.String("billing.transition", telemetry.BillingRenewed))
+	telemetry.RecordBillingTransition(cctx, telemetry.BillingRenewed, sub.Plan.Code)
+	telemetry.RecordRevenue(cctx, amount, sub.Plan.Currency, sub.Plan.Code)
+
+	publishEvent(cctx, s.Events, event.MembershipRenewed{
+		Email:       sub.Email,
+		ClubName:    sub.Club.Name,
+		PlanType:    sub.Plan.Code,
+		AmountCents: amount,
+		Currency:    sub.Plan.Currency,
+		PeriodEnd:   periodEnd,
+		OccurredAt:  time.Now().UTC(),
+	})
+
+	return nil
+}
+
+func (s *BillingService) declined(ctx context.Context, span trace.Span, sub *entity.Subscription) error {
+	graceUntil, attempts, err := s.Repo.FailRenewal(ctx, sub.MembershipID, sub.PeriodEnd, s.GracePeriod)
+	if errors.Is(err, repository.ErrStaleRenewal) {
+		s.stale(ctx, span, sub)
+		return nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetAttributes(
+		attribute.String("billing.transition", telemetry.BillingDeclined),
+		attribute.Int("renewal_attempts", attempts),
+	)
+	telemetry.RecordBillingTransition(ctx, telemetry.BillingDeclined, sub.Plan.Code)
+
+	publishEvent(ctx, s.Events, event.MembershipPastDue{
+		Email:      sub.Email,
+		ClubName:   sub.Club.Name,
+		Attempts:   attempts,
+		GraceUntil: graceUntil,
+		OccurredAt: time.Now().UTC(),
+	})
+
+	return nil
+}
+
+func (s *BillingService) stale(ctx context.Context, span trace.Span, sub *entity.Subscription) {
+	span.SetAttributes(attribute.String("billing.transition", telemetry.BillingStale))
+	telemetry.RecordBillingTransition(ctx, telemetry.BillingStale, sub.Plan.Code)
+}
+
+// ExpireMemberships ends up to limit memberships whose grace period ran out
+// and returns how many it ended. Expirations count as cancellations in the
+// business metrics.
+func (s *BillingService) ExpireMemberships(ctx context.Context, limit int) (int, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "BillingService.ExpireMemberships",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+		),
+	)
+	defer span.End()
+
+	expired, err := s.Repo.ExpireMemberships(cctx, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	for _, sub := range expired {
+		telemetry.RecordBillingTransition(cctx, telemetry.BillingExpired, sub.Plan.Code)
+		telemetry.RecordCancellation(cctx, planOf(sub.Club), now.Sub(sub.JoinedAt))
+
+		publishEvent(cctx, s.Events, event.MembershipExpired{
+			Email:      sub.Email,
+			ClubName:   sub.Club.Name,
+			OccurredAt: now,
+		})
+	}
+
+	return len(expired), nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/internal/payment"
+)
+
+// provider is a payment provider answering every charge with err.
+type provider struct {
+	err     error
+	charged []int64
+}
+
+func (p *provider) Charge(ctx context.Context, c payment.Charge) (payment.Receipt, error) {
+	p.charged = append(p.charged, c.Amount)
+	return payment.Receipt{ID: "r1", Amount: c.Amount}, p.err
+}
+
+// expectSubscription expects the subscription of membership 11, on a plan of
+// 2990 BRL without a trial, so its first period ended when it joined.
+func expectSubscription(mock sqlmock.Sqlmock, status string) {
+	mock.ExpectQuery(`FROM user_club uc\s+JOIN users u`).
+		WithArgs(int64(11)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "club_id", "club", "channel", "location",
+			"code", "name", "price_cents", "currency", "billing_interval", "trial_days", "benefits",
+			"active", "billing_status", "joined_at", "period_end", "grace_until", "attempts", "discount_cents"}).
+			AddRow(11, "capy@email.com", 3, "Clube Capy", "online", "store",
+				"premium", "Premium", 2990, "BRL", "month", 0, "{}",
+				true, status, registeredAt, registeredAt, time.Unix(0, 0), 0, 0))
+}
+
+func TestRenew(t *testing.T) {
+	cmd := &entity.RenewalCommand{MembershipID: 11, PeriodEnd: registeredAt}
+
+	tests := []struct {
+		name      string
+		status    string
+		chargeErr error
+		expect    func(sqlmock.Sqlmock)
+		wantEvent string
+	}{
+		{
+			name:   "plan without a trial is charged in full",
+			status: entity.BillingCurrent,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE user_club uc\s+SET current_period_end = GREATEST`).
+					WithArgs(int64(11), registeredAt, entity.BillingCurrent).
+					WillReturnRows(sqlmock.NewRows([]string{"current_period_end"}).AddRow(registeredAt.AddDate(0, 1, 0)))
+			},
+			wantEvent: event.MembershipRenewedKey,
+		},
+		{
+			name:      "declined moves to grace",
+			status:    entity.BillingCurrent,
+			chargeErr: payment.ErrDeclined,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE user_club\s+SET billing_status = \$3`).
+					WithArgs(int64(11), registeredAt, entity.BillingGrace, float64(72*3600)).
+					WillReturnRows(sqlmock.NewRows([]string{"grace_until", "renewal_attempts"}).
+						AddRow(registeredAt.Add(72*time.Hour), 1))
+			},
+			wantEvent: event.MembershipPastDueKey,
+		},
+		{
+			name:      "declined again keeps the grace period",
+			status:    entity.BillingGrace,
+			chargeErr: payment.ErrDeclined,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE user_club\s+SET billing_status = \$3`).
+					WillReturnRows(sqlmock.NewRows([]string{"grace_until", "renewal_attempts"}).
+						AddRow(registeredAt.Add(72*time.Hour), 2))
+			},
+			wantEvent: event.MembershipPastDueKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := mockRepository(t)
+			expectSubscription(mock, tt.status)
+			tt.expect(mock)
+
+			p := &provider{err: tt.chargeErr}
+			var events published
+			s := &BillingService{Repo: repo, Events: &events, Payments: p, GracePeriod: 72 * time.Hour}
+
+			if err := s.Renew(context.Background(), cmd); err != nil {
+				t.Fatalf("Renew() error = %v", err)
+			}
+
+			if len(p.charged) != 1 || p.charged[0] != 2990 {
+				t.Errorf("charged %v, want 2990 once", p.charged)
+			}
+			if len(events) != 1 || events[0].RoutingKey() != tt.wantEvent {
+				t.Errorf("published %v, want a %s event", events, tt.wantEvent)
+			}
+			if e, ok := events[0].(event.MembershipPastDue); ok && e.GraceUntil.IsZero() {
+				t.Errorf("past due event without the end of the grace period")
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestExpireMemberships(t *testing.T) {
+	repo, mock := mockRepository(t)
+
+	mock.ExpectQuery(`UPDATE user_club uc\s+SET active = false, billing_status = \$2`).
+		WithArgs(entity.BillingGrace, entity.BillingExpired, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "club_id", "club", "plan_type", "channel", "location", "joined_at", "attempts"}).
+			AddRow(11, "capy@email.com", 3, "Clube Capy", "premium", "online", "store", registeredAt, 3))
+
+	var events published
+	s := &BillingService{Repo: repo, Events: &events}
+
+	n, err := s.ExpireMemberships(context.Background(), 100)
+	if err != nil || n != 1 {
+		t.Fatalf("ExpireMemberships() = %d, %v, want 1 expired", n, err)
+	}
+	if len(events) != 1 || events[0].RoutingKey() != event.MembershipExpiredKey || events[0].Subject() != "capy@email.com" {
+		t.Errorf("published %v, want an expired event for capy@email.com", events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,16 +2,24 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
 	"github.com/hazkall/capy-belga/internal/domain/repository"
 	"github.com/hazkall/capy-belga/pkg/telemetry"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type ClubService struct {
-	Repo *repository.Repository
+	Repo   *repository.Repository
+	Events event.Publisher
+	// PlanChangePolicy is applied to the current members of a club whose
+	// plan type changes, unless the update asks for another one. Empty means
+	// entity.PlanChangeMigrate.
+	PlanChangePolicy string
 }
 
 func (s *ClubService) CreateClub(ctx context.Context, club *entity.Club) error {
@@ -26,5 +34,158 @@ func (s *ClubService) CreateClub(ctx context.Context, club *entity.Club) error {
 	)
 	defer span.End()
 
-	return s.Repo.InsertClub(cctx, club)
+	if err := s.Repo.InsertClub(cctx, club); err != nil {
+		return err
+	}
+
+	publishEvent(cctx, s.Events, event.ClubCreated{
+		Name:               club.Name,
+		PlanType:           club.PlanType,
+		AquisitionChannel:  club.AquisitionChannel,
+		AquisitionLocation: club.AquisitionLocation,
+		OccurredAt:         time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// UpdateClub changes the fields of a club that are set in update and returns
+// the updated club.
+func (s *ClubService) UpdateClub(ctx context.Context, update *entity.ClubUpdate) (*entity.Club, error) {
+
+	policy := update.PlanChangePolicy
+	if policy == "" {
+		policy = s.PlanChangePolicy
+	}
+	if policy == "" {
+		policy = entity.PlanChangeMigrate
+	}
+
+	cctx, span := telemetry.Tracer.Start(ctx, "ClubService.UpdateClub",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("club_name", update.Name),
+			attribute.String("plan_change_policy", policy),
+		),
+	)
+	defer span.End()
+
+	club, previousPlanType, err := s.Repo.UpdateClub(cctx, update, policy)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	updated := event.ClubUpdated{
+		Name:               club.Name,
+		Description:        club.Description,
+		PlanType:           club.PlanType,
+		AquisitionChannel:  club.AquisitionChannel,
+		AquisitionLocation: club.AquisitionLocation,
+		OccurredAt:         time.Now().UTC(),
+	}
+	if previousPlanType != club.PlanType {
+		updated.PreviousPlanType = previousPlanType
+		updated.PlanChangePolicy = policy
+	}
+
+	publishEvent(cctx, s.Events, updated)
+
+	return club, nil
+}
+
+// ArchiveClub archives a club, which then rejects new signups while keeping
+// its memberships.
+func (s *ClubService) ArchiveClub(ctx context.Context, name string) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "ClubService.ArchiveClub",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("club_name", name),
+		),
+	)
+	defer span.End()
+
+	club, err := s.Repo.ArchiveClub(cctx, name)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	publishEvent(cctx, s.Events, event.ClubArchived{
+		Name:       club.Name,
+		OccurredAt: time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// ClubMembers lists a page of the members of a club, which the query must
+// have been validated for, and counts all of them per state.
+func (s *ClubService) ClubMembers(ctx context.Context, q *entity.ClubMembersQuery) (*entity.ClubMembers, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "ClubService.ClubMembers",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("club_name", q.Name),
+		),
+	)
+	defer span.End()
+
+	var after *entity.MemberCursor
+	if q.Cursor != "" {
+		var err error
+		if after, err = entity.ParseMemberCursor(q.Cursor); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	clubID, err := s.Repo.GetClubID(cctx, q.Name)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	members, next, err := s.Repo.ClubMembers(cctx, clubID, q.Limit, after)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	counts, err := s.Repo.ClubMemberCounts(cctx, clubID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if members == nil {
+		members = []entity.ClubMember{}
+	}
+
+	result := &entity.ClubMembers{
+		Club: q.Name,
+		Counts: map[string]int{
+			entity.MemberActive:    0,
+			entity.MemberGrace:     0,
+			entity.MemberSuspended: 0,
+			entity.MemberExpired:   0,
+			entity.MemberCancelled: 0,
+		},
+		Members: members,
+	}
+	for state, n := range counts {
+		result.Counts[state] = n
+	}
+	if next != nil {
+		result.NextCursor = next.String()
+	}
+
+	return result, nil
 }
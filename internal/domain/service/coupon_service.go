@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CouponService manages the coupons redeemed at signup. Redemption itself
+// happens in the signup transaction.
+type CouponService struct {
+	Repo *repository.Repository
+}
+
+func (s *CouponService) ListCoupons(ctx context.Context) ([]entity.Coupon, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "CouponService.ListCoupons",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+		),
+	)
+	defer span.End()
+
+	coupons, err := s.Repo.ListCoupons(cctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return coupons, nil
+}
+
+func (s *CouponService) GetCoupon(ctx context.Context, code string) (*entity.Coupon, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "CouponService.GetCoupon",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("coupon_code", code),
+		),
+	)
+	defer span.End()
+
+	coupon, err := s.Repo.GetCoupon(cctx, code)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return coupon, nil
+}
+
+func (s *CouponService) CreateCoupon(ctx context.Context, coupon *entity.Coupon) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "CouponService.CreateCoupon",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("coupon_code", coupon.Code),
+			attribute.String("discount_type", coupon.DiscountType),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.InsertCoupon(cctx, coupon); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
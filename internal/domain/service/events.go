@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// publishEvent publishes e after a successful write. The write is already
+// committed at this point, so a failed publish is logged and recorded on the
+// span instead of failing the operation and triggering a redelivery. With an
+// OutboxPublisher that only happens when the outbox can't be written either.
+func publishEvent(ctx context.Context, p event.Publisher, e event.Event) {
+	if p == nil {
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+
+	if err := p.Publish(ctx, e); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish domain event", "routing_key", e.RoutingKey(), "error", err)
+		span.RecordError(err, trace.WithAttributes(attribute.String("event.routing_key", e.RoutingKey())))
+		return
+	}
+
+	span.AddEvent("domain event published", trace.WithAttributes(attribute.String("event.routing_key", e.RoutingKey())))
+}
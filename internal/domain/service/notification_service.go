@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/notify"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNotificationFailed is returned when a notification was given up on,
+// because a channel rejected it or it ran out of attempts.
+var ErrNotificationFailed = errors.New("notification failed")
+
+// NotificationService notifies users of the domain events about them, in
+// their locale and on the channels they chose among Channels.
+type NotificationService struct {
+	Repo      *repository.Repository
+	Channels  []notify.Channel
+	Templates *notify.Templates
+	// MaxAttempts is how many times a notification is sent on a channel
+	// before it is given up on.
+	MaxAttempts int
+	// RetryBackoff is how long a channel waits after the first failed
+	// attempt. The wait doubles after each attempt.
+	RetryBackoff time.Duration
+}
+
+// maxNotificationBackoff caps the doubling wait between attempts.
+const maxNotificationBackoff = 6 * time.Hour
+
+// retryAfterError is a transient failure that is only worth retrying after a
+// while. The consumer delays the redelivery of the event accordingly.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string             { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error             { return e.err }
+func (e *retryAfterError) RetryAfter() time.Duration { return e.after }
+
+// Notify sends the notification of e to the user it is about. Events without
+// a template, and events about users that no longer exist, are skipped.
+// A notification already sent on a channel is not sent again there, so a
+// redelivered event only retries the channels that failed, once their
+// backoff is over.
+func (s *NotificationService) Notify(ctx context.Context, e *notify.Event) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "NotificationService.Notify",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("event_id", e.ID),
+			attribute.String("notification.kind", e.Kind),
+		),
+	)
+	defer span.End()
+
+	email := e.Recipient()
+	if !s.Templates.Has(e.Kind) || email == "" {
+		span.SetAttributes(attribute.Bool("notification.skipped", true))
+		return nil
+	}
+
+	span.SetAttributes(telemetry.EmailAttribute(email))
+
+	recipient, err := s.Repo.NotificationRecipient(cctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		span.SetAttributes(attribute.Bool("notification.skipped", true))
+		return nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	prefs := s.preferencesOf(recipient)
+
+	data := maps.Clone(e.Data)
+	data["name"] = recipient.Name
+
+	subject, body, err := s.Templates.Render(prefs.Locale, e.Kind, data)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrNotificationFailed, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	msg := notify.Message{
+		ID:      e.ID,
+		Kind:    e.Kind,
+		Locale:  prefs.Locale,
+		To:      recipient.Email,
+		Name:    recipient.Name,
+		Subject: subject,
+		Body:    body,
+	}
+
+	// Transient errors are returned over failures, so the event is
+	// redelivered while any channel can still succeed.
+	var retry, failed []error
+
+	for _, ch := range s.Channels {
+		if !slices.Contains(prefs.Channels, ch.Name()) {
+			continue
+		}
+
+		err := s.deliver(cctx, ch, recipient.UserID, msg)
+		switch {
+		case errors.Is(err, ErrNotificationFailed):
+			failed = append(failed, err)
+		case err != nil:
+			retry = append(retry, err)
+		}
+	}
+
+	err = errors.Join(failed...)
+	if len(retry) > 0 {
+		err = errors.Join(retry...)
+		if after, ok := soonestRetry(retry); ok {
+			err = &retryAfterError{err: err, after: after}
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *NotificationService) deliver(ctx context.Context, ch notify.Channel, userID int64, msg notify.Message) error {
+	attempt, wait, err := s.Repo.ClaimNotification(ctx, msg.ID, ch.Name(), userID, msg.Kind)
+	if errors.Is(err, repository.ErrNotificationDone) {
+		telemetry.RecordNotification(ctx, ch.Name(), msg.Kind, telemetry.NotificationDuplicate, 0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &retryAfterError{err: fmt.Errorf("notification on %s is backing off", ch.Name()), after: wait}
+	}
+
+	start := time.Now()
+	sendErr := ch.Send(ctx, msg)
+	took := time.Since(start)
+
+	status, outcome := entity.NotificationSent, telemetry.NotificationSent
+	switch {
+	case sendErr == nil:
+	case errors.Is(sendErr, notify.ErrRejected) || attempt >= s.MaxAttempts:
+		status, outcome = entity.NotificationFailed, telemetry.NotificationFailed
+	default:
+		status, outcome = entity.NotificationPending, telemetry.NotificationRetried
+	}
+
+	telemetry.RecordNotification(ctx, ch.Name(), msg.Kind, outcome, took)
+
+	backoff := s.backoff(attempt)
+
+	// A failure to store the outcome of a sent notification only means it
+	// is sent again on redelivery.
+	if err := s.Repo.FinishNotificationAttempt(ctx, msg.ID, ch.Name(), status, sendErr, backoff); err != nil {
+		return err
+	}
+
+	if status == entity.NotificationFailed {
+		return fmt.Errorf("%w on %s after %d attempts: %w", ErrNotificationFailed, ch.Name(), attempt, sendErr)
+	}
+	if sendErr != nil {
+		return &retryAfterError{err: sendErr, after: backoff}
+	}
+
+	return nil
+}
+
+// backoff is how long a channel waits after its attempt-th failed attempt.
+func (s *NotificationService) backoff(attempt int) time.Duration {
+	wait := s.RetryBackoff
+	for i := 1; i < attempt && wait < maxNotificationBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxNotificationBackoff)
+}
+
+// soonestRetry returns when the first of errs is worth retrying, if every
+// one of them says.
+func soonestRetry(errs []error) (time.Duration, bool) {
+	var soonest time.Duration
+
+	for i, err := range errs {
+		var r *retryAfterError
+		if !errors.As(err, &r) {
+			return 0, false
+		}
+		if i == 0 || r.after < soonest {
+			soonest = r.after
+		}
+	}
+
+	return soonest, true
+}
+
+// preferencesOf returns the preferences of recipient, defaulting to the
+// default locale on every channel of the service.
+func (s *NotificationService) preferencesOf(recipient *entity.NotificationRecipient) *entity.NotificationPreferences {
+	if recipient.Preferences != nil {
+		return recipient.Preferences
+	}
+
+	prefs := &entity.NotificationPreferences{Locale: entity.DefaultLocale, Channels: []string{}}
+	for _, ch := range s.Channels {
+		prefs.Channels = append(prefs.Channels, ch.Name())
+	}
+
+	return prefs
+}
+
+// Preferences returns the notification preferences of the user with email,
+// the defaults when they never set any.
+func (s *NotificationService) Preferences(ctx context.Context, email string) (*entity.NotificationPreferences, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "NotificationService.Preferences",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	recipient, err := s.Repo.NotificationRecipient(cctx, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	prefs := *s.preferencesOf(recipient)
+	prefs.Email = recipient.Email
+
+	return &prefs, nil
+}
+
+func (s *NotificationService) SavePreferences(ctx context.Context, prefs *entity.NotificationPreferences) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "NotificationService.SavePreferences",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(prefs.Email),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.SaveNotificationPreferences(cctx, prefs); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/notify"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+func TestMain(m *testing.M) {
+	telemetry.Tracer = tracenoop.NewTracerProvider().Tracer("test")
+	telemetry.Meter = metricnoop.NewMeterProvider().Meter("test")
+
+	if err := telemetry.MetricsStart(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+// mockRepository returns a repository on a mock database that expects the
+// statements in the order they are declared.
+func mockRepository(t *testing.T) (*repository.Repository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return repository.New(&db.Postgres{DB: conn}), mock
+}
+
+// channel is a notification channel failing with err.
+type channel struct {
+	err  error
+	sent int
+}
+
+func (c *channel) Name() string { return entity.NotifyEmail }
+
+func (c *channel) Send(ctx context.Context, m notify.Message) error {
+	c.sent++
+	return c.err
+}
+
+func TestNotifyBacksOff(t *testing.T) {
+	templates, err := notify.LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smtpDown := errors.New("smtp down")
+	rejected := fmt.Errorf("%w: no such mailbox", notify.ErrRejected)
+
+	tests := []struct {
+		name       string
+		sendErr    error
+		attempt    int
+		wait       float64
+		wantSent   int
+		wantStatus string
+		wantRetry  time.Duration
+		wantFailed bool
+	}{
+		{name: "sent", attempt: 1, wantSent: 1, wantStatus: entity.NotificationSent},
+		{
+			name:       "first failure is retried after the backoff",
+			sendErr:    smtpDown,
+			attempt:    1,
+			wantSent:   1,
+			wantStatus: entity.NotificationPending,
+			wantRetry:  time.Minute,
+		},
+		{
+			name:       "backoff doubles",
+			sendErr:    smtpDown,
+			attempt:    3,
+			wantSent:   1,
+			wantStatus: entity.NotificationPending,
+			wantRetry:  4 * time.Minute,
+		},
+		{name: "still backing off", attempt: 2, wait: 90, wantRetry: 90 * time.Second},
+		{
+			name:       "attempts exhausted",
+			sendErr:    smtpDown,
+			attempt:    5,
+			wantSent:   1,
+			wantStatus: entity.NotificationFailed,
+			wantFailed: true,
+		},
+		{
+			name:       "rejected",
+			sendErr:    rejected,
+			attempt:    1,
+			wantSent:   1,
+			wantStatus: entity.NotificationFailed,
+			wantFailed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := mockRepository(t)
+			ch := &channel{err: tt.sendErr}
+
+			s := &NotificationService{
+				Repo:         repo,
+				Channels:     []notify.Channel{ch},
+				Templates:    templates,
+				MaxAttempts:  5,
+				RetryBackoff: time.Minute,
+			}
+
+			mock.ExpectQuery(`FROM users u\s+LEFT JOIN notification_preferences`).
+				WithArgs("capy@email.com").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "custom", "locale", "channels"}).
+					AddRow(7, "capy@email.com", "Capy", false, "", "{}"))
+			mock.ExpectQuery(`INSERT INTO notifications`).
+				WithArgs("e1", entity.NotifyEmail, int64(7), event.MembershipCancelledKey, entity.NotificationPending).
+				WillReturnRows(sqlmock.NewRows([]string{"attempts", "wait"}).AddRow(tt.attempt, tt.wait))
+			if tt.wantStatus != "" {
+				mock.ExpectExec(`UPDATE notifications\s+SET status = \$3`).
+					WithArgs("e1", entity.NotifyEmail, tt.wantStatus, sqlmock.AnyArg(), entity.NotificationSent,
+						entity.NotificationPending, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			err := s.Notify(context.Background(), &notify.Event{
+				ID:   "e1",
+				Kind: event.MembershipCancelledKey,
+				Data: map[string]any{"email": "capy@email.com", "club": "Clube Capy", "plan_type": "premium"},
+			})
+
+			if errors.Is(err, ErrNotificationFailed) != tt.wantFailed {
+				t.Errorf("Notify() error = %v, want failed %t", err, tt.wantFailed)
+			}
+
+			var after interface{ RetryAfter() time.Duration }
+			switch {
+			case tt.wantRetry == 0 && errors.As(err, &after):
+				t.Errorf("Notify() asks for a retry after %s", after.RetryAfter())
+			case tt.wantRetry != 0 && !errors.As(err, &after):
+				t.Errorf("Notify() error = %v, want a retry after %s", err, tt.wantRetry)
+			case tt.wantRetry != 0 && after.RetryAfter() != tt.wantRetry:
+				t.Errorf("RetryAfter() = %s, want %s", after.RetryAfter(), tt.wantRetry)
+			}
+
+			if ch.sent != tt.wantSent {
+				t.Errorf("sent %d times, want %d", ch.sent, tt.wantSent)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
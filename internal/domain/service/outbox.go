@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OutboxPublisher publishes events with Publisher and keeps the ones the
+// broker doesn't take in the outbox, for Relay to publish later. Each event
+// gets its ID before the first attempt, so a publication that reached the
+// broker despite failing is dropped as a duplicate when it is relayed.
+type OutboxPublisher struct {
+	Publisher event.Publisher
+	Repo      *repository.Repository
+}
+
+// Publish publishes e, or keeps it in the outbox when that fails. It only
+// fails when the outbox can't be written either.
+func (p *OutboxPublisher) Publish(ctx context.Context, e event.Event) error {
+	enc, err := event.Encode(e)
+	if err != nil {
+		return err
+	}
+
+	err = p.Publisher.Publish(ctx, enc)
+	if err == nil {
+		return nil
+	}
+
+	if oerr := p.Repo.InsertOutboxEvent(ctx, enc, err); oerr != nil {
+		return errors.Join(err, oerr)
+	}
+
+	slog.WarnContext(ctx, "Domain event kept in the outbox", "routing_key", enc.Key, "event_id", enc.ID, "error", err)
+	trace.SpanFromContext(ctx).AddEvent("domain event kept in the outbox", trace.WithAttributes(
+		attribute.String("event.routing_key", enc.Key),
+		attribute.String("event.id", enc.ID),
+	))
+
+	return nil
+}
+
+// Relay publishes up to limit events of the outbox and returns how many were
+// published. It stops at the first failure, which leaves that event and the
+// rest of the batch for a claim after retryAfter.
+func (p *OutboxPublisher) Relay(ctx context.Context, retryAfter time.Duration, limit int) (int, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "OutboxPublisher.Relay",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+		),
+	)
+	defer span.End()
+
+	events, err := p.Repo.ClaimOutboxEvents(cctx, retryAfter, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, err
+	}
+
+	published := 0
+	for i := range events {
+		e := &events[i]
+
+		perr := p.Publisher.Publish(cctx, e)
+		if err := p.Repo.FinishOutboxEvent(cctx, e.ID, perr); err != nil {
+			perr = errors.Join(perr, err)
+		}
+		if perr != nil {
+			span.RecordError(perr)
+			span.SetStatus(codes.Error, perr.Error())
+			return published, perr
+		}
+
+		published++
+	}
+
+	span.SetAttributes(attribute.Int("published", published))
+
+	return published, nil
+}
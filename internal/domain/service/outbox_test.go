@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/hazkall/capy-belga/internal/domain/event"
+)
+
+// broker is an event publisher failing with err and recording the IDs of
+// the events it takes.
+type broker struct {
+	err error
+	ids []string
+}
+
+func (b *broker) Publish(ctx context.Context, e event.Event) error {
+	if b.err != nil {
+		return b.err
+	}
+	enc, err := event.Encode(e)
+	if err != nil {
+		return err
+	}
+	b.ids = append(b.ids, enc.ID)
+	return nil
+}
+
+var rejectedEvent = event.MembershipRejected{ID: "rejection-m1", Email: "capy@email.com", ClubName: "Clube Capy"}
+
+func TestOutboxPublisherPublish(t *testing.T) {
+	brokerDown := errors.New("broker down")
+	dbDown := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		brokerErr error
+		outboxErr error
+		wantErr   bool
+	}{
+		{name: "published"},
+		{name: "kept in the outbox", brokerErr: brokerDown},
+		{name: "outbox down too", brokerErr: brokerDown, outboxErr: dbDown, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := mockRepository(t)
+			b := &broker{err: tt.brokerErr}
+
+			if tt.brokerErr != nil {
+				e := mock.ExpectExec(`INSERT INTO outbox`).
+					WithArgs("rejection-m1", event.MembershipRejectedKey, "capy@email.com", sqlmock.AnyArg(), "broker down")
+				if tt.outboxErr != nil {
+					e.WillReturnError(tt.outboxErr)
+				} else {
+					e.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+
+			err := (&OutboxPublisher{Publisher: b, Repo: repo}).Publish(context.Background(), rejectedEvent)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOutboxPublisherRelay(t *testing.T) {
+	columns := []string{"event_id", "routing_key", "subject", "payload"}
+	payload := []byte(`{"email":"capy@email.com","club":"Clube Capy"}`)
+
+	t.Run("publishes under the stored ID", func(t *testing.T) {
+		repo, mock := mockRepository(t)
+		b := &broker{}
+
+		mock.ExpectQuery(`UPDATE outbox\s+SET attempts = attempts \+ 1`).
+			WithArgs(float64(60), 10).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("e1", event.MembershipActivatedKey, "capy@email.com", payload).
+				AddRow("e2", event.MembershipCancelledKey, "capy@email.com", payload))
+		mock.ExpectExec(`DELETE FROM outbox WHERE event_id = \$1`).WithArgs("e1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM outbox WHERE event_id = \$1`).WithArgs("e2").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		n, err := (&OutboxPublisher{Publisher: b, Repo: repo}).Relay(context.Background(), time.Minute, 10)
+		if err != nil || n != 2 {
+			t.Fatalf("Relay() = %d, %v, want 2 published", n, err)
+		}
+		if len(b.ids) != 2 || b.ids[0] != "e1" || b.ids[1] != "e2" {
+			t.Errorf("published %v, want [e1 e2]", b.ids)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("stops at the first failure", func(t *testing.T) {
+		repo, mock := mockRepository(t)
+		b := &broker{err: errors.New("broker down")}
+
+		mock.ExpectQuery(`UPDATE outbox\s+SET attempts = attempts \+ 1`).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("e1", event.MembershipActivatedKey, "capy@email.com", payload).
+				AddRow("e2", event.MembershipCancelledKey, "capy@email.com", payload))
+		mock.ExpectExec(`UPDATE outbox SET last_error = \$2 WHERE event_id = \$1`).
+			WithArgs("e1", "broker down").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		n, err := (&OutboxPublisher{Publisher: b, Repo: repo}).Relay(context.Background(), time.Minute, 10)
+		if err == nil || n != 0 {
+			t.Errorf("Relay() = %d, %v, want a failure with none published", n, err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PartnerService manages the partner merchants, the benefits they offer to
+// club members and the redemptions of those benefits.
+type PartnerService struct {
+	Repo   *repository.Repository
+	Events event.Publisher
+}
+
+func (s *PartnerService) CreatePartner(ctx context.Context, partner *entity.Partner) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PartnerService.CreatePartner",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("partner", partner.Name),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.InsertPartner(cctx, partner); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *PartnerService) ListPartners(ctx context.Context) ([]entity.Partner, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PartnerService.ListPartners",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+		),
+	)
+	defer span.End()
+
+	partners, err := s.Repo.ListPartners(cctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return partners, nil
+}
+
+func (s *PartnerService) CreateBenefit(ctx context.Context, benefit *entity.Benefit) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PartnerService.CreateBenefit",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("benefit", benefit.Code),
+			attribute.String("partner", benefit.Partner),
+			attribute.String("club_name", benefit.Club),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.InsertBenefit(cctx, benefit); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ListBenefits returns the benefits of the club named club, or of every club
+// when club is empty.
+func (s *PartnerService) ListBenefits(ctx context.Context, club string) ([]entity.Benefit, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PartnerService.ListBenefits",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("club_name", club),
+		),
+	)
+	defer span.End()
+
+	benefits, err := s.Repo.ListBenefits(cctx, club)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return benefits, nil
+}
+
+// RedeemBenefit records that a member used the benefit with code at the
+// partner of req.
+func (s *PartnerService) RedeemBenefit(ctx context.Context, code string, req *entity.BenefitRedemptionRequest) (*entity.BenefitRedemption, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PartnerService.RedeemBenefit",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("benefit", code),
+			attribute.String("partner", req.Partner),
+			telemetry.EmailAttribute(req.Email),
+		),
+	)
+	defer span.End()
+
+	redemption, err := s.Repo.RedeemBenefit(cctx, code, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("club_name", redemption.Club))
+	telemetry.RecordBenefitRedemption(cctx, redemption.Partner, redemption.Club, redemption.Benefit)
+
+	publishEvent(cctx, s.Events, event.BenefitRedeemed{
+		Email:      req.Email,
+		ClubName:   redemption.Club,
+		Partner:    redemption.Partner,
+		Benefit:    redemption.Benefit,
+		OccurredAt: time.Now().UTC(),
+	})
+
+	return redemption, nil
+}
+
+func (s *PartnerService) MemberRedemptions(ctx context.Context, email string) ([]entity.BenefitRedemption, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PartnerService.MemberRedemptions",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	redemptions, err := s.Repo.MemberRedemptions(cctx, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return redemptions, nil
+}
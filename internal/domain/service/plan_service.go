@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PlanService manages the plan catalogue clubs pick their plan type from.
+type PlanService struct {
+	Repo *repository.Repository
+}
+
+func (s *PlanService) ListPlans(ctx context.Context) ([]entity.Plan, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PlanService.ListPlans",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+		),
+	)
+	defer span.End()
+
+	plans, err := s.Repo.ListPlans(cctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// PlanCodes returns the codes of the catalogue, which are the valid plan
+// types of a club.
+func (s *PlanService) PlanCodes(ctx context.Context) ([]string, error) {
+	plans, err := s.ListPlans(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	planCodes := make([]string, 0, len(plans))
+	for _, p := range plans {
+		planCodes = append(planCodes, p.Code)
+	}
+
+	return planCodes, nil
+}
+
+func (s *PlanService) GetPlan(ctx context.Context, code string) (*entity.Plan, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PlanService.GetPlan",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("plan_code", code),
+		),
+	)
+	defer span.End()
+
+	plan, err := s.Repo.GetPlan(cctx, code)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func (s *PlanService) CreatePlan(ctx context.Context, plan *entity.Plan) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PlanService.CreatePlan",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("plan_code", plan.Code),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.InsertPlan(cctx, plan); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *PlanService) UpdatePlan(ctx context.Context, plan *entity.Plan) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PlanService.UpdatePlan",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("plan_code", plan.Code),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.UpdatePlan(cctx, plan); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// DeletePlan removes a plan no club or membership refers to.
+func (s *PlanService) DeletePlan(ctx context.Context, code string) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "PlanService.DeletePlan",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			attribute.String("plan_code", code),
+		),
+	)
+	defer span.End()
+
+	if err := s.Repo.DeletePlan(cctx, code); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
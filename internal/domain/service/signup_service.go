@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"strings"
+	"time"
 
+	"github.com/hazkall/capy-belga/internal/db"
 	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
 	"github.com/hazkall/capy-belga/internal/domain/repository"
 	"github.com/hazkall/capy-belga/pkg/telemetry"
 	"go.opentelemetry.io/otel/attribute"
@@ -13,33 +17,33 @@ import (
 )
 
 type SignupService struct {
-	Repo *repository.Repository
+	Repo   *repository.Repository
+	Events event.Publisher
+	// ReferralReward is given to the referrer of a user on the user's first
+	// signup.
+	ReferralReward entity.ReferralReward
 }
 
-func (s *SignupService) UserClubStatus(ctx context.Context, signup *entity.SignupPayload) (bool, string, error) {
+// UserClubStatus returns whether the user has an active membership and the
+// plan of that membership, or of the most recent one. The plan is nil for a
+// user who never signed up.
+func (s *SignupService) UserClubStatus(ctx context.Context, signup *entity.SignupPayload) (bool, *entity.Plan, error) {
 
 	cctx, span := telemetry.Tracer.Start(ctx, "SignupService.UserClubStatus",
 		trace.WithAttributes(
 			attribute.String("entity", "service"),
-			attribute.String("email", signup.Email),
+			telemetry.EmailAttribute(signup.Email),
 			attribute.String("club_name", signup.ClubName),
 		),
 	)
 
 	defer span.End()
 
-	userId, err := s.Repo.GetUserID(cctx, signup.Email)
+	active, plan, err := s.Repo.UserPlanStatus(cctx, signup.Email)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return false, "", err
-	}
-
-	active, plan, err := s.Repo.UserPlanStatus(cctx, userId)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return false, "", err
+		return false, nil, err
 	}
 
 	return active, plan, nil
@@ -50,61 +54,194 @@ func (s *SignupService) SignupUser(ctx context.Context, signup *entity.SignupPay
 	cctx, span := telemetry.Tracer.Start(ctx, "SignupService.SignupUser",
 		trace.WithAttributes(
 			attribute.String("entity", "service"),
-			attribute.String("email", signup.Email),
+			telemetry.EmailAttribute(signup.Email),
 			attribute.String("club_name", signup.ClubName),
 		),
 	)
 
 	defer span.End()
 
-	clubID, userID, err := s.Repo.GetUserIdClubID(cctx, signup.Email, signup.ClubName)
+	membership, err := s.Repo.SignupUserClub(cctx, signup, s.ReferralReward)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+		telemetry.RecordSignupFailure(cctx, signupFailureReason(err))
 		return err
 	}
-	active, err := s.Repo.UserState(cctx, userID)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return err
+
+	a := membership.Attribution
+	span.SetAttributes(
+		attribute.String("aquisition_channel", a.Channel),
+		attribute.String("aquisition_location", a.Location),
+		attribute.String("store_id", a.StoreID),
+		attribute.String("utm_source", a.UTMSource),
+		attribute.String("utm_medium", a.UTMMedium),
+		attribute.String("utm_campaign", a.UTMCampaign),
+	)
+	if a.Referrer != "" {
+		// The referrer may carry personal data in its path or query.
+		span.SetAttributes(attribute.String("referrer_hash", telemetry.HashPII(a.Referrer)))
+	}
+
+	telemetry.RecordSignup(cctx, signupPlan(membership), membership.First, membership.JoinedAt.Sub(membership.UserRegisteredAt))
+
+	activated := event.MembershipActivated{
+		Email:      signup.Email,
+		ClubName:   signup.ClubName,
+		OccurredAt: time.Now().UTC(),
 	}
-	if !active {
-		span.RecordError(fmt.Errorf("user %d is not active", userID))
-		span.SetStatus(codes.Error, fmt.Errorf("user %d is not active", userID).Error())
-		return fmt.Errorf("user %d is not active", userID)
+
+	if c := membership.Coupon; c != nil {
+		telemetry.RecordCouponRedemption(cctx, couponMetricCode(c.Code), membership.Club.PlanType, c.DiscountCents, c.Currency)
+		activated.Coupon = c.Code
+		activated.DiscountCents = c.DiscountCents
+		activated.Currency = c.Currency
 	}
-	return s.Repo.InsertUserClub(cctx, userID, clubID)
+
+	publishEvent(cctx, s.Events, activated)
+
+	if g := membership.Referral; g != nil {
+		span.SetAttributes(attribute.String("referral.reward", g.Type))
+		telemetry.RecordReferral(cctx, telemetry.ReferralRewarded, "")
+
+		publishEvent(cctx, s.Events, event.ReferralRewarded{
+			ReferrerEmail: g.ReferrerEmail,
+			Reward:        g.Type,
+			Days:          g.Days,
+			CouponCode:    g.CouponCode,
+			OccurredAt:    activated.OccurredAt,
+		})
+	}
+
+	return nil
 }
 
-func (s *SignupService) CancelSignup(ctx context.Context, signup *entity.SignupPayload) error {
+// RejectSignup tells the user that the signup failed with err and will not be
+// retried. id identifies the signup, so rejecting it again, as when its
+// message is redelivered, doesn't notify the user twice.
+func (s *SignupService) RejectSignup(ctx context.Context, signup *entity.SignupPayload, id string, err error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "SignupService.RejectSignup",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(signup.Email),
+			attribute.String("club_name", signup.ClubName),
+		),
+	)
+
+	defer span.End()
+
+	publishEvent(cctx, s.Events, event.MembershipRejected{
+		ID:         rejectionID(id),
+		Email:      signup.Email,
+		ClubName:   signup.ClubName,
+		Reason:     signupFailureReason(err),
+		OccurredAt: time.Now().UTC(),
+	})
+}
+
+// rejectionID is the ID of the event rejecting the signup id, none when the
+// signup has no ID.
+func rejectionID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return "rejection-" + id
+}
+
+// ErrNoActiveMembership is returned when a cancellation finds nothing to
+// cancel.
+var ErrNoActiveMembership = errors.New("no active membership")
+
+// CancelSignup cancels the active memberships of the user and returns the
+// clubs that were cancelled.
+func (s *SignupService) CancelSignup(ctx context.Context, signup *entity.SignupPayload) ([]entity.Club, error) {
 
 	cctx, span := telemetry.Tracer.Start(ctx, "SignupService.CancelSignup",
 		trace.WithAttributes(
 			attribute.String("entity", "service"),
-			attribute.String("email", signup.Email),
+			telemetry.EmailAttribute(signup.Email),
 		),
 	)
 
 	defer span.End()
 
-	userID, err := s.Repo.GetUserID(cctx, signup.Email)
+	memberships, err := s.Repo.CancelUserClub(cctx, signup.Email)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return err
+		return nil, err
 	}
-	active, err := s.Repo.UserState(cctx, userID)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		return err
+
+	if len(memberships) == 0 {
+		span.RecordError(ErrNoActiveMembership)
+		span.SetStatus(codes.Error, ErrNoActiveMembership.Error())
+		return nil, ErrNoActiveMembership
 	}
 
-	if !active {
-		span.RecordError(fmt.Errorf("user %d is not active", userID))
-		span.SetStatus(codes.Error, fmt.Errorf("user %d is not active", userID).Error())
-		return fmt.Errorf("user %d is not active", userID)
+	now := time.Now().UTC()
+
+	clubs := make([]entity.Club, 0, len(memberships))
+	for _, m := range memberships {
+		telemetry.RecordCancellation(cctx, planOf(m.Club), now.Sub(m.JoinedAt))
+		clubs = append(clubs, m.Club)
+
+		publishEvent(cctx, s.Events, event.MembershipCancelled{
+			Email:      signup.Email,
+			ClubName:   m.Club.Name,
+			PlanType:   m.Club.PlanType,
+			OccurredAt: now,
+		})
+	}
+
+	return clubs, nil
+}
+
+func planOf(club entity.Club) telemetry.Plan {
+	return telemetry.Plan{
+		Club:     club.Name,
+		PlanType: club.PlanType,
+		Channel:  club.AquisitionChannel,
+		Location: club.AquisitionLocation,
+	}
+}
+
+// signupPlan is the plan a signup is recorded for, with the attribution of
+// the signup instead of the club's.
+func signupPlan(m *entity.Membership) telemetry.Plan {
+	p := planOf(m.Club)
+	p.Channel = m.Attribution.Channel
+	p.Location = m.Attribution.Location
+	p.StoreID = m.Attribution.StoreID
+	p.Source = m.Attribution.UTMSource
+	p.Medium = m.Attribution.UTMMedium
+	p.Campaign = m.Attribution.UTMCampaign
+	return p
+}
+
+// couponMetricCode is the code a redeemed coupon is recorded under.
+func couponMetricCode(code string) string {
+	if strings.HasPrefix(code, entity.ReferralCouponPrefix) {
+		return telemetry.CouponReferral
+	}
+	return code
+}
+
+func signupFailureReason(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return telemetry.SignupFailureUserNotFound
+	case errors.Is(err, repository.ErrClubNotFound):
+		return telemetry.SignupFailureClubNotFound
+	case errors.Is(err, repository.ErrClubArchived):
+		return telemetry.SignupFailureClubArchived
+	case errors.Is(err, repository.ErrInactiveUser):
+		return telemetry.SignupFailureInactiveUser
+	case errors.Is(err, repository.ErrInvalidCoupon):
+		return telemetry.SignupFailureInvalidCoupon
+	case db.IsUniqueViolation(err):
+		return telemetry.SignupFailureAlreadyMember
+	default:
+		return telemetry.SignupFailureInternal
 	}
-	return s.Repo.CancelUserClub(cctx, userID)
 }
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+func TestCouponMetricCode(t *testing.T) {
+	tests := map[string]string{
+		"BEMVINDO":                               "BEMVINDO",
+		entity.ReferralCouponPrefix + "K3J9QX2M": telemetry.CouponReferral,
+	}
+
+	for code, want := range tests {
+		if got := couponMetricCode(code); got != want {
+			t.Errorf("couponMetricCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestSignupFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{repository.ErrUserNotFound, telemetry.SignupFailureUserNotFound},
+		{fmt.Errorf("signup: %w", repository.ErrClubNotFound), telemetry.SignupFailureClubNotFound},
+		{repository.ErrClubArchived, telemetry.SignupFailureClubArchived},
+		{repository.ErrInactiveUser, telemetry.SignupFailureInactiveUser},
+		{repository.ErrInvalidCoupon, telemetry.SignupFailureInvalidCoupon},
+		{&pq.Error{Code: "23505"}, telemetry.SignupFailureAlreadyMember},
+		{errors.New("connection reset"), telemetry.SignupFailureInternal},
+	}
+
+	for _, tt := range tests {
+		if got := signupFailureReason(tt.err); got != tt.want {
+			t.Errorf("signupFailureReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
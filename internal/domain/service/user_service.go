@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
 	"github.com/hazkall/capy-belga/internal/domain/repository"
 	"github.com/hazkall/capy-belga/pkg/telemetry"
 	"go.opentelemetry.io/otel/attribute"
@@ -12,7 +14,8 @@ import (
 )
 
 type UserService struct {
-	Repo *repository.Repository
+	Repo   *repository.Repository
+	Events event.Publisher
 }
 
 func (s *UserService) CreateUser(ctx context.Context, user *entity.User) error {
@@ -20,12 +23,36 @@ func (s *UserService) CreateUser(ctx context.Context, user *entity.User) error {
 	cctx, span := telemetry.Tracer.Start(ctx, "UserService.CreateUser",
 		trace.WithAttributes(
 			attribute.String("entity", "service"),
-			attribute.String("email", user.Email),
+			telemetry.EmailAttribute(user.Email),
 		),
 	)
 	defer span.End()
 
-	return s.Repo.InsertUser(cctx, user)
+	referral, err := s.Repo.InsertUser(cctx, user)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	telemetry.RecordUserRegistered(cctx)
+
+	if referral != nil {
+		stage := telemetry.ReferralReferred
+		if referral.Status == entity.ReferralRejected {
+			stage = telemetry.ReferralRejected
+		}
+		span.SetAttributes(attribute.String("referral.stage", stage), attribute.String("referral.reason", referral.Reason))
+		telemetry.RecordReferral(cctx, stage, referral.Reason)
+	}
+
+	publishEvent(cctx, s.Events, event.UserRegistered{
+		Email:      user.Email,
+		Name:       user.Name,
+		OccurredAt: time.Now().UTC(),
+	})
+
+	return nil
 }
 
 func (s *UserService) UserState(ctx context.Context, email string) (bool, error) {
@@ -33,7 +60,7 @@ func (s *UserService) UserState(ctx context.Context, email string) (bool, error)
 	cctx, span := telemetry.Tracer.Start(ctx, "UserService.UserState",
 		trace.WithAttributes(
 			attribute.String("entity", "service"),
-			attribute.String("email", email),
+			telemetry.EmailAttribute(email),
 		),
 	)
 	defer span.End()
@@ -54,3 +81,167 @@ func (s *UserService) UserState(ctx context.Context, email string) (bool, error)
 
 	return status, nil
 }
+
+// ReferralSummary returns the referral code of a user and how its referrals
+// went.
+func (s *UserService) ReferralSummary(ctx context.Context, email string) (*entity.ReferralSummary, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "UserService.ReferralSummary",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	summary, err := s.Repo.ReferralSummary(cctx, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// UpdateUser changes the name and/or the email of a user and returns the
+// updated user.
+func (s *UserService) UpdateUser(ctx context.Context, update *entity.UserUpdate) (*entity.User, error) {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "UserService.UpdateUser",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(update.Email),
+		),
+	)
+	defer span.End()
+
+	user, err := s.Repo.UpdateUser(cctx, update.Email, update.Name, update.NewEmail)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	s.audited(cctx, user.ID, repository.AuditUpdate)
+
+	return user, nil
+}
+
+// DeactivateUser deactivates a user. Its active memberships are suspended
+// and come back on reactivation, so they are not counted as cancellations.
+func (s *UserService) DeactivateUser(ctx context.Context, email string) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "UserService.DeactivateUser",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	userID, suspended, err := s.Repo.DeactivateUser(cctx, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, m := range suspended {
+		publishEvent(cctx, s.Events, event.MembershipSuspended{
+			Email:      email,
+			ClubName:   m.Club.Name,
+			PlanType:   m.Club.PlanType,
+			OccurredAt: now,
+		})
+	}
+
+	s.audited(cctx, userID, repository.AuditDeactivate)
+
+	return nil
+}
+
+// ReactivateUser reactivates a user together with the memberships suspended
+// when it was deactivated.
+func (s *UserService) ReactivateUser(ctx context.Context, email string) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "UserService.ReactivateUser",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	userID, resumed, err := s.Repo.ReactivateUser(cctx, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, m := range resumed {
+		publishEvent(cctx, s.Events, event.MembershipResumed{
+			Email:      email,
+			ClubName:   m.Club.Name,
+			PlanType:   m.Club.PlanType,
+			OccurredAt: now,
+		})
+	}
+
+	s.audited(cctx, userID, repository.AuditReactivate)
+
+	return nil
+}
+
+// EraseUser anonymizes the personal data of a user. The memberships it still
+// had are cancelled and counted as such, while the counts already recorded
+// for the user are left as they are.
+func (s *UserService) EraseUser(ctx context.Context, email string) error {
+
+	cctx, span := telemetry.Tracer.Start(ctx, "UserService.EraseUser",
+		trace.WithAttributes(
+			attribute.String("entity", "service"),
+			telemetry.EmailAttribute(email),
+		),
+	)
+	defer span.End()
+
+	userID, cancelled, err := s.Repo.EraseUser(cctx, email)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, m := range cancelled {
+		telemetry.RecordCancellation(cctx, planOf(m.Club), now.Sub(m.JoinedAt))
+
+		publishEvent(cctx, s.Events, event.MembershipCancelled{
+			Email:      email,
+			ClubName:   m.Club.Name,
+			PlanType:   m.Club.PlanType,
+			OccurredAt: now,
+		})
+	}
+
+	s.audited(cctx, userID, repository.AuditErase)
+
+	return nil
+}
+
+func (s *UserService) audited(ctx context.Context, userID int64, action string) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("user_id", userID),
+		attribute.String("audit.action", action),
+	)
+
+	publishEvent(ctx, s.Events, event.UserAudited{
+		UserID:     userID,
+		Action:     action,
+		OccurredAt: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+var registeredAt = time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+// published records the events published to it.
+type published []event.Event
+
+func (p *published) Publish(ctx context.Context, e event.Event) error {
+	*p = append(*p, e)
+	return nil
+}
+
+func expectLockedUser(mock sqlmock.Sqlmock, active bool) {
+	mock.ExpectQuery(`SELECT id, active, created_at\s+FROM users`).
+		WithArgs("capy@email.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "active", "created_at"}).AddRow(7, active, registeredAt))
+}
+
+func membershipRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "plan_type", "channel", "location", "joined_at"}).
+		AddRow(3, "Clube Capy", "premium", "online", "store", registeredAt).
+		AddRow(4, "Clube Belga", "basic", "store", "store", registeredAt)
+}
+
+func TestMembershipEventsOfUserChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect func(sqlmock.Sqlmock)
+		run    func(*UserService) error
+		want   string
+	}{
+		{
+			name: "deactivate suspends",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockedUser(mock, true)
+				mock.ExpectExec(`UPDATE users SET active = false`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`UPDATE user_club uc\s+SET active = false, suspended = true`).WillReturnRows(membershipRows())
+				mock.ExpectExec(`INSERT INTO user_audit`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			run:  func(s *UserService) error { return s.DeactivateUser(context.Background(), "capy@email.com") },
+			want: event.MembershipSuspendedKey,
+		},
+		{
+			name: "reactivate resumes",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockedUser(mock, false)
+				mock.ExpectExec(`UPDATE users SET active = true`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`UPDATE user_club uc\s+SET active = true, suspended = false`).WillReturnRows(membershipRows())
+				mock.ExpectExec(`INSERT INTO user_audit`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			run:  func(s *UserService) error { return s.ReactivateUser(context.Background(), "capy@email.com") },
+			want: event.MembershipResumedKey,
+		},
+		{
+			name: "erase cancels",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockedUser(mock, true)
+				mock.ExpectExec(`UPDATE users\s+SET name = ''`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`UPDATE user_club uc\s+SET active = false, suspended = false`).WillReturnRows(membershipRows())
+				mock.ExpectExec(`UPDATE user_audit`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE user_club SET referrer = NULL`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE referrals`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM notification_preferences`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE notifications`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO user_audit`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			run:  func(s *UserService) error { return s.EraseUser(context.Background(), "capy@email.com") },
+			want: event.MembershipCancelledKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := mockRepository(t)
+			tt.expect(mock)
+
+			var events published
+			if err := tt.run(&UserService{Repo: repo, Events: &events}); err != nil {
+				t.Fatal(err)
+			}
+
+			var clubs []string
+			for _, e := range events {
+				if e.RoutingKey() == tt.want && e.Subject() == "capy@email.com" {
+					clubs = append(clubs, clubOf(e))
+				}
+			}
+			if len(clubs) != 2 || clubs[0] != "Clube Capy" || clubs[1] != "Clube Belga" {
+				t.Errorf("%s events for %v, want Clube Capy and Clube Belga", tt.want, clubs)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func clubOf(e event.Event) string {
+	switch e := e.(type) {
+	case event.MembershipSuspended:
+		return e.ClubName
+	case event.MembershipResumed:
+		return e.ClubName
+	case event.MembershipCancelled:
+		return e.ClubName
+	}
+	return ""
+}
+
+func TestCreateUserFails(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	tracer := telemetry.Tracer
+	telemetry.Tracer = oteltrace.NewTracerProvider(oteltrace.WithSyncer(spans)).Tracer("test")
+	t.Cleanup(func() { telemetry.Tracer = tracer })
+
+	repo, mock := mockRepository(t)
+	errReset := errors.New("connection reset")
+
+	mock.ExpectBegin().WillReturnError(errReset)
+
+	var events published
+	s := &UserService{Repo: repo, Events: &events}
+
+	err := s.CreateUser(context.Background(), &entity.User{Name: "Capy", Email: "capy@email.com"})
+	if !errors.Is(err, errReset) {
+		t.Errorf("CreateUser() error = %v, want %v", err, errReset)
+	}
+	if len(events) != 0 {
+		t.Errorf("published %d events for a failed user", len(events))
+	}
+
+	for _, span := range spans.GetSpans() {
+		if span.Name != "UserService.CreateUser" {
+			continue
+		}
+		if span.Status.Code != codes.Error || len(span.Events) == 0 {
+			t.Errorf("span status = %v with %d events, want the error recorded", span.Status, len(span.Events))
+		}
+		return
+	}
+	t.Error("no UserService.CreateUser span")
+}
@@ -1,6 +1,8 @@
 package middlewares
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -9,12 +11,14 @@ import (
 	"github.com/hazkall/capy-belga/pkg/telemetry"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type statusResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	written    int64
 }
 
 func (rw *statusResponseWriter) WriteHeader(statusCode int) {
@@ -22,6 +26,32 @@ func (rw *statusResponseWriter) WriteHeader(statusCode int) {
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (rw *statusResponseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.read += int64(n)
+	return n, err
+}
+
+// statusClass groups status codes as 2xx, 4xx, ... to keep metric
+// cardinality bounded.
+func statusClass(statusCode int) string {
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
+
+// OtelMiddleware traces, measures and logs each request under its route
+// template. The raw path, query and referer are left out, as they can carry
+// personal data such as an email.
 func OtelMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -31,24 +61,35 @@ func OtelMiddleware(next http.Handler) http.Handler {
 		}
 
 		startTime := time.Now()
+		route := telemetry.RouteTemplate(r)
 
-		ctx, span := telemetry.Tracer.Start(r.Context(), r.URL.Path,
+		ctx, span := telemetry.Tracer.Start(r.Context(), r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
 			trace.WithAttributes(
+				attribute.String("http.route", route),
 				attribute.String("http.server.remote_ip", remoteIP),
 				attribute.String("http.server.protocol", r.Proto),
 				attribute.String("http.server.host", r.Host),
-				attribute.String("http.server.path", r.URL.Path),
 				attribute.String("http.server.method", r.Method),
 				attribute.String("http.server.user_agent", r.UserAgent()),
-				attribute.String("http.server.referer", r.Referer()),
-				attribute.String("http.server.request_uri", r.RequestURI),
 				attribute.String("http.server.request_scheme", r.URL.Scheme),
 			),
 		)
 
 		defer span.End()
 
-		wrappedWriter := &statusResponseWriter{ResponseWriter: w}
+		activeAttrs := metric.WithAttributes(
+			attribute.String("http.route", route),
+			attribute.String("http.request.method", r.Method),
+		)
+
+		telemetry.HTTPServerActiveRequests.Add(ctx, 1, activeAttrs)
+		defer telemetry.HTTPServerActiveRequests.Add(ctx, -1, activeAttrs)
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+
+		wrappedWriter := &statusResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(wrappedWriter, r.WithContext(ctx))
 
 		if wrappedWriter.statusCode >= 200 && wrappedWriter.statusCode < 400 {
@@ -60,25 +101,33 @@ func OtelMiddleware(next http.Handler) http.Handler {
 		duration := time.Since(startTime)
 		statusCode := wrappedWriter.statusCode
 
+		attrs := metric.WithAttributes(
+			attribute.String("http.route", route),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.response.status_class", statusClass(statusCode)),
+		)
+
+		telemetry.HTTPServerDuration.Record(ctx, duration.Seconds(), attrs)
+		telemetry.HTTPServerRequestBodySize.Record(ctx, body.read, attrs)
+		telemetry.HTTPServerResponseBodySize.Record(ctx, wrappedWriter.written, attrs)
+
+		durationMs := float64(duration) / float64(time.Millisecond)
+
 		span.SetAttributes(
 			attribute.Int("http.server.status_code", statusCode),
-			attribute.Float64("http.server.duration_ms", float64(duration.Milliseconds())),
+			attribute.Float64("http.server.duration_ms", durationMs),
 		)
 
 		slog.InfoContext(ctx, "Request completed",
-			slog.String("trace.id", span.SpanContext().TraceID().String()),
-			slog.String("trace.span_id", span.SpanContext().SpanID().String()),
+			slog.String("http.route", route),
 			slog.String("http.server.remote_ip", remoteIP),
 			slog.String("http.server.protocol", r.Proto),
 			slog.String("http.server.host", r.Host),
-			slog.String("http.server.path", r.URL.Path),
 			slog.String("http.server.method", r.Method),
 			slog.String("http.server.user_agent", r.UserAgent()),
-			slog.String("http.server.referer", r.Referer()),
-			slog.String("http.server.request_uri", r.RequestURI),
 			slog.String("http.server.request_scheme", r.URL.Scheme),
 			slog.Int("http.server.status_code", statusCode),
-			slog.Float64("http.server.duration_ms", float64(duration.Milliseconds())),
+			slog.Float64("http.server.duration_ms", durationMs),
 		)
 	})
 
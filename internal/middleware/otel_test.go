@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+func TestMain(m *testing.M) {
+	telemetry.Tracer = tracenoop.NewTracerProvider().Tracer("test")
+
+	os.Exit(m.Run())
+}
+
+func TestOtelMiddlewareMetrics(t *testing.T) {
+	reader := otelmetric.NewManualReader()
+	telemetry.Meter = otelmetric.NewMeterProvider(otelmetric.WithReader(reader)).Meter("test")
+	if err := telemetry.MetricsStart(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/plans/{code}", OtelMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("plano não encontrado"))
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/plans/capy@email.com", strings.NewReader(`{"name":"Capy"}`))
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	want := attribute.NewSet(
+		attribute.String("http.route", "/plans/{code}"),
+		attribute.String("http.request.method", http.MethodPost),
+		attribute.String("http.response.status_class", "4xx"),
+	)
+
+	duration := metrics["http.server.request.duration"].(metricdata.Histogram[float64]).DataPoints
+	if len(duration) != 1 || !duration[0].Attributes.Equals(&want) || duration[0].Count != 1 {
+		t.Fatalf("http.server.request.duration = %+v, want one request with %v", duration, want.ToSlice())
+	}
+	if bounds := duration[0].Bounds; bounds[0] != 0.005 || bounds[len(bounds)-1] != 10 {
+		t.Errorf("duration bounds = %v, want the semantic convention buckets", bounds)
+	}
+
+	sizes := map[string]int64{
+		"http.server.request.body.size":  int64(len(`{"name":"Capy"}`)),
+		"http.server.response.body.size": int64(len("plano não encontrado")),
+	}
+	for name, size := range sizes {
+		dps := metrics[name].(metricdata.Histogram[int64]).DataPoints
+		if len(dps) != 1 || !dps[0].Attributes.Equals(&want) || dps[0].Sum != size {
+			t.Errorf("%s = %+v, want %d bytes with %v", name, dps, size, want.ToSlice())
+		}
+	}
+
+	active := metrics["http.server.active_requests"].(metricdata.Sum[int64]).DataPoints
+	if len(active) != 1 || active[0].Value != 0 {
+		t.Fatalf("http.server.active_requests = %+v, want 0 once the request completed", active)
+	}
+	if active[0].Attributes.HasValue("http.response.status_class") {
+		t.Errorf("active requests attributes = %v, want no status class", active[0].Attributes.ToSlice())
+	}
+}
@@ -0,0 +1,85 @@
+package mq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	ContentTypeMsgPack  = "application/msgpack"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Codec encodes message data for one AMQP content type.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var codecs = map[string]Codec{}
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(MsgPackCodec{})
+	RegisterCodec(ProtobufCodec{})
+}
+
+// RegisterCodec makes c available to CodecFor under its content type.
+func RegisterCodec(c Codec) {
+	codecs[c.ContentType()] = c
+}
+
+// CodecFor returns the codec negotiated by an AMQP content type.
+func CodecFor(contentType string) (Codec, error) {
+	c, ok := codecs[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedContent, contentType)
+	}
+	return c, nil
+}
+
+// ContentTypes lists the registered content types.
+func ContentTypes() []string {
+	types := make([]string, 0, len(codecs))
+	for ct := range codecs {
+		types = append(types, ct)
+	}
+	sort.Strings(types)
+	return types
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return ContentTypeJSON }
+
+func (JSONCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// MsgPackCodec encodes with MessagePack using the json struct tags, so the
+// field names on the wire match the JSON contract.
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) ContentType() string { return ContentTypeMsgPack }
+
+func (MsgPackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetOmitEmpty(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgPackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,70 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+// BenchmarkCodecs compares the codecs on the payloads we publish, reporting
+// the encoded size next to the encode and decode cost.
+//
+//	go test ./internal/mq -run '^$' -bench Codecs -benchmem
+func BenchmarkCodecs(b *testing.B) {
+	payloads := []struct {
+		name string
+		v    any
+		new  func() any
+	}{
+		{
+			name: "signup",
+			v:    &entity.SignupPayload{Email: "usuario1042@email.com", ClubName: "Clube Premium Online Store"},
+			new:  func() any { return new(entity.SignupPayload) },
+		},
+		{
+			name: "club",
+			v: &entity.Club{
+				Name:               "Clube Premium Online Store",
+				Description:        "Clube premium online store",
+				AquisitionChannel:  "online",
+				AquisitionLocation: "store",
+				PlanType:           "premium",
+			},
+			new: func() any { return new(entity.Club) },
+		},
+	}
+
+	for _, p := range payloads {
+		for _, ct := range ContentTypes() {
+			codec, err := CodecFor(ct)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			data, err := codec.Marshal(p.v)
+			if err != nil {
+				b.Fatal(ct, err)
+			}
+
+			b.Run(p.name+"/"+ct+"/encode", func(b *testing.B) {
+				b.ReportAllocs()
+				b.ReportMetric(float64(len(data)), "bytes")
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Marshal(p.v); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run(p.name+"/"+ct+"/decode", func(b *testing.B) {
+				b.ReportAllocs()
+				b.ReportMetric(float64(len(data)), "bytes")
+				for i := 0; i < b.N; i++ {
+					if err := codec.Unmarshal(data, p.new()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package mq
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// SchemaVersionHeader carries the schema version of the message data.
+	SchemaVersionHeader = "x-schema-version"
+	// PublishedAtHeader carries the publication time in Unix milliseconds,
+	// since the AMQP timestamp only has second resolution.
+	PublishedAtHeader = "x-published-at-ms"
+
+	ContentTypeJSON = "application/json"
+
+	// LegacyVersion is assigned to messages published before the envelope
+	// existed. Their body is the old {"type": ..., "data": ...} wrapper.
+	LegacyVersion = 0
+)
+
+// Envelope is the unit published to the queues. Its metadata travels in the
+// AMQP message properties and headers, the body carries only Data, encoded
+// with the codec of ContentType.
+type Envelope struct {
+	ID            string
+	Type          string
+	Version       int
+	Timestamp     time.Time
+	Producer      string
+	CorrelationID string
+	ContentType   string
+	Key           string
+	Data          []byte
+}
+
+// NewEnvelope wraps JSON data. Set ContentType when Data was encoded with
+// another codec.
+func NewEnvelope(msgType string, version int, key string, data []byte) *Envelope {
+	return &Envelope{
+		ID:          uuid.NewString(),
+		Type:        msgType,
+		Version:     version,
+		Timestamp:   time.Now().UTC(),
+		Producer:    producer(),
+		ContentType: ContentTypeJSON,
+		Key:         key,
+		Data:        data,
+	}
+}
+
+func (e *Envelope) Publishing() amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:   e.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     e.ID,
+		CorrelationId: e.CorrelationID,
+		Timestamp:     e.Timestamp,
+		Type:          e.Type,
+		AppId:         e.Producer,
+		Headers: amqp.Table{
+			SchemaVersionHeader: int32(e.Version),
+			MessageKeyHeader:    e.Key,
+			PublishedAtHeader:   e.Timestamp.UnixMilli(),
+		},
+		Body: e.Data,
+	}
+}
+
+// EnvelopeFromDelivery rebuilds the envelope of a delivery. Deliveries without
+// a schema version are legacy messages and get LegacyVersion with the whole
+// body as Data, leaving the unwrapping to the registry upcasters.
+func EnvelopeFromDelivery(d amqp.Delivery) *Envelope {
+	e := &Envelope{
+		ID:            d.MessageId,
+		Type:          d.Type,
+		Version:       LegacyVersion,
+		Timestamp:     PublishedAt(d),
+		Producer:      d.AppId,
+		CorrelationID: d.CorrelationId,
+		ContentType:   d.ContentType,
+		Key:           MessageKey(d),
+		Data:          d.Body,
+	}
+
+	if v, ok := headerInt(d.Headers[SchemaVersionHeader]); ok {
+		e.Version = v
+	}
+
+	if e.Type == "" {
+		// Legacy messages only carried the type inside the body.
+		var legacy struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(d.Body, &legacy) == nil {
+			e.Type = legacy.Type
+		}
+	}
+
+	if e.ContentType == "" {
+		e.ContentType = ContentTypeJSON
+	}
+
+	return e
+}
+
+// PublishedAt returns when d was published, to the millisecond when it
+// carries PublishedAtHeader and to the second otherwise.
+func PublishedAt(d amqp.Delivery) time.Time {
+	if ms, ok := headerInt(d.Headers[PublishedAtHeader]); ok {
+		return time.UnixMilli(int64(ms)).UTC()
+	}
+	return d.Timestamp
+}
+
+func headerInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int8:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case int:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func producer() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return "capybelga"
+}
@@ -0,0 +1,47 @@
+package mq
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPublishedAt(t *testing.T) {
+	published := time.Date(2025, 3, 1, 12, 0, 0, 250*int(time.Millisecond), time.UTC)
+
+	e := NewEnvelope("users", 1, "capy@email.com", []byte(`{}`))
+	e.Timestamp = published
+	p := e.Publishing()
+
+	tests := []struct {
+		name string
+		d    amqp.Delivery
+		want time.Time
+	}{
+		{
+			name: "millisecond header",
+			d:    amqp.Delivery{Headers: p.Headers, Timestamp: published.Truncate(time.Second)},
+			want: published,
+		},
+		{
+			name: "republished",
+			d:    amqp.Delivery{Headers: republishing(amqp.Delivery{Headers: p.Headers}).Headers},
+			want: published,
+		},
+		{
+			name: "amqp timestamp without the header",
+			d:    amqp.Delivery{Timestamp: published.Truncate(time.Second)},
+			want: published.Truncate(time.Second),
+		},
+		{name: "neither"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PublishedAt(tt.d); !got.Equal(tt.want) {
+				t.Errorf("PublishedAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
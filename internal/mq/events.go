@@ -0,0 +1,123 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hazkall/capy-belga/internal/domain/event"
+)
+
+func (mq *MQ) DeclareExchange(name string) error {
+	if err := mq.Channel.ExchangeDeclare(
+		name,
+		amqp.ExchangeTopic,
+		true,
+		false,
+		false,
+		false,
+		nil,
+	); err != nil {
+		return err
+	}
+
+	slog.Info("Exchange declared", "exchange", name)
+
+	return nil
+}
+
+// BindQueue binds the queue to the topic exchange for each routing key
+// pattern.
+func (mq *MQ) BindQueue(queueName, exchange string, keys ...string) error {
+	for _, key := range keys {
+		if err := mq.Channel.QueueBind(queueName, key, exchange, false, nil); err != nil {
+			return err
+		}
+
+		slog.Info("Queue bound", "queue", queueName, "exchange", exchange, "key", key)
+	}
+
+	return nil
+}
+
+// EventPublisher publishes domain events to a topic exchange on a channel in
+// confirm mode, so Publish only returns once the broker has taken the event.
+type EventPublisher struct {
+	exchange string
+	channel  *amqp.Channel
+}
+
+func (mq *MQ) NewEventPublisher(exchange string) (*EventPublisher, error) {
+	ch, err := mq.Conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	return &EventPublisher{exchange: exchange, channel: ch}, nil
+}
+
+func (p *EventPublisher) Publish(ctx context.Context, e event.Event) error {
+	env, err := eventEnvelope(e)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = p.publish(ctx, e, env)
+	recordPublish(ctx, p.exchange, start, err)
+
+	return err
+}
+
+// eventEnvelope wraps the JSON payload of e, with the ID of e when it is an
+// event.Identified one.
+func eventEnvelope(e event.Event) (*Envelope, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	env := NewEnvelope(e.RoutingKey(), event.Version, e.Subject(), data)
+	if id, ok := e.(event.Identified); ok && id.EventID() != "" {
+		env.ID = id.EventID()
+	}
+
+	return env, nil
+}
+
+func (p *EventPublisher) publish(ctx context.Context, e event.Event, env *Envelope) error {
+	dc, err := p.channel.PublishWithDeferredConfirmWithContext(ctx,
+		p.exchange,
+		e.RoutingKey(),
+		false,
+		false,
+		env.Publishing(),
+	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !acked {
+		return fmt.Errorf("event %s was not confirmed by the broker", e.RoutingKey())
+	}
+
+	return nil
+}
+
+func (p *EventPublisher) Close() error {
+	return p.channel.Close()
+}
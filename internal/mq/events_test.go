@@ -0,0 +1,43 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/hazkall/capy-belga/internal/domain/event"
+)
+
+func TestEventEnvelopeID(t *testing.T) {
+	rejected := event.MembershipRejected{ID: "rejection-m1", Email: "capy@email.com", ClubName: "Clube Capy"}
+
+	env, err := eventEnvelope(rejected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != "rejection-m1" {
+		t.Errorf("ID = %q, want rejection-m1", env.ID)
+	}
+
+	rejected.ID = ""
+	env, err = eventEnvelope(rejected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ID == "" {
+		t.Error("ID is empty, want a generated one")
+	}
+}
+
+func TestEventEnvelopeEncoded(t *testing.T) {
+	enc := &event.Encoded{ID: "e1", Key: event.MembershipActivatedKey, Subj: "capy@email.com", Data: []byte(`{"club":"Clube Capy"}`)}
+
+	env, err := eventEnvelope(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != "e1" || env.Type != event.MembershipActivatedKey || env.Key != "capy@email.com" {
+		t.Errorf("envelope = %s %s %s, want e1 %s capy@email.com", env.ID, env.Type, env.Key, event.MembershipActivatedKey)
+	}
+	if string(env.Data) != `{"club":"Clube Capy"}` {
+		t.Errorf("Data = %s, want the encoded payload", env.Data)
+	}
+}
@@ -0,0 +1,411 @@
+package mq
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtobufCodec encodes structs in the Protocol Buffers wire format. Field
+// numbers come from `proto:"<n>"` struct tags and must match the .proto
+// definitions in internal/contract/proto; untagged fields are not encoded.
+//
+// Scalars follow proto3 semantics (zero values are omitted and repeated
+// scalars are packed, though unpacked ones are also read), time.Time is
+// encoded as google.protobuf.Timestamp and nested structs as messages.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("protobuf: cannot marshal %s", rv.Type())
+	}
+
+	return appendMessage(nil, rv)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("protobuf: cannot unmarshal into %T", v)
+	}
+
+	return consumeMessage(data, rv.Elem())
+}
+
+type protoField struct {
+	num   protowire.Number
+	index int
+}
+
+var (
+	protoFields sync.Map // reflect.Type -> []protoField
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+func fieldsOf(t reflect.Type) ([]protoField, error) {
+	if f, ok := protoFields.Load(t); ok {
+		return f.([]protoField), nil
+	}
+
+	var fields []protoField
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("proto")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		n, err := strconv.Atoi(tag)
+		if err != nil || !protowire.Number(n).IsValid() {
+			return nil, fmt.Errorf("protobuf: invalid field number %q on %s.%s", tag, t, t.Field(i).Name)
+		}
+
+		fields = append(fields, protoField{num: protowire.Number(n), index: i})
+	}
+
+	protoFields.Store(t, fields)
+
+	return fields, nil
+}
+
+func appendMessage(b []byte, rv reflect.Value) ([]byte, error) {
+	fields, err := fieldsOf(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fields {
+		fv := rv.Field(f.index)
+
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			if isScalar(fv.Type().Elem()) {
+				b = appendPacked(b, f.num, fv)
+				continue
+			}
+
+			for i := 0; i < fv.Len(); i++ {
+				if b, err = appendValue(b, f.num, fv.Index(i), true); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if b, err = appendValue(b, f.num, fv, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// appendValue appends one field. Zero scalars are skipped unless they are
+// elements of a repeated field, where their position matters.
+func appendValue(b []byte, num protowire.Number, v reflect.Value, repeated bool) ([]byte, error) {
+	if !repeated && v.IsZero() {
+		return b, nil
+	}
+
+	if isScalar(v.Type()) {
+		b = protowire.AppendTag(b, num, scalarType(v.Kind()))
+		return appendScalar(b, v), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, v.String()), nil
+	case reflect.Slice:
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, v.Bytes()), nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return b, nil
+		}
+		return appendValue(b, num, v.Elem(), true)
+	case reflect.Struct:
+		var msg []byte
+		if v.Type() == timeType {
+			msg = appendTimestamp(nil, v.Interface().(time.Time))
+		} else {
+			var err error
+			if msg, err = appendMessage(nil, v); err != nil {
+				return nil, err
+			}
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, msg), nil
+	default:
+		return nil, fmt.Errorf("protobuf: unsupported field type %s", v.Type())
+	}
+}
+
+// isScalar reports whether values of t are varints or fixed-size numbers,
+// which proto3 packs when repeated.
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// appendPacked appends a repeated scalar field in the packed encoding proto3
+// uses by default: one length-delimited record holding every element.
+func appendPacked(b []byte, num protowire.Number, v reflect.Value) []byte {
+	if v.Len() == 0 {
+		return b
+	}
+
+	var packed []byte
+	for i := 0; i < v.Len(); i++ {
+		packed = appendScalar(packed, v.Index(i))
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+// scalarType returns the wire type of a scalar of kind k.
+func scalarType(k reflect.Kind) protowire.Type {
+	switch k {
+	case reflect.Float32:
+		return protowire.Fixed32Type
+	case reflect.Float64:
+		return protowire.Fixed64Type
+	default:
+		return protowire.VarintType
+	}
+}
+
+// appendScalar appends the value of a scalar without its tag.
+func appendScalar(b []byte, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Bool:
+		return protowire.AppendVarint(b, protowire.EncodeBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return protowire.AppendVarint(b, uint64(v.Int()))
+	case reflect.Float32:
+		return protowire.AppendFixed32(b, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		return protowire.AppendFixed64(b, math.Float64bits(v.Float()))
+	default:
+		return protowire.AppendVarint(b, v.Uint())
+	}
+}
+
+func appendTimestamp(b []byte, t time.Time) []byte {
+	if s := t.Unix(); s != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s))
+	}
+	if n := t.Nanosecond(); n != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(n))
+	}
+	return b
+}
+
+func consumeMessage(b []byte, rv reflect.Value) error {
+	fields, err := fieldsOf(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	byNum := make(map[protowire.Number]int, len(fields))
+	for _, f := range fields {
+		byNum[f.num] = f.index
+	}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		index, known := byNum[num]
+		if !known {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		fv := rv.Field(index)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			if isScalar(fv.Type().Elem()) && typ == protowire.BytesType {
+				if n, err = consumePacked(b, fv); err != nil {
+					return err
+				}
+				b = b[n:]
+				continue
+			}
+
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if n, err = consumeValue(b, typ, elem); err != nil {
+				return err
+			}
+			fv.Set(reflect.Append(fv, elem))
+		} else if n, err = consumeValue(b, typ, fv); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+func consumeValue(b []byte, typ protowire.Type, v reflect.Value) (int, error) {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Struct, reflect.Pointer:
+		if typ != protowire.BytesType {
+			return 0, fmt.Errorf("protobuf: wire type %d for %s", typ, v.Type())
+		}
+		raw, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		return n, setBytes(raw, v)
+	default:
+		if !isScalar(v.Type()) {
+			return 0, fmt.Errorf("protobuf: unsupported field type %s", v.Type())
+		}
+		if typ != scalarType(v.Kind()) {
+			return 0, fmt.Errorf("protobuf: wire type %d for %s", typ, v.Type())
+		}
+		return consumeScalar(b, v)
+	}
+}
+
+// consumePacked appends every element of a packed repeated scalar field to
+// the slice v.
+func consumePacked(b []byte, v reflect.Value) (int, error) {
+	raw, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+
+	for len(raw) > 0 {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		m, err := consumeScalar(raw, elem)
+		if err != nil {
+			return 0, err
+		}
+		v.Set(reflect.Append(v, elem))
+		raw = raw[m:]
+	}
+
+	return n, nil
+}
+
+// consumeScalar reads a scalar value, without its tag, into v.
+func consumeScalar(b []byte, v reflect.Value) (int, error) {
+	switch v.Kind() {
+	case reflect.Float32:
+		x, n := protowire.ConsumeFixed32(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetFloat(float64(math.Float32frombits(x)))
+		return n, nil
+	case reflect.Float64:
+		x, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetFloat(math.Float64frombits(x))
+		return n, nil
+	}
+
+	x, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(protowire.DecodeBool(x))
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(x)
+	default:
+		v.SetInt(int64(x))
+	}
+
+	return n, nil
+}
+
+func setBytes(raw []byte, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(raw))
+	case reflect.Slice:
+		v.SetBytes(append([]byte(nil), raw...))
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setBytes(raw, v.Elem())
+	case reflect.Struct:
+		if v.Type() == timeType {
+			t, err := consumeTimestamp(raw)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return consumeMessage(raw, v)
+	}
+	return nil
+}
+
+func consumeTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ != protowire.VarintType || (num != 1 && num != 2) {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return time.Time{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		x, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if num == 1 {
+			seconds = int64(x)
+		} else {
+			nanos = int64(x)
+		}
+	}
+
+	return time.Unix(seconds, nanos).UTC(), nil
+}
@@ -0,0 +1,210 @@
+package mq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type sample struct {
+	IDs    []int64   `proto:"1"`
+	Flags  []bool    `proto:"2"`
+	Ratios []float64 `proto:"3"`
+	Name   string    `proto:"4"`
+	Tags   []string  `proto:"5"`
+	Count  int       `proto:"6"`
+}
+
+// sampleDescriptor describes sample as protoc would compile it from
+//
+//	message Sample {
+//	  repeated int64 ids = 1;
+//	  repeated bool flags = 2;
+//	  repeated double ratios = 3;
+//	  string name = 4;
+//	  repeated string tags = 5;
+//	  int32 count = 6;
+//	}
+func sampleDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	field := func(name string, num int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Label:    label.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+
+	repeated, optional := descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("sample.proto"),
+		Package: proto.String("capybelga.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Sample"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("ids", 1, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				field("flags", 2, repeated, descriptorpb.FieldDescriptorProto_TYPE_BOOL),
+				field("ratios", 3, repeated, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE),
+				field("name", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("tags", 5, repeated, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("count", 6, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd.Messages().ByName("Sample")
+}
+
+// referenceMessage builds the message a real protobuf implementation holds
+// for s.
+func referenceMessage(md protoreflect.MessageDescriptor, s sample) *dynamicpb.Message {
+	m := dynamicpb.NewMessage(md)
+	fields := md.Fields()
+
+	ids := m.Mutable(fields.ByName("ids")).List()
+	for _, id := range s.IDs {
+		ids.Append(protoreflect.ValueOfInt64(id))
+	}
+	flags := m.Mutable(fields.ByName("flags")).List()
+	for _, f := range s.Flags {
+		flags.Append(protoreflect.ValueOfBool(f))
+	}
+	ratios := m.Mutable(fields.ByName("ratios")).List()
+	for _, r := range s.Ratios {
+		ratios.Append(protoreflect.ValueOfFloat64(r))
+	}
+	tags := m.Mutable(fields.ByName("tags")).List()
+	for _, tag := range s.Tags {
+		tags.Append(protoreflect.ValueOfString(tag))
+	}
+	if s.Name != "" {
+		m.Set(fields.ByName("name"), protoreflect.ValueOfString(s.Name))
+	}
+	if s.Count != 0 {
+		m.Set(fields.ByName("count"), protoreflect.ValueOfInt32(int32(s.Count)))
+	}
+
+	return m
+}
+
+func TestProtobufInterop(t *testing.T) {
+	md := sampleDescriptor(t)
+
+	tests := []struct {
+		name string
+		in   sample
+	}{
+		{"empty", sample{}},
+		{"scalars", sample{Name: "capy", Count: -7}},
+		{
+			name: "repeated",
+			in: sample{
+				IDs:    []int64{1, 0, -1, 1 << 40},
+				Flags:  []bool{true, false, true},
+				Ratios: []float64{0.5, 0, -2.25},
+				Tags:   []string{"a", "", "c"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := referenceMessage(md, tt.in)
+
+			// Bytes from the reference encoder, with packed repeated scalars.
+			ref, err := proto.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got sample
+			if err := (ProtobufCodec{}).Unmarshal(ref, &got); err != nil {
+				t.Fatalf("Unmarshal(reference bytes) error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.in) {
+				t.Errorf("Unmarshal(reference bytes) = %+v, want %+v", got, tt.in)
+			}
+
+			// Bytes from the codec, read by the reference decoder.
+			data, err := ProtobufCodec{}.Marshal(&tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := dynamicpb.NewMessage(md)
+			if err := proto.Unmarshal(data, decoded); err != nil {
+				t.Fatalf("reference Unmarshal error = %v", err)
+			}
+			if !proto.Equal(decoded, want) {
+				t.Errorf("reference Unmarshal = %v, want %v", decoded, want)
+			}
+		})
+	}
+}
+
+func TestProtobufUnpackedRepeated(t *testing.T) {
+	// Encoders may still write repeated scalars one record per element.
+	var b []byte
+	for _, id := range []int64{3, -4} {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(id))
+	}
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 0x3ff0000000000000) // 1.0
+
+	var got sample
+	if err := (ProtobufCodec{}).Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := sample{IDs: []int64{3, -4}, Ratios: []float64{1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+	}
+}
+
+func TestProtobufWrongWireType(t *testing.T) {
+	b := protowire.AppendTag(nil, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+
+	var got sample
+	if err := (ProtobufCodec{}).Unmarshal(b, &got); err == nil {
+		t.Errorf("Unmarshal() of a varint into a string field succeeded")
+	}
+}
+
+func TestProtobufTimestamp(t *testing.T) {
+	type stamped struct {
+		At time.Time `proto:"1"`
+	}
+
+	in := stamped{At: time.Date(2025, 3, 1, 12, 30, 0, 500, time.UTC)}
+
+	data, err := ProtobufCodec{}.Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got stamped
+	if err := (ProtobufCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.At.Equal(in.At) {
+		t.Errorf("Unmarshal() = %v, want %v", got.At, in.At)
+	}
+}
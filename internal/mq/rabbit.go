@@ -1,7 +1,10 @@
 package mq
 
 import (
+	"context"
 	"log/slog"
+	"strconv"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -17,6 +20,12 @@ func NewMQ(url string) (*MQ, error) {
 		return nil, err
 	}
 
+	if err := registerMetrics(); err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, err
+	}
+
 	return &MQ{
 		URL:     url,
 		Conn:    conn,
@@ -24,40 +33,76 @@ func NewMQ(url string) (*MQ, error) {
 	}, nil
 }
 
+// DeclareQueues declares every queue together with its dead-letter queue and
+// its retry queue. Messages expire from the retry queue back into the queue
+// they came from.
 func (mq *MQ) DeclareQueues(queueNames []string) error {
 	for _, qn := range queueNames {
-		_, err := mq.Channel.QueueDeclare(
-			qn,
-			true,
-			false,
-			false,
-			false,
-			nil,
-		)
-		if err != nil {
-			return err
+		queues := []struct {
+			name string
+			args amqp.Table
+		}{
+			{qn, nil},
+			{DeadLetterQueue(qn), nil},
+			{RetryQueue(qn), amqp.Table{
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": qn,
+			}},
 		}
 
-		slog.Info("Queue declared", "queue", qn)
+		for _, q := range queues {
+			_, err := mq.Channel.QueueDeclare(
+				q.name,
+				true,
+				false,
+				false,
+				false,
+				q.args,
+			)
+			if err != nil {
+				return err
+			}
+
+			slog.Info("Queue declared", "queue", q.name)
+		}
 	}
 	return nil
 }
 
-func (mq *MQ) PublishMessage(message []byte, queueName string) error {
-	return mq.Channel.Publish(
+// PublishMessage publishes the envelope to the default exchange. Its key
+// travels in the MessageKeyHeader so consumers can keep messages for the same
+// key in order.
+func (mq *MQ) PublishMessage(ctx context.Context, e *Envelope, queueName string) error {
+	start := time.Now()
+
+	err := mq.Channel.PublishWithContext(ctx,
 		"",
 		queueName,
 		false,
 		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        message,
-		},
+		e.Publishing(),
 	)
+
+	recordPublish(ctx, queueName, start, err)
+
+	return err
 }
 
-func (mq *MQ) ConsumeMessages(queueName string) (<-chan amqp.Delivery, error) {
-	return mq.Channel.Consume(
+// ConsumeMessages opens a dedicated channel for the consumer, so a channel
+// exception on one queue does not stop the other consumers, and limits the
+// unacknowledged deliveries RabbitMQ pushes to it to prefetch.
+func (mq *MQ) ConsumeMessages(queueName string, prefetch int) (<-chan amqp.Delivery, *amqp.Channel, error) {
+	ch, err := mq.Conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	deliveries, err := ch.Consume(
 		queueName,
 		"",
 		false,
@@ -66,6 +111,105 @@ func (mq *MQ) ConsumeMessages(queueName string) (<-chan amqp.Delivery, error) {
 		false,
 		nil,
 	)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	return deliveries, ch, nil
+}
+
+// PublishDeadLetter copies a delivery that can never be processed to the
+// dead-letter queue of queueName, recording why it was rejected. The caller
+// still has to acknowledge the original delivery.
+func (mq *MQ) PublishDeadLetter(ctx context.Context, d amqp.Delivery, queueName, reason string) error {
+	p := republishing(d)
+	p.Headers[DeadLetterReasonHeader] = reason
+	p.Headers[DeadLetterQueueHeader] = queueName
+
+	start := time.Now()
+
+	err := mq.Channel.PublishWithContext(ctx,
+		"",
+		DeadLetterQueue(queueName),
+		false,
+		false,
+		p,
+	)
+
+	recordPublish(ctx, DeadLetterQueue(queueName), start, err)
+
+	return err
+}
+
+// PublishRetry copies a delivery that failed for now to the retry queue of
+// queueName, from which it returns to queueName after delay, and counts the
+// retry in RetryCountHeader. The caller still has to acknowledge the original
+// delivery.
+//
+// RabbitMQ only expires messages at the head of a queue, so a retry waits at
+// least delay and at most until the retries ahead of it expired.
+func (mq *MQ) PublishRetry(ctx context.Context, d amqp.Delivery, queueName string, delay time.Duration) error {
+	p := republishing(d)
+	p.Headers[RetryCountHeader] = int32(RetryCount(d) + 1)
+	p.Expiration = strconv.FormatInt(max(delay.Milliseconds(), 0), 10)
+
+	start := time.Now()
+
+	err := mq.Channel.PublishWithContext(ctx,
+		"",
+		RetryQueue(queueName),
+		false,
+		false,
+		p,
+	)
+
+	recordPublish(ctx, RetryQueue(queueName), start, err)
+
+	return err
+}
+
+// republishing returns d as a persistent message with a copy of its headers.
+func republishing(d amqp.Delivery) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+
+	return amqp.Publishing{
+		ContentType:   d.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		Headers:       headers,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		Type:          d.Type,
+		AppId:         d.AppId,
+		Body:          d.Body,
+	}
+}
+
+// DeadLetterQueue returns the name of the dead-letter queue for queueName.
+func DeadLetterQueue(queueName string) string {
+	return queueName + ".dlq"
+}
+
+// RetryQueue returns the name of the retry queue for queueName.
+func RetryQueue(queueName string) string {
+	return queueName + ".retry"
+}
+
+// RetryCount returns how many times d was already retried.
+func RetryCount(d amqp.Delivery) int {
+	n, _ := headerInt(d.Headers[RetryCountHeader])
+	return n
+}
+
+// MessageKey returns the ordering key set by PublishMessage, or an empty
+// string for messages published without one.
+func MessageKey(d amqp.Delivery) string {
+	key, _ := d.Headers[MessageKeyHeader].(string)
+	return key
 }
 
 func (mq *MQ) Close() {
@@ -0,0 +1,184 @@
+package mq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+var (
+	ErrUnknownType        = errors.New("unknown message type")
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	ErrUnsupportedContent = errors.New("unsupported content type")
+	ErrSchemaViolation    = errors.New("message does not match schema")
+)
+
+// Upcaster converts message data from one schema version to the next.
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// MessageSchema describes the current version of a message type.
+type MessageSchema struct {
+	Type    string
+	Version int
+	Queue   string
+	// ContentType is the codec producers encode new messages with.
+	ContentType string
+	// New returns a pointer to the Go type the data decodes into.
+	New func() any
+	// JSONSchema is the JSON Schema document for the current version.
+	JSONSchema []byte
+}
+
+type registered struct {
+	MessageSchema
+	schema     *jsonschema.Schema
+	upcasters  map[int]Upcaster
+	minVersion int
+}
+
+// Registry maps message types to their Go types and JSON Schemas and knows
+// how to bring older versions up to date.
+type Registry struct {
+	types map[string]*registered
+}
+
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[string]*registered)}
+}
+
+func (r *Registry) Register(s MessageSchema) error {
+	c := jsonschema.NewCompiler()
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(s.JSONSchema))
+	if err != nil {
+		return fmt.Errorf("parsing schema for %s: %w", s.Type, err)
+	}
+
+	url := fmt.Sprintf("%s.v%d.json", s.Type, s.Version)
+	if err := c.AddResource(url, doc); err != nil {
+		return fmt.Errorf("adding schema for %s: %w", s.Type, err)
+	}
+
+	schema, err := c.Compile(url)
+	if err != nil {
+		return fmt.Errorf("compiling schema for %s: %w", s.Type, err)
+	}
+
+	r.types[s.Type] = &registered{
+		MessageSchema: s,
+		schema:        schema,
+		upcasters:     make(map[int]Upcaster),
+		minVersion:    s.Version,
+	}
+
+	return nil
+}
+
+// RegisterUpcaster registers the conversion of msgType data from version
+// from to from+1. Upcasters must be registered down to the oldest version
+// still accepted.
+func (r *Registry) RegisterUpcaster(msgType string, from int, up Upcaster) error {
+	t, ok := r.types[msgType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownType, msgType)
+	}
+
+	t.upcasters[from] = up
+	if from < t.minVersion {
+		t.minVersion = from
+	}
+
+	return nil
+}
+
+func (r *Registry) Lookup(msgType string) (MessageSchema, error) {
+	t, ok := r.types[msgType]
+	if !ok {
+		return MessageSchema{}, fmt.Errorf("%w: %s", ErrUnknownType, msgType)
+	}
+	return t.MessageSchema, nil
+}
+
+// Decode upcasts the envelope data to the current version, validates it
+// against the JSON Schema and decodes it into the registered Go type.
+//
+// Upcasters work on JSON, so data in any other content type is only accepted
+// at the current version. It is validated by its JSON form after decoding.
+func (r *Registry) Decode(e *Envelope) (any, error) {
+	t, ok := r.types[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, e.Type)
+	}
+
+	codec, err := CodecFor(e.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Version < t.minVersion || e.Version > t.Version {
+		return nil, fmt.Errorf("%w: %s v%d, accepted v%d to v%d", ErrUnsupportedVersion, e.Type, e.Version, t.minVersion, t.Version)
+	}
+
+	if e.ContentType != ContentTypeJSON {
+		if e.Version != t.Version {
+			return nil, fmt.Errorf("%w: %s v%d in %s, only v%d can be decoded from binary", ErrUnsupportedVersion, e.Type, e.Version, e.ContentType, t.Version)
+		}
+
+		v := t.New()
+		if err := codec.Unmarshal(e.Data, v); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSchemaViolation, err)
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := t.validate(data); err != nil {
+			return nil, err
+		}
+
+		return v, nil
+	}
+
+	data := json.RawMessage(e.Data)
+	for v := e.Version; v < t.Version; v++ {
+		up, ok := t.upcasters[v]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s v%d has no upcaster", ErrUnsupportedVersion, e.Type, v)
+		}
+
+		var err error
+		data, err = up(data)
+		if err != nil {
+			return nil, fmt.Errorf("upcasting %s v%d: %w", e.Type, v, err)
+		}
+	}
+
+	if err := t.validate(data); err != nil {
+		return nil, err
+	}
+
+	v := t.New()
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSchemaViolation, err)
+	}
+
+	return v, nil
+}
+
+func (t *registered) validate(data []byte) error {
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaViolation, err)
+	}
+
+	if err := t.schema.Validate(inst); err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaViolation, err)
+	}
+
+	return nil
+}
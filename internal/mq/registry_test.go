@@ -0,0 +1,181 @@
+package mq
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type widget struct {
+	Name  string `json:"name" proto:"1"`
+	Count int    `json:"count,omitempty" proto:"2"`
+}
+
+var widgetSchema = []byte(`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"count": {"type": "integer", "minimum": 0}
+	},
+	"required": ["name"],
+	"additionalProperties": false
+}`)
+
+// testRegistry registers widget at version 2. Version 1 named the field
+// "title" and legacy messages carried the version 1 data bare.
+func testRegistry(t *testing.T) *Registry {
+	t.Helper()
+
+	r := NewRegistry()
+
+	if err := r.Register(MessageSchema{
+		Type:        "widget",
+		Version:     2,
+		Queue:       "widgets",
+		ContentType: ContentTypeJSON,
+		New:         func() any { return new(widget) },
+		JSONSchema:  widgetSchema,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.RegisterUpcaster("widget", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var v1 map[string]any
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		v1["name"] = v1["title"]
+		delete(v1, "title")
+		return json.Marshal(v1)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.RegisterUpcaster("widget", LegacyVersion, func(data json.RawMessage) (json.RawMessage, error) {
+		return data, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func protobufData(t *testing.T, v any) []byte {
+	t.Helper()
+
+	data, err := ProtobufCodec{}.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRegistryDecode(t *testing.T) {
+	r := testRegistry(t)
+
+	tests := []struct {
+		name        string
+		msgType     string
+		version     int
+		contentType string
+		data        []byte
+		want        *widget
+		wantErr     error
+	}{
+		{
+			name:    "current version",
+			msgType: "widget", version: 2, contentType: ContentTypeJSON,
+			data: []byte(`{"name":"gear","count":3}`),
+			want: &widget{Name: "gear", Count: 3},
+		},
+		{
+			name:    "previous version upcast",
+			msgType: "widget", version: 1, contentType: ContentTypeJSON,
+			data: []byte(`{"title":"gear","count":3}`),
+			want: &widget{Name: "gear", Count: 3},
+		},
+		{
+			name:    "legacy upcast through every version",
+			msgType: "widget", version: LegacyVersion, contentType: ContentTypeJSON,
+			data: []byte(`{"title":"gear"}`),
+			want: &widget{Name: "gear"},
+		},
+		{
+			name:    "newer version",
+			msgType: "widget", version: 3, contentType: ContentTypeJSON,
+			data:    []byte(`{"name":"gear"}`),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "older version than any upcaster",
+			msgType: "widget", version: -1, contentType: ContentTypeJSON,
+			data:    []byte(`{"title":"gear"}`),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "unknown type",
+			msgType: "gadget", version: 1, contentType: ContentTypeJSON,
+			data:    []byte(`{}`),
+			wantErr: ErrUnknownType,
+		},
+		{
+			name:    "unknown content type",
+			msgType: "widget", version: 2, contentType: "text/csv",
+			data:    []byte(`gear,3`),
+			wantErr: ErrUnsupportedContent,
+		},
+		{
+			name:    "json schema violation",
+			msgType: "widget", version: 2, contentType: ContentTypeJSON,
+			data:    []byte(`{"name":"gear","count":-1}`),
+			wantErr: ErrSchemaViolation,
+		},
+		{
+			name:    "binary current version",
+			msgType: "widget", version: 2, contentType: ContentTypeProtobuf,
+			data: protobufData(t, &widget{Name: "gear", Count: 3}),
+			want: &widget{Name: "gear", Count: 3},
+		},
+		{
+			name:    "binary previous version",
+			msgType: "widget", version: 1, contentType: ContentTypeProtobuf,
+			data:    protobufData(t, &widget{Name: "gear"}),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "binary schema violation",
+			msgType: "widget", version: 2, contentType: ContentTypeProtobuf,
+			data:    protobufData(t, &widget{Name: "", Count: -1}),
+			wantErr: ErrSchemaViolation,
+		},
+		{
+			name:    "binary malformed",
+			msgType: "widget", version: 2, contentType: ContentTypeProtobuf,
+			data:    []byte{0x0a, 0x10, 'g'},
+			wantErr: ErrSchemaViolation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEnvelope(tt.msgType, tt.version, "key", tt.data)
+			e.ContentType = tt.contentType
+
+			got, err := r.Decode(e)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+const messagingSystem = "rabbitmq"
+
+var (
+	sentMessages    metric.Int64Counter
+	publishDuration metric.Float64Histogram
+	instrumentsOnce sync.Once
+	instrumentsErr  error
+
+	publishDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+func registerMetrics() error {
+	instrumentsOnce.Do(func() {
+		sentMessages, instrumentsErr = telemetry.Meter.Int64Counter(
+			"messaging.client.sent.messages",
+			metric.WithDescription("Number of messages published"),
+			metric.WithUnit("{message}"),
+		)
+		if instrumentsErr != nil {
+			return
+		}
+
+		publishDuration, instrumentsErr = telemetry.Meter.Float64Histogram(
+			"messaging.client.operation.duration",
+			metric.WithDescription("Duration of publish operations, including the broker confirm when enabled"),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(publishDurationBuckets...),
+		)
+	})
+	return instrumentsErr
+}
+
+// recordPublish records one publish to destination, an exchange or a queue.
+func recordPublish(ctx context.Context, destination string, start time.Time, err error) {
+	if sentMessages == nil {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", messagingSystem),
+		attribute.String("messaging.operation.name", "publish"),
+		attribute.String("messaging.destination.name", destination),
+	}
+
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.type", fmt.Sprintf("%T", err)))
+	}
+
+	sentMessages.Add(ctx, 1, metric.WithAttributes(attrs...))
+	publishDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+}
+
+// RegisterQueueMetrics exports the depth and consumer count of queues as
+// observable gauges, read with passive declares on a dedicated channel.
+func (mq *MQ) RegisterQueueMetrics(queues []string) error {
+	depth, err := telemetry.Meter.Int64ObservableGauge(
+		"capybelga.queue.depth",
+		metric.WithDescription("Number of messages ready for delivery in the queue"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	consumers, err := telemetry.Meter.Int64ObservableGauge(
+		"capybelga.queue.consumers",
+		metric.WithDescription("Number of consumers attached to the queue"),
+		metric.WithUnit("{consumer}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	inspector := &queueInspector{mq: mq}
+
+	_, err = telemetry.Meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, name := range queues {
+			q, err := inspector.inspect(name)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to inspect queue", "queue", name, "error", err)
+				continue
+			}
+
+			attrs := metric.WithAttributes(
+				attribute.String("messaging.system", messagingSystem),
+				attribute.String("messaging.destination.name", name),
+			)
+			o.ObserveInt64(depth, int64(q.Messages), attrs)
+			o.ObserveInt64(consumers, int64(q.Consumers), attrs)
+		}
+		return nil
+	}, depth, consumers)
+
+	return err
+}
+
+// queueInspector keeps the channel used for passive declares. The broker
+// closes a channel whose passive declare fails, so it is reopened on demand.
+type queueInspector struct {
+	mq *MQ
+
+	mu      sync.Mutex
+	channel *amqp.Channel
+}
+
+func (i *queueInspector) inspect(name string) (amqp.Queue, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.channel == nil || i.channel.IsClosed() {
+		ch, err := i.mq.Conn.Channel()
+		if err != nil {
+			return amqp.Queue{}, err
+		}
+		i.channel = ch
+	}
+
+	return i.channel.QueueDeclarePassive(name, true, false, false, false, nil)
+}
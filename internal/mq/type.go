@@ -2,6 +2,18 @@ package mq
 
 import amqp "github.com/rabbitmq/amqp091-go"
 
+const (
+	// MessageKeyHeader carries the key used to keep related messages in order.
+	MessageKeyHeader = "x-message-key"
+	// DeadLetterReasonHeader records why a message was dead-lettered.
+	DeadLetterReasonHeader = "x-dead-letter-reason"
+	// DeadLetterQueueHeader records the queue a dead-lettered message came from.
+	DeadLetterQueueHeader = "x-dead-letter-queue"
+	// RetryCountHeader counts how many times a message was sent back through
+	// the retry queue.
+	RetryCountHeader = "x-retry-count"
+)
+
 type MQ struct {
 	URL     string
 	Conn    *amqp.Connection
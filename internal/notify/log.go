@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+// Log is a sink for local development. It appends each notification as a
+// JSON line to a file, or writes it to the log when no file is set.
+type Log struct {
+	path string
+
+	mu sync.Mutex
+}
+
+func NewLog(path string) *Log {
+	return &Log{path: path}
+}
+
+func (l *Log) Name() string { return entity.NotifyLog }
+
+func (l *Log) Send(ctx context.Context, m Message) error {
+	if l.path == "" {
+		slog.InfoContext(ctx, "Notification", "id", m.ID, "kind", m.Kind, "locale", m.Locale,
+			"subject", m.Subject, "body", m.Body)
+		return nil
+	}
+
+	line, err := json.Marshal(struct {
+		Message
+		SentAt time.Time
+	}{m, time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
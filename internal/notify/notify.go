@@ -0,0 +1,102 @@
+// Package notify delivers notifications about domain events to users.
+// Channel is the extension point for delivery mechanisms; SMTP, Webhook and
+// Log are the ones available, Log being meant for local development.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+// ErrRejected is returned when a channel refuses a message, for instance an
+// SMTP server rejecting the recipient. Any other error is transient and the
+// message can be sent again.
+var ErrRejected = errors.New("notification rejected")
+
+// Event is a domain event as read from the events exchange. Kind is its
+// routing key and Data its decoded JSON payload.
+type Event struct {
+	ID   string
+	Kind string
+	Data map[string]any
+}
+
+// Recipient returns the email of the user the event is about, or of the
+// referrer for referral rewards.
+func (e *Event) Recipient() string {
+	for _, key := range []string{"email", "referrer_email"} {
+		if v, ok := e.Data[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Message is a rendered notification.
+type Message struct {
+	// ID identifies the notification, so receivers can drop the duplicates
+	// of a delivery retried after it succeeded.
+	ID      string
+	Kind    string
+	Locale  string
+	To      string
+	Name    string
+	Subject string
+	Body    string
+}
+
+type Channel interface {
+	// Name is one of the entity.Notify* channels.
+	Name() string
+	Send(ctx context.Context, m Message) error
+}
+
+// ChannelsFromEnv returns the channels listed, comma separated, in
+// NOTIFY_CHANNELS, "log" by default.
+//
+//   - email sends through the SMTP server at SMTP_ADDR, as SMTP_FROM,
+//     authenticating with SMTP_USERNAME and SMTP_PASSWORD when set.
+//   - webhook posts to NOTIFY_WEBHOOK_URL, signing the body with
+//     NOTIFY_WEBHOOK_SECRET when set.
+//   - log appends to NOTIFY_LOG_FILE, or writes to the log when unset.
+func ChannelsFromEnv() ([]Channel, error) {
+	names := os.Getenv("NOTIFY_CHANNELS")
+	if names == "" {
+		names = entity.NotifyLog
+	}
+
+	var channels []Channel
+
+	for _, name := range strings.Split(names, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case entity.NotifyEmail:
+			addr := os.Getenv("SMTP_ADDR")
+			if addr == "" {
+				return nil, fmt.Errorf("SMTP_ADDR is required by the email channel")
+			}
+			from := os.Getenv("SMTP_FROM")
+			if from == "" {
+				from = "Capy Belga <no-reply@capybelga.local>"
+			}
+			channels = append(channels, NewSMTP(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD")))
+		case entity.NotifyWebhook:
+			url := os.Getenv("NOTIFY_WEBHOOK_URL")
+			if url == "" {
+				return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL is required by the webhook channel")
+			}
+			channels = append(channels, NewWebhook(url, os.Getenv("NOTIFY_WEBHOOK_SECRET"), 10*time.Second))
+		case entity.NotifyLog:
+			channels = append(channels, NewLog(os.Getenv("NOTIFY_LOG_FILE")))
+		default:
+			return nil, fmt.Errorf("unsupported notification channel %q", name)
+		}
+	}
+
+	return channels, nil
+}
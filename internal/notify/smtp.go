@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SMTP sends notifications as plain text emails.
+type SMTP struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP returns a channel sending through the server at addr, host:port.
+// Without a username the server is used unauthenticated, as local stand-ins
+// such as Mailpit expect.
+func NewSMTP(addr, from, username, password string) *SMTP {
+	s := &SMTP{addr: addr, from: from}
+
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return s
+}
+
+func (s *SMTP) Name() string { return entity.NotifyEmail }
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	_, span := telemetry.Tracer.Start(ctx, "SMTP.Send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("entity", "notify"),
+			attribute.String("notification.kind", m.Kind),
+			attribute.String("server.address", s.addr),
+		),
+	)
+	defer span.End()
+
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	err = smtp.SendMail(s.addr, s.auth, from.Address, []string{m.To}, s.compose(from, m))
+
+	// 5xx replies are permanent, the server will refuse the message again.
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		err = fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (s *SMTP) compose(from *mail.Address, m Message) []byte {
+	to := mail.Address{Name: m.Name, Address: m.To}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@capybelga>\r\n", m.ID)
+	fmt.Fprintf(&b, "Content-Language: %s\r\n", m.Locale)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.Write(bytes.ReplaceAll([]byte(m.Body), []byte("\n"), []byte("\r\n")))
+
+	return b.Bytes()
+}
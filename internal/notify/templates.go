@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Templates holds a template per locale and event kind, read from
+// templates/<locale>/<kind>.tmpl. Each one defines a "subject" and a "body".
+type Templates struct {
+	byLocale map[string]map[string]*template.Template
+}
+
+func LoadTemplates() (*Templates, error) {
+	t := &Templates{byLocale: make(map[string]map[string]*template.Template)}
+
+	for _, locale := range entity.Locales {
+		files, err := fs.Glob(templateFS, path.Join("templates", locale, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+
+		t.byLocale[locale] = make(map[string]*template.Template)
+
+		for _, file := range files {
+			kind := strings.TrimSuffix(path.Base(file), ".tmpl")
+
+			tmpl, err := template.New(kind).Funcs(templateFuncs(locale)).ParseFS(templateFS, file)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range []string{"subject", "body"} {
+				if tmpl.Lookup(name) == nil {
+					return nil, fmt.Errorf("template %s does not define %q", file, name)
+				}
+			}
+
+			t.byLocale[locale][kind] = tmpl
+		}
+	}
+
+	return t, nil
+}
+
+// Has reports whether events of kind are notified.
+func (t *Templates) Has(kind string) bool {
+	_, ok := t.byLocale[entity.DefaultLocale][kind]
+	return ok
+}
+
+// Render returns the subject and body of the notification for an event of
+// kind, in locale or else in the default locale.
+func (t *Templates) Render(locale, kind string, data map[string]any) (subject, body string, err error) {
+	tmpl, ok := t.byLocale[locale][kind]
+	if !ok {
+		tmpl, ok = t.byLocale[entity.DefaultLocale][kind]
+	}
+	if !ok {
+		return "", "", fmt.Errorf("no template for %s", kind)
+	}
+
+	var b bytes.Buffer
+
+	if err := tmpl.ExecuteTemplate(&b, "subject", data); err != nil {
+		return "", "", err
+	}
+	subject = strings.TrimSpace(b.String())
+
+	b.Reset()
+	if err := tmpl.ExecuteTemplate(&b, "body", data); err != nil {
+		return "", "", err
+	}
+
+	return subject, strings.TrimSpace(b.String()) + "\n", nil
+}
+
+func templateFuncs(locale string) template.FuncMap {
+	dateLayout, decimal := "Jan 2, 2006", "."
+	if locale == entity.LocalePortuguese {
+		dateLayout, decimal = "02/01/2006", ","
+	}
+
+	return template.FuncMap{
+		// money formats an amount in minor units, e.g. BRL 49,90.
+		"money": func(cents any, currency any) string {
+			n := toInt64(cents)
+			sign := ""
+			if n < 0 {
+				sign, n = "-", -n
+			}
+			return fmt.Sprintf("%v %s%d%s%02d", currency, sign, n/100, decimal, n%100)
+		},
+		// date formats an RFC 3339 timestamp of an event payload.
+		"date": func(v any) string {
+			s, _ := v.(string)
+			ts, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return s
+			}
+			return ts.Format(dateLayout)
+		},
+	}
+}
+
+func toInt64(v any) int64 {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := n.Int64()
+		return i
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	default:
+		return 0
+	}
+}
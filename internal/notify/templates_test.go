@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
+)
+
+func TestRenderCancelledNamesTheMembership(t *testing.T) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(event.MembershipCancelled{
+		Email:      "capy@email.com",
+		ClubName:   "Clube Capy",
+		PlanType:   "premium",
+		OccurredAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, locale := range entity.Locales {
+		t.Run(locale, func(t *testing.T) {
+			var data map[string]any
+			if err := json.Unmarshal(raw, &data); err != nil {
+				t.Fatal(err)
+			}
+			data["name"] = "Capy"
+
+			subject, body, err := templates.Render(locale, event.MembershipCancelledKey, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range []string{"Clube Capy", "premium"} {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not mention %q:\n%s", want, body)
+				}
+			}
+			if !strings.Contains(subject, "Clube Capy") {
+				t.Errorf("subject does not mention the club: %s", subject)
+			}
+			if strings.Contains(subject+body, "<no value>") {
+				t.Errorf("template refers to a field the event does not carry:\n%s\n%s", subject, body)
+			}
+		})
+	}
+}
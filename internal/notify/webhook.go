@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the webhook body, keyed with
+// the webhook secret.
+const SignatureHeader = "X-Capybelga-Signature"
+
+// Webhook posts notifications as JSON to a URL, such as a messaging gateway
+// or a CRM.
+type Webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhook(url, secret string, timeout time.Duration) *Webhook {
+	return &Webhook{url: url, secret: []byte(secret), client: &http.Client{Timeout: timeout}}
+}
+
+func (w *Webhook) Name() string { return entity.NotifyWebhook }
+
+type webhookPayload struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Locale  string `json:"locale"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func (w *Webhook) Send(ctx context.Context, m Message) error {
+	cctx, span := telemetry.Tracer.Start(ctx, "Webhook.Send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("entity", "notify"),
+			attribute.String("notification.kind", m.Kind),
+		),
+	)
+	defer span.End()
+
+	err := w.send(cctx, m, span)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (w *Webhook) send(ctx context.Context, m Message, span trace.Span) error {
+	body, err := json.Marshal(webhookPayload{
+		ID:      m.ID,
+		Kind:    m.Kind,
+		Locale:  m.Locale,
+		Email:   m.To,
+		Name:    m.Name,
+		Subject: m.Subject,
+		Body:    m.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", m.ID)
+
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	// Other client errors won't be accepted on a retry either.
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: webhook answered %s", ErrRejected, resp.Status)
+	default:
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+}
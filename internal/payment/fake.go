@@ -0,0 +1,65 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Fake is an in-memory Provider. It declines a random share of the charges
+// and remembers every outcome by idempotency key, so a retried charge gets
+// the same answer.
+type Fake struct {
+	DeclineRate float64
+
+	mu      sync.Mutex
+	charges map[string]fakeOutcome
+}
+
+type fakeOutcome struct {
+	receipt Receipt
+	err     error
+}
+
+func NewFake(declineRate float64) *Fake {
+	return &Fake{DeclineRate: declineRate, charges: make(map[string]fakeOutcome)}
+}
+
+func (f *Fake) Charge(ctx context.Context, c Charge) (Receipt, error) {
+	_, span := telemetry.Tracer.Start(ctx, "FakeProvider.Charge",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("entity", "payment"),
+			attribute.Int64("payment.amount", c.Amount),
+			attribute.String("payment.currency", c.Currency),
+		),
+	)
+	defer span.End()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out, ok := f.charges[c.IdempotencyKey]
+	if !ok {
+		out.receipt = Receipt{ID: fmt.Sprintf("fake_%d", len(f.charges)+1), Amount: c.Amount}
+		if rand.Float64() < f.DeclineRate {
+			out = fakeOutcome{err: ErrDeclined}
+		}
+		f.charges[c.IdempotencyKey] = out
+	}
+
+	span.SetAttributes(attribute.Bool("payment.replayed", ok))
+
+	if out.err != nil {
+		span.RecordError(out.err)
+		span.SetStatus(codes.Error, out.err.Error())
+	}
+
+	return out.receipt, out.err
+}
@@ -0,0 +1,56 @@
+// Package payment charges members through a payment provider. Provider is
+// the extension point for real gateways; Fake is an in-memory provider for
+// development and tests.
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrDeclined is returned when the provider refuses a charge. Any other error
+// is transient and the charge can be retried.
+var ErrDeclined = errors.New("payment declined")
+
+// Charge is a request to collect Amount, in minor units of Currency.
+type Charge struct {
+	// IdempotencyKey identifies the charge, so retrying it never collects
+	// twice.
+	IdempotencyKey string
+	Customer       string
+	Amount         int64
+	Currency       string
+	Description    string
+}
+
+type Receipt struct {
+	ID     string
+	Amount int64
+}
+
+type Provider interface {
+	Charge(ctx context.Context, c Charge) (Receipt, error)
+}
+
+// NewProviderFromEnv returns the provider named by PAYMENT_PROVIDER. Only
+// "fake", the default, exists so far; FAKE_PAYMENT_DECLINE_RATE sets the
+// share of its charges that are declined.
+func NewProviderFromEnv() (Provider, error) {
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "", "fake":
+		rate := 0.0
+		if v := os.Getenv("FAKE_PAYMENT_DECLINE_RATE"); v != "" {
+			r, err := strconv.ParseFloat(v, 64)
+			if err != nil || r < 0 || r > 1 {
+				return nil, fmt.Errorf("invalid FAKE_PAYMENT_DECLINE_RATE %q", v)
+			}
+			rate = r
+		}
+		return NewFake(rate), nil
+	default:
+		return nil, fmt.Errorf("unsupported payment provider %q", name)
+	}
+}
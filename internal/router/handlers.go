@@ -1,24 +1,102 @@
 package router
 
 import (
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
 
 	middlewares "github.com/hazkall/capy-belga/internal/middleware"
 )
 
 func HandlersPipeline(deps *HandlerDeps) {
-	http.Handle("/contrate/discount-club", middlewarePipeline(discountClubPostHandler(deps.ClubChannel)))
-	http.Handle("/contrate/discount-club/signup", middlewarePipeline(discountClubSignupPostHandler(deps.ClubChannel)))
+	http.Handle("/contrate/discount-club", middlewarePipeline(discountClubPostHandler(deps.ClubChannel, deps.PlanService)))
+	http.Handle("/contrate/discount-club/signup", middlewarePipeline(discountClubSignupPostHandler(deps.ClubChannel, deps.AttributionService)))
 	http.Handle("/contrate/discount-club/user", middlewarePipeline(discountClubUserPostHandler(deps.ClubChannel)))
 	http.Handle("/user/state", middlewarePipeline(userState(deps.UserService)))
+	http.Handle("/user/update", middlewarePipeline(updateUser(deps.UserService)))
+	http.Handle("/user/deactivate", middlewarePipeline(deactivateUser(deps.UserService)))
+	http.Handle("/user/reactivate", middlewarePipeline(reactivateUser(deps.UserService)))
+	http.Handle("/user/erase", middlewarePipeline(eraseUser(deps.UserService)))
+	http.Handle("/user/referral", middlewarePipeline(referralSummary(deps.UserService)))
+	http.Handle("/user/notifications", middlewarePipeline(notificationPreferences(deps.NotificationService)))
+	http.Handle("/user/notifications/update", middlewarePipeline(updateNotificationPreferences(deps.NotificationService)))
 	http.Handle("/user/cancel/club", middlewarePipeline(cancelUserClub(deps.SignupService)))
 	http.Handle("/user/plan/status", middlewarePipeline(userPlanSignup(deps.SignupService)))
+	http.Handle("/user/benefits", middlewarePipeline(memberRedemptions(deps.PartnerService)))
+	http.Handle("/club/update", middlewarePipeline(updateClub(deps.ClubService, deps.PlanService)))
+	http.Handle("/club/archive", middlewarePipeline(archiveClub(deps.ClubService)))
+	http.Handle("/club/members", middlewarePipeline(clubMembers(deps.ClubService)))
+	http.Handle("/plans", middlewarePipeline(methods{
+		http.MethodGet:  listPlans(deps.PlanService),
+		http.MethodPost: createPlan(deps.PlanService),
+	}))
+	http.Handle("/plans/{code}", middlewarePipeline(methods{
+		http.MethodGet:    getPlan(deps.PlanService),
+		http.MethodPut:    updatePlan(deps.PlanService),
+		http.MethodDelete: deletePlan(deps.PlanService),
+	}))
+	http.Handle("/coupons", middlewarePipeline(methods{
+		http.MethodGet:  listCoupons(deps.CouponService),
+		http.MethodPost: createCoupon(deps.CouponService, deps.PlanService),
+	}))
+	http.Handle("/coupons/{code}", middlewarePipeline(methods{http.MethodGet: getCoupon(deps.CouponService)}))
+	http.Handle("/attribution/registry", middlewarePipeline(methods{
+		http.MethodGet:  attributionRegistry(deps.AttributionService),
+		http.MethodPost: addRegistryEntry(deps.AttributionService),
+	}))
+	http.Handle("/attribution/registry/{kind}/{value}", middlewarePipeline(methods{http.MethodDelete: removeRegistryEntry(deps.AttributionService)}))
+	http.Handle("/partners", middlewarePipeline(methods{
+		http.MethodGet:  listPartners(deps.PartnerService),
+		http.MethodPost: createPartner(deps.PartnerService),
+	}))
+	http.Handle("/benefits", middlewarePipeline(methods{
+		http.MethodGet:  listBenefits(deps.PartnerService),
+		http.MethodPost: createBenefit(deps.PartnerService),
+	}))
+	http.Handle("/benefits/{code}/redeem", middlewarePipeline(methods{http.MethodPost: redeemBenefit(deps.PartnerService)}))
+	http.Handle("/healthz", middlewarePipeline(healthCheck()))
 
 }
 
+// AdminHandlers serves the operational endpoints, which are kept off the
+// public port.
+func AdminHandlers(deps *AdminDeps) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/admin/sampling", middlewarePipeline(methods{
+		http.MethodGet: getSampling(deps.Sampler),
+		http.MethodPut: setSampling(deps.Sampler),
+	}))
+
+	if deps.Metrics != nil {
+		mux.Handle("/metrics", methods{http.MethodGet: deps.Metrics})
+	}
+
+	return mux
+}
+
 func middlewarePipeline(handler http.Handler) http.Handler {
 	h := middlewares.RecoverMiddleware(handler)
 	h = middlewares.OtelMiddleware(h)
-	h = middlewares.RequestsCountMiddleware(h)
 	return h
 }
+
+// methods routes a request to the handler of its method, so a path serves
+// several methods with a single route. HEAD is served by the GET handler.
+type methods map[string]http.Handler
+
+func (m methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, ok := m[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		h, ok = m[http.MethodGet]
+	}
+
+	if !ok {
+		allowed := slices.Sorted(maps.Keys(m))
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "Método não permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.ServeHTTP(w, r)
+}
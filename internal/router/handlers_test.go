@@ -0,0 +1,369 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	oteltrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+var spans = tracetest.NewInMemoryExporter()
+
+func TestMain(m *testing.M) {
+	tp := oteltrace.NewTracerProvider(oteltrace.WithSyncer(spans))
+	defer tp.Shutdown(context.Background())
+
+	telemetry.Tracer = tp.Tracer("test")
+	telemetry.Meter = metricnoop.NewMeterProvider().Meter("test")
+
+	if err := telemetry.MetricsStart(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestAdminHandlers(t *testing.T) {
+	sampler, err := telemetry.NewSampler(telemetry.SamplerConfig{Name: "always_on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := AdminHandlers(&AdminDeps{Sampler: sampler})
+
+	tests := []struct {
+		method     string
+		body       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{http.MethodGet, "", http.StatusOK, ""},
+		{http.MethodHead, "", http.StatusOK, ""},
+		{http.MethodPut, `{"ratio": 0.5}`, http.StatusOK, ""},
+		{http.MethodPost, `{"ratio": 0.5}`, http.StatusMethodNotAllowed, "GET, PUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			spans.Reset()
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(tt.method, "/admin/sampling", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", allow, tt.wantAllow)
+			}
+
+			got := spans.GetSpans()
+			if len(got) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(got))
+			}
+
+			if want := tt.method + " /admin/sampling"; got[0].Name != want {
+				t.Errorf("span name = %q, want %q", got[0].Name, want)
+			}
+			for _, attr := range got[0].Attributes {
+				if attr.Key == "http.route" && attr.Value.AsString() != "/admin/sampling" {
+					t.Errorf("http.route = %q, want /admin/sampling", attr.Value.AsString())
+				}
+			}
+		})
+	}
+
+	if sampler.Ratio() != 0.5 {
+		t.Errorf("Ratio() = %g after PUT, want 0.5", sampler.Ratio())
+	}
+}
+
+func TestRequestTelemetryOmitsRawPath(t *testing.T) {
+	sampler, err := telemetry.NewSampler(telemetry.SamplerConfig{Name: "always_on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	spans.Reset()
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/sampling?email=capy@email.com", nil)
+	r.Header.Set("Referer", "https://capy.example/signup?email=capy@email.com")
+	AdminHandlers(&AdminDeps{Sampler: sampler}).ServeHTTP(httptest.NewRecorder(), r)
+
+	got := spans.GetSpans()
+	if len(got) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(got))
+	}
+	for _, attr := range got[0].Attributes {
+		if strings.Contains(attr.Value.Emit(), "capy@email.com") {
+			t.Errorf("span attribute %s = %q", attr.Key, attr.Value.Emit())
+		}
+	}
+
+	if !strings.Contains(logs.String(), "/admin/sampling") {
+		t.Errorf("request log %q has no route", logs.String())
+	}
+	if strings.Contains(logs.String(), "capy@email.com") {
+		t.Errorf("request log %q has the raw request URI", logs.String())
+	}
+}
+
+// handlerDeps are the services behind the routes of HandlersPipeline, which
+// registers them on the default mux once. mockHandlers points them at a new
+// mock database for each test.
+var (
+	handlerDeps = &HandlerDeps{
+		PlanService:        &service.PlanService{},
+		CouponService:      &service.CouponService{},
+		AttributionService: &service.AttributionService{},
+	}
+	registerHandlers sync.Once
+)
+
+func mockHandlers(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+
+	registerHandlers.Do(func() { HandlersPipeline(handlerDeps) })
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	repo := repository.New(&db.Postgres{DB: conn})
+	handlerDeps.PlanService.Repo = repo
+	handlerDeps.CouponService.Repo = repo
+	handlerDeps.AttributionService.Repo = repo
+
+	return mock
+}
+
+type handlerTest struct {
+	name       string
+	method     string
+	path       string
+	body       string
+	expect     func(sqlmock.Sqlmock)
+	wantStatus int
+	wantAllow  string
+	wantBody   string
+	wantSpan   string
+}
+
+// runHandlerTests serves each request through the default mux and checks the
+// response and the name of the server span.
+func runHandlerTests(t *testing.T, tests []handlerTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockHandlers(t)
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+			spans.Reset()
+
+			w := httptest.NewRecorder()
+			http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", allow, tt.wantAllow)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want %q in it", w.Body, tt.wantBody)
+			}
+
+			var server []string
+			for _, s := range spans.GetSpans() {
+				if s.SpanKind == trace.SpanKindServer {
+					server = append(server, s.Name)
+				}
+			}
+			if len(server) != 1 || server[0] != tt.wantSpan {
+				t.Errorf("server spans = %q, want %q", server, tt.wantSpan)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// planRows are the columns of the plans the repository reads.
+var planRows = []string{"code", "name", "price_cents", "currency", "billing_interval", "trial_days", "benefits"}
+
+func TestPlanHandlers(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name:   "get",
+			method: http.MethodGet,
+			path:   "/plans/ouro",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM plans WHERE code = \$1`).WithArgs("ouro").
+					WillReturnRows(sqlmock.NewRows(planRows).AddRow("ouro", "Ouro", 2990, "BRL", "monthly", 7, "{frete}"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `"price_cents":2990`,
+			wantSpan:   "GET /plans/{code}",
+		},
+		{
+			name:   "get missing",
+			method: http.MethodGet,
+			path:   "/plans/nada",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM plans WHERE code = \$1`).WithArgs("nada").WillReturnRows(sqlmock.NewRows(planRows))
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Plano não encontrado",
+			wantSpan:   "GET /plans/{code}",
+		},
+		{
+			name:       "create invalid",
+			method:     http.MethodPost,
+			path:       "/plans",
+			body:       `{"code": "ouro"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Erro de validação",
+			wantSpan:   "POST /plans",
+		},
+		{
+			name:   "delete in use",
+			method: http.MethodDelete,
+			path:   "/plans/ouro",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM plans`).WithArgs("ouro").WillReturnError(&pq.Error{Code: "23503"})
+			},
+			wantStatus: http.StatusConflict,
+			wantBody:   "Plano em uso",
+			wantSpan:   "DELETE /plans/{code}",
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPatch,
+			path:       "/plans",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET, POST",
+			wantSpan:   "PATCH /plans",
+		},
+	})
+}
+
+func TestCouponHandlers(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name:   "get missing",
+			method: http.MethodGet,
+			path:   "/coupons/NADA",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM coupons WHERE code = \$1`).WithArgs("NADA").WillReturnRows(sqlmock.NewRows([]string{"code"}))
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Cupom não encontrado",
+			wantSpan:   "GET /coupons/{code}",
+		},
+		{
+			name:       "create malformed",
+			method:     http.MethodPost,
+			path:       "/coupons",
+			body:       `{"code": `,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Erro ao decodificar o JSON",
+			wantSpan:   "POST /coupons",
+		},
+		{
+			name:   "create for a plan out of the catalogue",
+			method: http.MethodPost,
+			path:   "/coupons",
+			body:   `{"code": "BEMVINDO", "discount_type": "percent", "discount_value": 10, "plan_types": ["diamante"]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM plans ORDER BY`).
+					WillReturnRows(sqlmock.NewRows(planRows).AddRow("ouro", "Ouro", 2990, "BRL", "monthly", 7, "{}"))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Coupon plan types must be among [ouro]",
+			wantSpan:   "POST /coupons",
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPut,
+			path:       "/coupons/BEMVINDO",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET",
+			wantSpan:   "PUT /coupons/{code}",
+		},
+	})
+}
+
+func TestAttributionRegistryHandlers(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name:   "remove",
+			method: http.MethodDelete,
+			path:   "/attribution/registry/store/loja-42",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM attribution_registry`).WithArgs("store", "loja-42").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusNoContent,
+			wantSpan:   "DELETE /attribution/registry/{kind}/{value}",
+		},
+		{
+			name:   "remove unregistered",
+			method: http.MethodDelete,
+			path:   "/attribution/registry/utm_source/tiktok",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM attribution_registry`).WithArgs("utm_source", "tiktok").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "Valor não registrado",
+			wantSpan:   "DELETE /attribution/registry/{kind}/{value}",
+		},
+		{
+			name:       "add unknown kind",
+			method:     http.MethodPost,
+			path:       "/attribution/registry",
+			body:       `{"kind": "coupon", "value": "BEMVINDO"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Registry kind must be one of",
+			wantSpan:   "POST /attribution/registry",
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodGet,
+			path:       "/attribution/registry/store/loja-42",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "DELETE",
+			wantSpan:   "GET /attribution/registry/{kind}/{value}",
+		},
+	})
+}
@@ -5,23 +5,25 @@ import (
 
 	"github.com/hazkall/capy-belga/internal/controller"
 	"github.com/hazkall/capy-belga/internal/domain/service"
+	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
 )
 
-func discountClubPostHandler(ch chan *controller.Message) http.HandlerFunc {
+func discountClubPostHandler(ch chan *mq.Envelope, planService *service.PlanService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		controller.ControllerCreateDiscountClub(w, r, ch)
+		controller.ControllerCreateDiscountClub(w, r, ch, planService)
 	}
 }
 
-func discountClubUserPostHandler(ch chan *controller.Message) http.HandlerFunc {
+func discountClubUserPostHandler(ch chan *mq.Envelope) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		controller.ControllerCreateUser(w, r, ch)
 	}
 }
 
-func discountClubSignupPostHandler(ch chan *controller.Message) http.HandlerFunc {
+func discountClubSignupPostHandler(ch chan *mq.Envelope, attributionService *service.AttributionService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		controller.ControllerCreateClubSignup(w, r, ch)
+		controller.ControllerCreateClubSignup(w, r, ch, attributionService)
 	}
 }
 
@@ -42,3 +44,183 @@ func cancelUserClub(signupService *service.SignupService) http.HandlerFunc {
 		controller.ControllerCancelClubSignup(w, r, signupService)
 	}
 }
+
+func updateUser(userService *service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerUpdateUser(w, r, userService)
+	}
+}
+
+func deactivateUser(userService *service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerDeactivateUser(w, r, userService)
+	}
+}
+
+func reactivateUser(userService *service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerReactivateUser(w, r, userService)
+	}
+}
+
+func eraseUser(userService *service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerEraseUser(w, r, userService)
+	}
+}
+
+func updateClub(clubService *service.ClubService, planService *service.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerUpdateClub(w, r, clubService, planService)
+	}
+}
+
+func archiveClub(clubService *service.ClubService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerArchiveClub(w, r, clubService)
+	}
+}
+
+func clubMembers(clubService *service.ClubService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerClubMembers(w, r, clubService)
+	}
+}
+
+func listPlans(planService *service.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerListPlans(w, r, planService)
+	}
+}
+
+func getPlan(planService *service.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerGetPlan(w, r, planService)
+	}
+}
+
+func createPlan(planService *service.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerCreatePlan(w, r, planService)
+	}
+}
+
+func updatePlan(planService *service.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerUpdatePlan(w, r, planService)
+	}
+}
+
+func deletePlan(planService *service.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerDeletePlan(w, r, planService)
+	}
+}
+
+func listCoupons(couponService *service.CouponService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerListCoupons(w, r, couponService)
+	}
+}
+
+func getCoupon(couponService *service.CouponService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerGetCoupon(w, r, couponService)
+	}
+}
+
+func createCoupon(couponService *service.CouponService, planService *service.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerCreateCoupon(w, r, couponService, planService)
+	}
+}
+
+func createPartner(partnerService *service.PartnerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerCreatePartner(w, r, partnerService)
+	}
+}
+
+func listPartners(partnerService *service.PartnerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerListPartners(w, r, partnerService)
+	}
+}
+
+func createBenefit(partnerService *service.PartnerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerCreateBenefit(w, r, partnerService)
+	}
+}
+
+func listBenefits(partnerService *service.PartnerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerListBenefits(w, r, partnerService)
+	}
+}
+
+func redeemBenefit(partnerService *service.PartnerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerRedeemBenefit(w, r, partnerService)
+	}
+}
+
+func memberRedemptions(partnerService *service.PartnerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerMemberRedemptions(w, r, partnerService)
+	}
+}
+
+func referralSummary(userService *service.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerReferralSummary(w, r, userService)
+	}
+}
+
+func notificationPreferences(notificationService *service.NotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerNotificationPreferences(w, r, notificationService)
+	}
+}
+
+func updateNotificationPreferences(notificationService *service.NotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerUpdateNotificationPreferences(w, r, notificationService)
+	}
+}
+
+func attributionRegistry(attributionService *service.AttributionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerAttributionRegistry(w, r, attributionService)
+	}
+}
+
+func addRegistryEntry(attributionService *service.AttributionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerAddRegistryEntry(w, r, attributionService)
+	}
+}
+
+func removeRegistryEntry(attributionService *service.AttributionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerRemoveRegistryEntry(w, r, attributionService)
+	}
+}
+
+func healthCheck() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerHealthCheck(w, r)
+	}
+}
+
+func getSampling(sampler *telemetry.Sampler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerGetSampling(w, r, sampler)
+	}
+}
+
+func setSampling(sampler *telemetry.Sampler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.ControllerSetSampling(w, r, sampler)
+	}
+}
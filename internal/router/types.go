@@ -1,13 +1,27 @@
 package router
 
 import (
-	"github.com/hazkall/capy-belga/internal/controller"
+	"net/http"
+
 	"github.com/hazkall/capy-belga/internal/domain/service"
+	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
 )
 
 type HandlerDeps struct {
-	ClubChannel   chan *controller.Message
-	UserService   *service.UserService
-	ClubService   *service.ClubService
-	SignupService *service.SignupService
+	ClubChannel         chan *mq.Envelope
+	UserService         *service.UserService
+	ClubService         *service.ClubService
+	SignupService       *service.SignupService
+	PlanService         *service.PlanService
+	CouponService       *service.CouponService
+	PartnerService      *service.PartnerService
+	AttributionService  *service.AttributionService
+	NotificationService *service.NotificationService
+}
+
+type AdminDeps struct {
+	Sampler *telemetry.Sampler
+	// Metrics serves /metrics when the Prometheus exporter is enabled.
+	Metrics http.Handler
 }
@@ -44,3 +44,22 @@ func handleShutdown(ctx context.Context, server *http.Server) {
 		slog.Info("Graceful shutdown completed", "signal", sig)
 	}
 }
+
+// StartAdminServer serves handler on the admin address in the background.
+// It shuts down on the same signals as the main server.
+func StartAdminServer(ctx context.Context, serverAddress string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              serverAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go handleShutdown(ctx, server)
+
+	go func() {
+		slog.Info("Admin server started successfully", "address", serverAddress)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Failed to start admin server", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,288 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hazkall/capy-belga/internal/contract"
+	"github.com/hazkall/capy-belga/internal/db"
+	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+// ErrPermanent marks failures that will not go away on redelivery, such as a
+// malformed body. Messages failing with it are dead-lettered.
+var ErrPermanent = errors.New("permanent failure")
+
+// Permanent wraps err so the consumer dead-letters the message instead of
+// requeueing it.
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+type outcome string
+
+const (
+	outcomeAck        outcome = "ack"
+	outcomeDuplicate  outcome = "duplicate"
+	outcomeRequeue    outcome = "requeue"
+	outcomeRetry      outcome = "retry"
+	outcomeDeadLetter outcome = "dead_letter"
+)
+
+// maxRetryDelay caps the doubling wait between retries.
+const maxRetryDelay = time.Hour
+
+func classify(err error) outcome {
+	switch {
+	case err == nil:
+		return outcomeAck
+	case db.IsUniqueViolation(err):
+		return outcomeDuplicate
+	case errors.Is(err, ErrPermanent):
+		return outcomeDeadLetter
+	default:
+		return outcomeRequeue
+	}
+}
+
+// deadLetterer publishes the deliveries that can never be processed, which
+// *mq.MQ does to the dead-letter queue of the consumed queue.
+type deadLetterer interface {
+	PublishDeadLetter(ctx context.Context, d amqp.Delivery, queueName, reason string) error
+}
+
+// redeliverer also delays the deliveries that failed for now, which *mq.MQ
+// does through the retry queue of the consumed queue.
+type redeliverer interface {
+	deadLetterer
+	PublishRetry(ctx context.Context, d amqp.Delivery, queueName string, delay time.Duration) error
+}
+
+// RetryAfter is implemented by errors that know when the message is worth
+// trying again, overriding the doubling delay of the consumer.
+type RetryAfter interface {
+	RetryAfter() time.Duration
+}
+
+// delivery is what a Handler can learn about the delivery of its message,
+// through deliveryFrom.
+type delivery struct {
+	messageID   string
+	attempt     int
+	maxAttempts int
+}
+
+type deliveryKey struct{}
+
+// deliveryFrom returns the delivery of the message ctx is handling.
+func deliveryFrom(ctx context.Context) delivery {
+	d, _ := ctx.Value(deliveryKey{}).(delivery)
+	return d
+}
+
+// last reports whether a failure now dead-letters the message instead of
+// retrying it.
+func (d delivery) last() bool {
+	return d.attempt >= d.maxAttempts
+}
+
+// Decoder turns a delivery into the message a Handler works on.
+type Decoder[T any] func(d amqp.Delivery) (*T, error)
+
+// Handler processes one decoded message. Returning an error wrapped with
+// Permanent dead-letters the message, a unique violation is treated as an
+// already processed duplicate and any other error retries it later, until
+// the queue's MaxAttempts run out.
+type Handler[T any] func(ctx context.Context, msg *T) error
+
+// Consumer reads a queue and applies the same decoding, tracing, metrics and
+// acknowledgement policy to every message type.
+type Consumer[T any] struct {
+	Name   string
+	Config ConsumerConfig
+	Decode Decoder[T]
+	Handle Handler[T]
+
+	// Attributes, when set, adds message specific attributes to the span of
+	// a successfully handled message.
+	Attributes func(msg *T) []attribute.KeyValue
+}
+
+func NewConsumer[T any](name string, cfg ConsumerConfig, decode Decoder[T], handle Handler[T]) *Consumer[T] {
+	return &Consumer[T]{
+		Name:   name,
+		Config: cfg,
+		Decode: decode,
+		Handle: handle,
+	}
+}
+
+func (c *Consumer[T]) WithAttributes(fn func(msg *T) []attribute.KeyValue) *Consumer[T] {
+	c.Attributes = fn
+	return c
+}
+
+// Run consumes the configured queue until its deliveries channel is closed.
+func (c *Consumer[T]) Run(ctx context.Context, m *mq.MQ) error {
+	deliveries, ch, err := m.ConsumeMessages(c.Config.Queue, c.Config.Prefetch)
+	if err != nil {
+		slog.Error("Failed to consume messages", "queue", c.Config.Queue, "error", err)
+		return err
+	}
+
+	defer ch.Close()
+
+	dispatch(deliveries, c.Config.Concurrency, func(d amqp.Delivery) {
+		c.process(ctx, m, d)
+	})
+
+	return nil
+}
+
+func (c *Consumer[T]) process(ctx context.Context, m redeliverer, d amqp.Delivery) {
+	cctx, span := telemetry.Tracer.Start(ctx, c.Name,
+		trace.WithAttributes(
+			attribute.String("entity", "worker"),
+			attribute.String("queue_name", c.Config.Queue),
+			attribute.String("message_type", d.Type),
+			attribute.String("message_id", d.MessageId),
+			attribute.String("correlation_id", d.CorrelationId),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+
+	if published := mq.PublishedAt(d); !published.IsZero() {
+		telemetry.MessageLag.Record(cctx, start.Sub(published).Seconds(),
+			metric.WithAttributes(attribute.String("queue_name", c.Config.Queue)),
+		)
+	}
+
+	attempt := mq.RetryCount(d) + 1
+	span.SetAttributes(attribute.Int("attempt", attempt))
+
+	hctx := context.WithValue(cctx, deliveryKey{}, delivery{
+		messageID:   d.MessageId,
+		attempt:     attempt,
+		maxAttempts: c.Config.MaxAttempts,
+	})
+
+	err := c.handle(hctx, d, span)
+
+	result := classify(err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	if result == outcomeRequeue {
+		if attempt >= c.Config.MaxAttempts {
+			result = outcomeDeadLetter
+			err = fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		} else {
+			result = outcomeRetry
+		}
+	}
+
+	switch result {
+	case outcomeAck:
+		d.Ack(false)
+	case outcomeDuplicate:
+		slog.WarnContext(cctx, "Duplicate message detected, skipping", "queue", c.Config.Queue, "error", err)
+		d.Ack(false)
+	case outcomeDeadLetter:
+		slog.ErrorContext(cctx, "Message cannot be processed, dead-lettering", "queue", c.Config.Queue, "error", err)
+		if dlErr := m.PublishDeadLetter(cctx, d, c.Config.Queue, err.Error()); dlErr != nil {
+			slog.ErrorContext(cctx, "Failed to publish dead letter, requeueing", "queue", c.Config.Queue, "error", dlErr)
+			span.RecordError(dlErr)
+			result = outcomeRequeue
+			d.Nack(false, true)
+			break
+		}
+		d.Ack(false)
+	case outcomeRetry:
+		delay := c.retryDelay(err, attempt)
+		slog.ErrorContext(cctx, "Error processing message, retrying later", "queue", c.Config.Queue, "attempt", attempt, "delay", delay, "error", err)
+		if rErr := m.PublishRetry(cctx, d, c.Config.Queue, delay); rErr != nil {
+			slog.ErrorContext(cctx, "Failed to publish retry, requeueing", "queue", c.Config.Queue, "error", rErr)
+			span.RecordError(rErr)
+			result = outcomeRequeue
+			d.Nack(false, true)
+			break
+		}
+		d.Ack(false)
+	}
+
+	span.SetAttributes(attribute.String("outcome", string(result)))
+
+	attrs := metric.WithAttributes(
+		attribute.String("queue_name", c.Config.Queue),
+		attribute.String("outcome", string(result)),
+	)
+
+	telemetry.MessagesConsumedCounter.Add(cctx, 1, attrs)
+	telemetry.MessageProcessDuration.Record(cctx, time.Since(start).Seconds(), attrs)
+}
+
+// retryDelay is how long the message that failed with err on attempt waits
+// before it is delivered again.
+func (c *Consumer[T]) retryDelay(err error, attempt int) time.Duration {
+	var after RetryAfter
+	if errors.As(err, &after) {
+		return after.RetryAfter()
+	}
+
+	delay := c.Config.RetryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+func (c *Consumer[T]) handle(ctx context.Context, d amqp.Delivery, span trace.Span) error {
+	msg, err := c.Decode(d)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	if err := c.Handle(ctx, msg); err != nil {
+		return err
+	}
+
+	if c.Attributes != nil {
+		span.SetAttributes(c.Attributes(msg)...)
+	}
+
+	return nil
+}
+
+// DecodeEnvelope decodes a delivery through the contract registry, upcasting
+// older schema versions. Unknown types, unsupported versions and schema
+// violations are returned as errors, which dead-letters the message.
+func DecodeEnvelope[T any](d amqp.Delivery) (*T, error) {
+	e := mq.EnvelopeFromDelivery(d)
+
+	v, err := contract.Registry.Decode(e)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, ok := v.(*T)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s decodes to %T", mq.ErrUnknownType, e.Type, v)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,218 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+func TestMain(m *testing.M) {
+	telemetry.Tracer = tracenoop.NewTracerProvider().Tracer("test")
+	telemetry.Meter = metricnoop.NewMeterProvider().Meter("test")
+
+	if err := telemetry.MetricsStart(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+// acknowledger records how a delivery was settled.
+type acknowledger struct {
+	acked, nacked, requeued bool
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// redeliveries records the dead letters and retries a consumer publishes.
+type redeliveries struct {
+	err     error
+	reasons []string
+	delays  []time.Duration
+}
+
+func (r *redeliveries) PublishDeadLetter(ctx context.Context, _ amqp.Delivery, queueName, reason string) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.reasons = append(r.reasons, reason)
+	return nil
+}
+
+func (r *redeliveries) PublishRetry(ctx context.Context, _ amqp.Delivery, queueName string, delay time.Duration) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.delays = append(r.delays, delay)
+	return nil
+}
+
+// retryLater is a transient error that asks for a given delay.
+type retryLater time.Duration
+
+func (r retryLater) Error() string             { return "retry later" }
+func (r retryLater) RetryAfter() time.Duration { return time.Duration(r) }
+
+type message struct{ ID string }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want outcome
+	}{
+		{"success", nil, outcomeAck},
+		{"unique violation", &pq.Error{Code: "23505"}, outcomeDuplicate},
+		{"wrapped unique violation", fmt.Errorf("insert: %w", &pq.Error{Code: "23505"}), outcomeDuplicate},
+		{"permanent", Permanent(errors.New("bad body")), outcomeDeadLetter},
+		{"foreign key violation", &pq.Error{Code: "23503"}, outcomeRequeue},
+		{"transient", errors.New("connection reset"), outcomeRequeue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err); got != tt.want {
+				t.Errorf("classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumerOutcomes(t *testing.T) {
+	decodeErr := errors.New("malformed body")
+
+	tests := []struct {
+		name         string
+		decodeErr    error
+		handleErr    error
+		publishErr   error
+		maxAttempts  int
+		retries      int32
+		wantAck      bool
+		wantRequeue  bool
+		wantDeadLtrs int
+		wantDelays   []time.Duration
+	}{
+		{name: "handled", wantAck: true},
+		{name: "duplicate", handleErr: &pq.Error{Code: "23505"}, wantAck: true},
+		{
+			name:       "transient failure",
+			handleErr:  errors.New("db down"),
+			wantAck:    true,
+			wantDelays: []time.Duration{time.Second},
+		},
+		{
+			name:       "retry delay doubles",
+			handleErr:  errors.New("db down"),
+			retries:    2,
+			wantAck:    true,
+			wantDelays: []time.Duration{4 * time.Second},
+		},
+		{
+			name:       "handler sets the retry delay",
+			handleErr:  fmt.Errorf("smtp down: %w", retryLater(time.Minute)),
+			wantAck:    true,
+			wantDelays: []time.Duration{time.Minute},
+		},
+		{
+			name:         "attempts exhausted",
+			handleErr:    errors.New("db down"),
+			maxAttempts:  3,
+			retries:      2,
+			wantAck:      true,
+			wantDeadLtrs: 1,
+		},
+		{
+			name:        "retry not published",
+			handleErr:   errors.New("db down"),
+			publishErr:  errors.New("channel closed"),
+			wantRequeue: true,
+		},
+		{name: "permanent failure", handleErr: Permanent(errors.New("archived club")), wantAck: true, wantDeadLtrs: 1},
+		{name: "undecodable", decodeErr: decodeErr, wantAck: true, wantDeadLtrs: 1},
+		{
+			name:        "dead letter not published",
+			handleErr:   Permanent(errors.New("archived club")),
+			publishErr:  errors.New("channel closed"),
+			wantRequeue: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := 0
+
+			cfg := ConsumerConfig{Queue: "test", Prefetch: 1, Concurrency: 1, MaxAttempts: 5, RetryDelay: time.Second}
+			if tt.maxAttempts > 0 {
+				cfg.MaxAttempts = tt.maxAttempts
+			}
+
+			c := NewConsumer("TestConsumer", cfg,
+				func(d amqp.Delivery) (*message, error) {
+					if tt.decodeErr != nil {
+						return nil, tt.decodeErr
+					}
+					return &message{ID: d.MessageId}, nil
+				},
+				func(ctx context.Context, msg *message) error {
+					handled++
+					return tt.handleErr
+				},
+			)
+
+			ack := &acknowledger{}
+			r := &redeliveries{err: tt.publishErr}
+
+			d := amqp.Delivery{Acknowledger: ack, MessageId: "m1"}
+			if tt.retries > 0 {
+				d.Headers = amqp.Table{mq.RetryCountHeader: tt.retries}
+			}
+
+			c.process(context.Background(), r, d)
+
+			if ack.acked != tt.wantAck {
+				t.Errorf("acked = %t, want %t", ack.acked, tt.wantAck)
+			}
+			if ack.nacked && !ack.requeued {
+				t.Errorf("nacked without requeue")
+			}
+			if ack.requeued != tt.wantRequeue {
+				t.Errorf("requeued = %t, want %t", ack.requeued, tt.wantRequeue)
+			}
+			if len(r.reasons) != tt.wantDeadLtrs {
+				t.Errorf("dead letters = %d, want %d", len(r.reasons), tt.wantDeadLtrs)
+			}
+			if !slices.Equal(r.delays, tt.wantDelays) {
+				t.Errorf("retries = %v, want %v", r.delays, tt.wantDelays)
+			}
+			if tt.decodeErr != nil && handled != 0 {
+				t.Errorf("handler called for an undecodable message")
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/pkg/env"
+)
+
+// Retry defaults of every queue.
+const (
+	DefaultMaxAttempts = 5
+	DefaultRetryDelay  = 5 * time.Second
+)
+
+type ConsumerConfig struct {
+	Queue       string
+	Prefetch    int
+	Concurrency int
+	// MaxAttempts is how many deliveries a message that keeps failing gets
+	// before it is dead-lettered.
+	MaxAttempts int
+	// RetryDelay is how long a failed message waits before its first retry.
+	// The wait doubles on each retry.
+	RetryDelay time.Duration
+}
+
+// NewConsumerConfig returns the consumer settings for queue. The defaults can
+// be overridden per queue with <QUEUE>_PREFETCH, <QUEUE>_CONCURRENCY,
+// <QUEUE>_MAX_ATTEMPTS and <QUEUE>_RETRY_DELAY, e.g.
+// DISCOUNT_CLUB_SIGNUP_CONCURRENCY=8.
+func NewConsumerConfig(queue string, prefetch, concurrency int) ConsumerConfig {
+	prefix := strings.ToUpper(queue)
+
+	cfg := ConsumerConfig{
+		Queue:       queue,
+		Prefetch:    env.Int(prefix+"_PREFETCH", prefetch),
+		Concurrency: env.Int(prefix+"_CONCURRENCY", concurrency),
+		MaxAttempts: env.Int(prefix+"_MAX_ATTEMPTS", DefaultMaxAttempts),
+		RetryDelay:  env.Duration(prefix+"_RETRY_DELAY", DefaultRetryDelay),
+	}
+
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	// Each handler needs at least one delivery in flight to stay busy.
+	if cfg.Prefetch < cfg.Concurrency {
+		cfg.Prefetch = cfg.Concurrency
+	}
+
+	return cfg
+}
+
+// dispatch fans deliveries out to concurrency handler goroutines. Deliveries
+// are routed by their message key, so messages for the same key are always
+// handled by the same goroutine and keep their queue order. It returns once
+// deliveries is closed and every handler has finished.
+func dispatch(deliveries <-chan amqp.Delivery, concurrency int, handle func(amqp.Delivery)) {
+	lanes := make([]chan amqp.Delivery, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i := range lanes {
+		lanes[i] = make(chan amqp.Delivery)
+		wg.Add(1)
+		go func(lane <-chan amqp.Delivery) {
+			defer wg.Done()
+			for d := range lane {
+				handle(d)
+			}
+		}(lanes[i])
+	}
+
+	for d := range deliveries {
+		lanes[laneFor(mq.MessageKey(d), concurrency)] <- d
+	}
+
+	for _, lane := range lanes {
+		close(lane)
+	}
+
+	wg.Wait()
+}
+
+func laneFor(key string, concurrency int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(concurrency))
+}
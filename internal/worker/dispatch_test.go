@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hazkall/capy-belga/internal/mq"
+)
+
+func TestDispatchKeepsOrderPerKey(t *testing.T) {
+	const (
+		keys        = 20
+		perKey      = 50
+		concurrency = 4
+	)
+
+	deliveries := make(chan amqp.Delivery)
+
+	go func() {
+		for i := 0; i < perKey; i++ {
+			for k := 0; k < keys; k++ {
+				deliveries <- amqp.Delivery{
+					Headers:   amqp.Table{mq.MessageKeyHeader: fmt.Sprintf("user%d@email.com", k)},
+					MessageId: fmt.Sprint(i),
+				}
+			}
+		}
+		close(deliveries)
+	}()
+
+	var (
+		mu    sync.Mutex
+		seen  = make(map[string][]string)
+		lanes = make(map[string]map[int]bool)
+	)
+
+	dispatch(deliveries, concurrency, func(d amqp.Delivery) {
+		key := mq.MessageKey(d)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen[key] = append(seen[key], d.MessageId)
+
+		if lanes[key] == nil {
+			lanes[key] = make(map[int]bool)
+		}
+		lanes[key][laneFor(key, concurrency)] = true
+	})
+
+	if len(seen) != keys {
+		t.Fatalf("handled %d keys, want %d", len(seen), keys)
+	}
+
+	want := make([]string, perKey)
+	for i := range want {
+		want[i] = fmt.Sprint(i)
+	}
+
+	for key, ids := range seen {
+		if !slices.Equal(ids, want) {
+			t.Errorf("%s handled out of order: %v", key, ids)
+		}
+		if len(lanes[key]) != 1 {
+			t.Errorf("%s handled by %d lanes", key, len(lanes[key]))
+		}
+	}
+}
+
+func TestLaneFor(t *testing.T) {
+	for _, concurrency := range []int{1, 2, 8} {
+		for k := 0; k < 100; k++ {
+			key := fmt.Sprintf("user%d@email.com", k)
+			lane := laneFor(key, concurrency)
+			if lane < 0 || lane >= concurrency {
+				t.Fatalf("laneFor(%q, %d) = %d", key, concurrency, lane)
+			}
+			if lane != laneFor(key, concurrency) {
+				t.Fatalf("laneFor(%q, %d) is not stable", key, concurrency)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/hazkall/capy-belga/internal/domain/service"
+	"github.com/hazkall/capy-belga/pkg/env"
+)
+
+type OutboxRelayConfig struct {
+	Interval   time.Duration
+	RetryAfter time.Duration
+	BatchSize  int
+}
+
+// NewOutboxRelayConfig returns the outbox relay settings. The defaults can be
+// overridden with OUTBOX_RELAY_INTERVAL, OUTBOX_RETRY_AFTER, both Go
+// durations, and OUTBOX_BATCH_SIZE.
+func NewOutboxRelayConfig(interval, retryAfter time.Duration, batchSize int) OutboxRelayConfig {
+	cfg := OutboxRelayConfig{
+		Interval:   env.Duration("OUTBOX_RELAY_INTERVAL", interval),
+		RetryAfter: env.Duration("OUTBOX_RETRY_AFTER", retryAfter),
+		BatchSize:  env.Int("OUTBOX_BATCH_SIZE", batchSize),
+	}
+
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+
+	return cfg
+}
+
+// StartOutboxRelay publishes the events kept in the outbox every cfg.Interval
+// until ctx is done. It is safe to run on every instance, as events are
+// claimed in the database.
+func StartOutboxRelay(ctx context.Context, cfg OutboxRelayConfig, outbox *service.OutboxPublisher) error {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		relayOutbox(ctx, cfg, outbox)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayOutbox publishes batches until the outbox has nothing due or a
+// publication fails.
+func relayOutbox(ctx context.Context, cfg OutboxRelayConfig, outbox *service.OutboxPublisher) {
+	relayed := 0
+	for {
+		n, err := outbox.Relay(ctx, cfg.RetryAfter, cfg.BatchSize)
+		relayed += n
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to relay outbox events", "relayed", relayed, "error", err)
+			return
+		}
+		if n < cfg.BatchSize {
+			break
+		}
+	}
+
+	if relayed > 0 {
+		slog.InfoContext(ctx, "Outbox events relayed", "relayed", relayed)
+	}
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hazkall/capy-belga/internal/contract"
+	"github.com/hazkall/capy-belga/internal/domain/service"
+	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/pkg/env"
+	"github.com/hazkall/capy-belga/pkg/telemetry"
+)
+
+type SchedulerConfig struct {
+	Interval  time.Duration
+	BatchSize int
+}
+
+// NewSchedulerConfig returns the billing scheduler settings. The defaults can
+// be overridden with BILLING_SCHEDULER_INTERVAL, a Go duration such as "30s",
+// and BILLING_BATCH_SIZE.
+func NewSchedulerConfig(interval time.Duration, batchSize int) SchedulerConfig {
+	cfg := SchedulerConfig{
+		Interval:  env.Duration("BILLING_SCHEDULER_INTERVAL", interval),
+		BatchSize: env.Int("BILLING_BATCH_SIZE", batchSize),
+	}
+
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+
+	return cfg
+}
+
+// StartBillingScheduler runs the billing cycle every cfg.Interval until ctx
+// is done. Each run sends a renewal command to ch for every membership whose
+// period ended and expires the memberships whose grace period ran out. It is
+// safe to run on every instance, as memberships are claimed in the database.
+func StartBillingScheduler(ctx context.Context, cfg SchedulerConfig, billing *service.BillingService, ch chan *mq.Envelope) error {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		runBillingCycle(ctx, cfg, billing, ch)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func runBillingCycle(ctx context.Context, cfg SchedulerConfig, billing *service.BillingService, ch chan *mq.Envelope) {
+	cctx, span := telemetry.Tracer.Start(ctx, "BillingScheduler.Run",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("entity", "worker"),
+		),
+	)
+	defer span.End()
+
+	requested, err := requestRenewals(cctx, cfg, billing, ch)
+	span.SetAttributes(attribute.Int("renewals_requested", requested))
+	if err != nil {
+		slog.ErrorContext(cctx, "Failed to request membership renewals", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	expired := 0
+	for {
+		n, err := billing.ExpireMemberships(cctx, cfg.BatchSize)
+		expired += n
+		if err != nil {
+			slog.ErrorContext(cctx, "Failed to expire memberships", "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			break
+		}
+		if n < cfg.BatchSize {
+			break
+		}
+	}
+
+	span.SetAttributes(attribute.Int("memberships_expired", expired))
+
+	if requested > 0 || expired > 0 {
+		slog.InfoContext(cctx, "Billing cycle done", "renewals_requested", requested, "memberships_expired", expired)
+	}
+}
+
+// requestRenewals claims due memberships in batches until none is left and
+// sends a renewal command for each.
+func requestRenewals(ctx context.Context, cfg SchedulerConfig, billing *service.BillingService, ch chan *mq.Envelope) (int, error) {
+	requested := 0
+
+	for {
+		commands, err := billing.ClaimRenewals(ctx, cfg.BatchSize)
+		if err != nil {
+			return requested, err
+		}
+
+		for _, cmd := range commands {
+			// A command that fails to build or publish is claimed again
+			// after the retry interval.
+			m, err := contract.NewMessage(contract.TypeRenewal, strconv.FormatInt(cmd.MembershipID, 10), "", cmd)
+			if err != nil {
+				return requested, err
+			}
+
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				return requested, ctx.Err()
+			}
+
+			requested++
+			telemetry.RecordBillingTransition(ctx, telemetry.BillingRenewalRequested, "")
+		}
+
+		if len(commands) < cfg.BatchSize {
+			return requested, nil
+		}
+	}
+}
@@ -1,65 +1,102 @@
 package worker
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 
-	"github.com/lib/pq"
+	amqp "github.com/rabbitmq/amqp091-go"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
-	"github.com/hazkall/capy-belga/internal/controller"
+	"github.com/hazkall/capy-belga/internal/contract"
+	"github.com/hazkall/capy-belga/internal/db"
 	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/event"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
 	"github.com/hazkall/capy-belga/internal/domain/service"
 	"github.com/hazkall/capy-belga/internal/mq"
+	"github.com/hazkall/capy-belga/internal/notify"
 	"github.com/hazkall/capy-belga/pkg/telemetry"
 )
 
-func StartPublishWorker(ctx context.Context, ch chan *controller.Message, m *mq.MQ) error {
-	for club := range ch {
-		if err := processClub(ctx, club, m); err != nil {
+// UnroutableQueue is the queue whose dead-letter queue receives the envelopes
+// of unknown types, which have no queue of their own.
+const UnroutableQueue = "unroutable"
+
+// publisher publishes envelopes to their queues, as *mq.MQ does.
+type publisher interface {
+	deadLetterer
+	PublishMessage(ctx context.Context, e *mq.Envelope, queueName string) error
+}
+
+// StartPublishWorker publishes the envelopes of ch to the queues of their
+// types. Envelopes that can never be published are dead-lettered, so they
+// are kept for inspection instead of being lost.
+func StartPublishWorker(ctx context.Context, ch chan *mq.Envelope, m *mq.MQ) error {
+	return publishEnvelopes(ctx, ch, m)
+}
+
+func publishEnvelopes(ctx context.Context, ch chan *mq.Envelope, m publisher) error {
+	for e := range ch {
+		err := publishEnvelope(ctx, e, m)
+		if classify(err) == outcomeDeadLetter {
+			slog.Error("Dead-lettering unpublishable message", "type", e.Type, "id", e.ID, "error", err)
+			err = m.PublishDeadLetter(ctx, deliveryOf(e), UnroutableQueue, err.Error())
+		}
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func processClub(ctx context.Context, club *controller.Message, m *mq.MQ) error {
+// deliveryOf returns e as it would have been delivered from its queue.
+func deliveryOf(e *mq.Envelope) amqp.Delivery {
+	p := e.Publishing()
+	return amqp.Delivery{
+		Headers:       p.Headers,
+		ContentType:   p.ContentType,
+		MessageId:     p.MessageId,
+		CorrelationId: p.CorrelationId,
+		Timestamp:     p.Timestamp,
+		Type:          p.Type,
+		AppId:         p.AppId,
+		Body:          p.Body,
+	}
+}
+
+// publishEnvelope publishes e to the queue registered for its type. An
+// unknown type is a permanent error, since no queue will ever accept it.
+func publishEnvelope(ctx context.Context, e *mq.Envelope, m publisher) error {
 
-	_, span := telemetry.Tracer.Start(ctx, "processClubWorker",
+	cctx, span := telemetry.Tracer.Start(ctx, "publishEnvelopeWorker",
 		trace.WithAttributes(
-			attribute.String("club_name", string(club.Data)),
-			attribute.String("club_type", club.Type),
+			attribute.String("message_key_hash", telemetry.HashPII(e.Key)),
+			attribute.String("message_type", e.Type),
+			attribute.String("content_type", e.ContentType),
+			attribute.Int("message_size", len(e.Data)),
+			attribute.String("message_id", e.ID),
+			attribute.Int("schema_version", e.Version),
+			attribute.String("correlation_id", e.CorrelationID),
 		),
 	)
 
 	defer span.End()
 
-	var queueName string
-	switch club.Type {
-	case "create_discount_club":
-		queueName = "discount_club_create"
-	case "users":
-		queueName = "users"
-	case "discount_club_signup":
-		queueName = "discount_club_signup"
-	default:
-		slog.Error("Unknown message type", "type", club.Type)
-		return nil
-	}
-
-	j, err := json.Marshal(club)
+	s, err := contract.Registry.Lookup(e.Type)
 	if err != nil {
-		slog.Error("Error marshalling club entity", "error", err)
+		slog.Error("Unknown message type", "type", e.Type)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return err
+		return Permanent(err)
 	}
 
-	err = m.PublishMessage(j, queueName)
+	err = m.PublishMessage(cctx, e, s.Queue)
 
 	if err != nil {
 		slog.Error("Failed to publish message", "error", err)
@@ -68,225 +105,155 @@ func processClub(ctx context.Context, club *controller.Message, m *mq.MQ) error
 		return err
 	}
 
-	slog.Info("Club created message published successfully", "club", club)
+	slog.Info("Message published successfully", "type", e.Type, "id", e.ID, "queue", s.Queue)
 
 	return nil
 }
 
-func ConsumeCreateClub(ctx context.Context, m *mq.MQ, clubService *service.ClubService) error {
-
-	club := new(entity.Club)
-	msg := new(controller.Message)
+func ConsumeCreateClub(ctx context.Context, m *mq.MQ, cfg ConsumerConfig, clubService *service.ClubService) error {
+	return NewConsumer("ConsumeCreateClubWorker", cfg, DecodeEnvelope[entity.Club], handleCreateClub(clubService)).
+		WithAttributes(func(club *entity.Club) []attribute.KeyValue {
+			return []attribute.KeyValue{
+				attribute.String("club_name", club.Name),
+				attribute.String("club_type", club.PlanType),
+				attribute.String("AcquisitionChannel", club.AquisitionChannel),
+				attribute.String("AcquisitionLocation", club.AquisitionLocation),
+			}
+		}).
+		Run(ctx, m)
+}
 
-	deliveries, err := m.ConsumeMessages("discount_club_create")
-	if err != nil {
-		slog.Error("Failed to consume messages", "error", err)
+func handleCreateClub(clubService *service.ClubService) Handler[entity.Club] {
+	return func(ctx context.Context, club *entity.Club) error {
+		err := clubService.CreateClub(ctx, club)
+		// The plan was removed from the catalogue after the club was
+		// validated, so retrying can't succeed.
+		if db.IsForeignKeyViolation(err) {
+			return Permanent(err)
+		}
 		return err
 	}
+}
 
-	for d := range deliveries {
-		cctx, span := telemetry.Tracer.Start(ctx, "ConsumeCreateClubWorker",
-			trace.WithAttributes(
-				attribute.String("entity", "worker"),
-				attribute.String("queue_name", "discount_club_create"),
-				attribute.String("message_type", d.Type),
-			),
-		)
-		if err := json.Unmarshal(d.Body, &msg); err != nil {
-			slog.Error("Error unmarshalling club entity", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
-
-		if err := json.Unmarshal(msg.Data, &club); err != nil {
-			slog.Error("Error unmarshalling club entity data", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
-
-		err := clubService.CreateClub(cctx, club)
-		if err != nil {
-			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-				slog.Warn("Duplicate club detected, skipping", "name", club.Name)
-				span.RecordError(err)
-				span.SetStatus(codes.Error, err.Error())
-				span.End()
-				d.Ack(false)
-				continue
+func ConsumeUser(ctx context.Context, m *mq.MQ, cfg ConsumerConfig, userService *service.UserService) error {
+	return NewConsumer("ConsumeUserWorker", cfg, DecodeEnvelope[entity.User], userService.CreateUser).
+		WithAttributes(func(user *entity.User) []attribute.KeyValue {
+			return []attribute.KeyValue{
+				telemetry.EmailAttribute(user.Email),
 			}
-			slog.Error("Error inserting club into database", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
+		}).
+		Run(ctx, m)
+}
 
-		span.SetAttributes(
-			attribute.String("club_name", club.Name),
-			attribute.String("club_type", club.PlanType),
-			attribute.String("AcquisitionChannel", club.AquisitionChannel),
-			attribute.String("AcquisitionLocation", club.AquisitionLocation),
-		)
-		span.End()
-		d.Ack(false)
-	}
+func ConsumeClubSignup(ctx context.Context, m *mq.MQ, cfg ConsumerConfig, signupService *service.SignupService) error {
+	return NewConsumer("ConsumeClubSignupWorker", cfg, DecodeEnvelope[entity.SignupPayload], handleClubSignup(signupService)).
+		WithAttributes(func(signup *entity.SignupPayload) []attribute.KeyValue {
+			return []attribute.KeyValue{
+				telemetry.EmailAttribute(signup.Email),
+				attribute.String("club_name", signup.ClubName),
+			}
+		}).
+		Run(ctx, m)
+}
 
-	return nil
+// signups is the part of *service.SignupService the signup consumer uses.
+type signups interface {
+	SignupUser(ctx context.Context, signup *entity.SignupPayload) error
+	RejectSignup(ctx context.Context, signup *entity.SignupPayload, id string, err error)
+}
 
+func handleClubSignup(signupService signups) Handler[entity.SignupPayload] {
+	return func(ctx context.Context, signup *entity.SignupPayload) error {
+		err := signupService.SignupUser(ctx, signup)
+
+		// A missing user or club may still be on its way through its own
+		// queue, so it is only final once the retries run out. An inactive
+		// user, an archived club or an invalid coupon is final right away.
+		final := errors.Is(err, repository.ErrInactiveUser) || errors.Is(err, repository.ErrClubArchived) ||
+			errors.Is(err, repository.ErrInvalidCoupon)
+		missing := errors.Is(err, repository.ErrUserNotFound) || errors.Is(err, repository.ErrClubNotFound)
+
+		d := deliveryFrom(ctx)
+		if final || missing && d.last() {
+			signupService.RejectSignup(ctx, signup, d.messageID, err)
+			return Permanent(err)
+		}
+		return err
+	}
 }
 
-func ConsumeUser(ctx context.Context, m *mq.MQ, userService *service.UserService) error {
-	user := new(entity.User)
-	msg := new(controller.Message)
+func ConsumeRenewal(ctx context.Context, m *mq.MQ, cfg ConsumerConfig, billingService *service.BillingService) error {
+	return NewConsumer("ConsumeRenewalWorker", cfg, DecodeEnvelope[entity.RenewalCommand], handleRenewal(billingService)).
+		WithAttributes(func(cmd *entity.RenewalCommand) []attribute.KeyValue {
+			return []attribute.KeyValue{
+				attribute.Int64("membership_id", cmd.MembershipID),
+				attribute.Int("attempt", cmd.Attempt),
+			}
+		}).
+		Run(ctx, m)
+}
 
-	deliveries, err := m.ConsumeMessages("users")
-	if err != nil {
-		slog.Error("Failed to consume messages", "error", err)
+func handleRenewal(billingService *service.BillingService) Handler[entity.RenewalCommand] {
+	return func(ctx context.Context, cmd *entity.RenewalCommand) error {
+		err := billingService.Renew(ctx, cmd)
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return Permanent(err)
+		}
 		return err
 	}
+}
 
-	for d := range deliveries {
-		cctx, span := telemetry.Tracer.Start(ctx, "ConsumeUserWorker",
-			trace.WithAttributes(
-				attribute.String("entity", "worker"),
-				attribute.String("queue_name", "users"),
-				attribute.String("message_type", d.Type),
-			),
-		)
-		if err := json.Unmarshal(d.Body, &msg); err != nil {
-			slog.Error("Error unmarshalling user entity", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
+// NotificationsQueue receives the domain events users are notified of.
+const NotificationsQueue = "notifications"
 
-		if err := json.Unmarshal(msg.Data, &user); err != nil {
-			slog.Error("Error unmarshalling user entity data", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
+// NotificationBindings are the routing keys NotificationsQueue is bound to on
+// the events exchange.
+var NotificationBindings = []string{"user.#", "club.membership.*"}
 
-		err := userService.CreateUser(cctx, user)
-		if err != nil {
-			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-				slog.Warn("Duplicate user detected, skipping", "email", user.Email)
-				span.RecordError(err)
-				span.SetStatus(codes.Error, err.Error())
-				span.End()
-				d.Ack(false)
-				continue
+func ConsumeNotifications(ctx context.Context, m *mq.MQ, cfg ConsumerConfig, notificationService *service.NotificationService) error {
+	return NewConsumer("ConsumeNotificationsWorker", cfg, decodeEvent, handleNotification(notificationService)).
+		WithAttributes(func(e *notify.Event) []attribute.KeyValue {
+			return []attribute.KeyValue{
+				attribute.String("notification.kind", e.Kind),
 			}
-			slog.Error("Error inserting user into database", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
+		}).
+		Run(ctx, m)
+}
+
+func handleNotification(notificationService *service.NotificationService) Handler[notify.Event] {
+	return func(ctx context.Context, e *notify.Event) error {
+		err := notificationService.Notify(ctx, e)
+		if errors.Is(err, service.ErrNotificationFailed) {
+			return Permanent(err)
 		}
-		span.SetAttributes(
-			attribute.String("email", user.Email),
-		)
-		span.End()
-		d.Ack(false)
+		return err
 	}
-	return nil
 }
 
-func ConsumeClubSignup(ctx context.Context, m *mq.MQ, signupService *service.SignupService) error {
-	signup := new(entity.SignupPayload)
-	msg := new(controller.Message)
-
-	deliveries, err := m.ConsumeMessages("discount_club_signup")
-	if err != nil {
-		slog.Error("Failed to consume messages", "error", err)
+// decodeEvent reads a domain event. Events are not registered contracts, so
+// their JSON payload is decoded as is; numbers are kept as json.Number.
+func decodeEvent(d amqp.Delivery) (*notify.Event, error) {
+	e := mq.EnvelopeFromDelivery(d)
 
-		return err
+	if e.ContentType != mq.ContentTypeJSON {
+		return nil, fmt.Errorf("%w: %q", mq.ErrUnsupportedContent, e.ContentType)
 	}
 
-	for d := range deliveries {
-		cctx, span := telemetry.Tracer.Start(ctx, "ConsumeClubSignupWorker",
-			trace.WithAttributes(
-				attribute.String("entity", "worker"),
-				attribute.String("queue_name", "discount_club_signup"),
-				attribute.String("message_type", d.Type),
-			),
-		)
-		if err := json.Unmarshal(d.Body, &msg); err != nil {
-			slog.Error("Error unmarshalling signup entity", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
+	if e.Version != event.Version {
+		return nil, fmt.Errorf("%w: %s v%d", mq.ErrUnsupportedVersion, e.Type, e.Version)
+	}
 
-		if err := json.Unmarshal(msg.Data, &signup); err != nil {
-			slog.Error("Error unmarshalling signup entity data", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
+	dec := json.NewDecoder(bytes.NewReader(e.Data))
+	dec.UseNumber()
 
-		err := signupService.SignupUser(cctx, signup)
-		if err != nil {
-			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-				slog.Warn("Duplicate signup detected, skipping", "email", signup.Email, "club", signup.ClubName)
-				span.RecordError(err)
-				span.SetStatus(codes.Error, err.Error())
-				span.End()
-				d.Ack(false)
-				continue
-			}
-			slog.Error("Error processing club signup", "error", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			span.End()
-			d.Nack(false, true)
-			continue
-		}
-
-		span.SetAttributes(
-			attribute.String("email", signup.Email),
-			attribute.String("club_name", signup.ClubName),
-		)
-		span.End()
-
-		telemetry.PlanGauge.Record(
-			cctx,
-			1,
-			metric.WithAttributes(
-				attribute.String("email", signup.Email),
-				attribute.String("club_name", signup.ClubName),
-				attribute.String("action", "signup"),
-			),
-		)
-
-		telemetry.NewPlanCounter.Add(
-			cctx,
-			1,
-			metric.WithAttributes(
-				attribute.String("email", signup.Email),
-				attribute.String("club_name", signup.ClubName),
-				attribute.String("action", "signup"),
-			),
-		)
+	var data map[string]any
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
 
-		d.Ack(false)
+	if data == nil {
+		return nil, fmt.Errorf("event %s has no payload", e.Type)
 	}
 
-	return nil
+	return &notify.Event{ID: e.ID, Kind: e.Type, Data: data}, nil
 }
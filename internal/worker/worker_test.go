@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hazkall/capy-belga/internal/contract"
+	"github.com/hazkall/capy-belga/internal/domain/entity"
+	"github.com/hazkall/capy-belga/internal/domain/repository"
+	"github.com/hazkall/capy-belga/internal/mq"
+)
+
+type publishedTo struct {
+	redeliveries
+	err    error
+	queues []string
+}
+
+func (p *publishedTo) PublishMessage(ctx context.Context, e *mq.Envelope, queueName string) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.queues = append(p.queues, queueName)
+	return nil
+}
+
+func TestPublishEnvelopes(t *testing.T) {
+	if err := contract.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		msgType      string
+		publishErr   error
+		wantErr      bool
+		wantQueues   int
+		wantDeadLtrs int
+	}{
+		{name: "known type", msgType: contract.TypeUser, wantQueues: 1},
+		{name: "unknown type", msgType: "create_discount_clubs", wantDeadLtrs: 1},
+		{name: "publish failure", msgType: contract.TypeUser, publishErr: errors.New("channel closed"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan *mq.Envelope, 1)
+			ch <- mq.NewEnvelope(tt.msgType, 1, "user@email.com", []byte(`{}`))
+			close(ch)
+
+			p := &publishedTo{err: tt.publishErr}
+
+			err := publishEnvelopes(context.Background(), ch, p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("publishEnvelopes() error = %v, want error %t", err, tt.wantErr)
+			}
+			if len(p.queues) != tt.wantQueues {
+				t.Errorf("published %d, want %d", len(p.queues), tt.wantQueues)
+			}
+			if len(p.reasons) != tt.wantDeadLtrs {
+				t.Errorf("dead letters = %d, want %d", len(p.reasons), tt.wantDeadLtrs)
+			}
+		})
+	}
+}
+
+// signupsFailing is a signup service failing every signup with err.
+type signupsFailing struct {
+	err      error
+	rejected []string
+}
+
+func (s *signupsFailing) SignupUser(ctx context.Context, signup *entity.SignupPayload) error {
+	return s.err
+}
+
+func (s *signupsFailing) RejectSignup(ctx context.Context, signup *entity.SignupPayload, id string, err error) {
+	s.rejected = append(s.rejected, id)
+}
+
+func TestHandleClubSignup(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		attempt       int
+		wantPermanent bool
+		wantRejected  bool
+	}{
+		{name: "signed up", attempt: 1},
+		{name: "user not found is retried", err: repository.ErrUserNotFound, attempt: 1},
+		{name: "club not found is retried", err: repository.ErrClubNotFound, attempt: 4},
+		{
+			name:          "not found on the last attempt",
+			err:           repository.ErrClubNotFound,
+			attempt:       5,
+			wantPermanent: true,
+			wantRejected:  true,
+		},
+		{name: "archived club", err: repository.ErrClubArchived, attempt: 1, wantPermanent: true, wantRejected: true},
+		{name: "database down", err: errors.New("connection refused"), attempt: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &signupsFailing{err: tt.err}
+			ctx := context.WithValue(context.Background(), deliveryKey{}, delivery{
+				messageID:   "m1",
+				attempt:     tt.attempt,
+				maxAttempts: 5,
+			})
+
+			err := handleClubSignup(s)(ctx, &entity.SignupPayload{Email: "capy@email.com", ClubName: "Clube Capy"})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("handler error = %v, want %v", err, tt.err)
+			}
+
+			if errors.Is(err, ErrPermanent) != tt.wantPermanent {
+				t.Errorf("handler error = %v, want permanent %t", err, tt.wantPermanent)
+			}
+
+			switch {
+			case !tt.wantRejected && len(s.rejected) != 0:
+				t.Errorf("rejected %v, want none", s.rejected)
+			case tt.wantRejected && (len(s.rejected) != 1 || s.rejected[0] != "m1"):
+				t.Errorf("rejected %v, want [m1]", s.rejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Package env reads configuration from environment variables, falling back
+// to a default when a variable is unset or invalid.
+package env
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Int reads an integer from the environment.
+func Int(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("Invalid integer in environment, using default", "name", name, "value", v, "default", def)
+		return def
+	}
+
+	return n
+}
+
+// Duration reads a positive Go duration such as "72h" from the environment.
+func Duration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration in environment, using default", "name", name, "value", v, "default", def)
+		return def
+	}
+
+	return d
+}
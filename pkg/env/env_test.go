@@ -0,0 +1,46 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInt(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 5},
+		{"12", 12},
+		{"-3", -3},
+		{"twelve", 5},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("CAPYBELGA_TEST_INT", tt.value)
+		if got := Int("CAPYBELGA_TEST_INT", 5); got != tt.want {
+			t.Errorf("Int(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", time.Hour},
+		{"72h", 72 * time.Hour},
+		{"90s", 90 * time.Second},
+		{"0s", time.Hour},
+		{"-1h", time.Hour},
+		{"3 days", time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("CAPYBELGA_TEST_DURATION", tt.value)
+		if got := Duration("CAPYBELGA_TEST_DURATION", time.Hour); got != tt.want {
+			t.Errorf("Duration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
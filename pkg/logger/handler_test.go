@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// processor keeps the records emitted to the logs SDK.
+type processor struct {
+	records []sdklog.Record
+}
+
+func (p *processor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	p.records = append(p.records, r.Clone())
+	return nil
+}
+
+func (p *processor) Shutdown(ctx context.Context) error   { return nil }
+func (p *processor) ForceFlush(ctx context.Context) error { return nil }
+
+func TestFanoutCarriesTraceContext(t *testing.T) {
+	var stdout bytes.Buffer
+	emitted := &processor{}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(emitted))
+
+	log := slog.New(newFanoutHandler(
+		newTraceHandler(slog.NewJSONHandler(&stdout, nil)),
+		newLevelHandler(slog.LevelInfo, otelslog.NewHandler("test", otelslog.WithLoggerProvider(provider))),
+	))
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a, 0x0b},
+		SpanID:     trace.SpanID{0x0c},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	log.InfoContext(ctx, "Signup received", "club", "Clube Capy")
+	log.DebugContext(ctx, "Below the level")
+
+	var record struct {
+		Msg     string `json:"msg"`
+		TraceID string `json:"trace_id"`
+		SpanID  string `json:"span_id"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &record); err != nil {
+		t.Fatalf("stdout = %q: %v", stdout.String(), err)
+	}
+	if record.TraceID != sc.TraceID().String() || record.SpanID != sc.SpanID().String() {
+		t.Errorf("stdout trace_id = %q, span_id = %q, want %s and %s", record.TraceID, record.SpanID, sc.TraceID(), sc.SpanID())
+	}
+
+	if len(emitted.records) != 1 {
+		t.Fatalf("emitted %d records, want 1", len(emitted.records))
+	}
+	r := emitted.records[0]
+	if r.TraceID() != sc.TraceID() || r.SpanID() != sc.SpanID() {
+		t.Errorf("emitted trace ID = %s, span ID = %s, want %s and %s", r.TraceID(), r.SpanID(), sc.TraceID(), sc.SpanID())
+	}
+	if got := r.Body().AsString(); got != record.Msg {
+		t.Errorf("emitted body = %q, want %q", got, record.Msg)
+	}
+}
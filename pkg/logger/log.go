@@ -1,19 +1,127 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+
+	"github.com/hazkall/capy-belga/pkg/telemetry"
 )
 
-func Start(debug string) {
+type Config struct {
+	// Name is the instrumentation scope of the records sent to OpenTelemetry.
+	Name string
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string
+	// Exporter selects where OpenTelemetry log records go: otlp, console or
+	// none. With none only the stdout JSON output is kept.
+	Exporter string
+	// Protocol is the OTLP transport, grpc or http/protobuf.
+	Protocol string
+}
+
+// ConfigFromEnv reads LOG_LEVEL, OTEL_LOGS_EXPORTER and the OTLP protocol of
+// the logs signal.
+func ConfigFromEnv(name string) Config {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	return Config{
+		Name:     name,
+		Level:    os.Getenv("LOG_LEVEL"),
+		Exporter: os.Getenv("OTEL_LOGS_EXPORTER"),
+		Protocol: protocol,
+	}
+}
+
+// Start installs the default slog logger. Records are written as JSON to
+// stdout and sent to the OpenTelemetry logs SDK; both carry the trace and
+// span IDs of the context they were logged with. When the configuration is
+// invalid or the exporter cannot be created, a warning is logged and only
+// stdout is kept. The returned function flushes and stops the logs pipeline.
+func Start(ctx context.Context, cfg Config) func(context.Context) error {
+	level, levelErr := parseLevel(cfg.Level)
+
+	stdout := newTraceHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(slog.New(stdout))
+
+	if levelErr != nil {
+		slog.Warn("Invalid log level, logging at info", "error", levelErr)
+	}
+
+	provider, err := newLoggerProvider(ctx, cfg)
+	if err != nil {
+		slog.Warn("Logs exporter disabled, logging to stdout only", "exporter", cfg.Exporter, "error", err)
+	}
+
+	if provider == nil {
+		return func(context.Context) error { return nil }
+	}
+
+	otel := newLevelHandler(level, otelslog.NewHandler(cfg.Name, otelslog.WithLoggerProvider(provider)))
+
+	slog.SetDefault(slog.New(newFanoutHandler(stdout, otel)))
+
+	return provider.Shutdown
+}
+
+func newLoggerProvider(ctx context.Context, cfg Config) (*sdklog.LoggerProvider, error) {
+	var exp sdklog.Exporter
+	var err error
 
-	l := new(slog.HandlerOptions)
+	switch cfg.Exporter {
+	case "none":
+		return nil, nil
+	case "console":
+		exp, err = stdoutlog.New()
+	case "", "otlp":
+		switch cfg.Protocol {
+		case "", "grpc":
+			exp, err = otlploggrpc.New(ctx)
+		case "http/protobuf":
+			exp, err = otlploghttp.New(ctx)
+		default:
+			err = fmt.Errorf("unsupported OTLP protocol %q", cfg.Protocol)
+		}
+	default:
+		err = fmt.Errorf("unknown logs exporter %q", cfg.Exporter)
+	}
 
-	if debug == "true" {
-		l.Level = slog.LevelDebug
+	if err != nil {
+		return nil, err
 	}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, l))
+	r, err := telemetry.Resource(ctx)
+	if err != nil {
+		slog.Warn("Incomplete telemetry resource, using the attributes detected so far", "error", err)
+	}
+
+	return sdklog.NewLoggerProvider(
+		sdklog.WithResource(r),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
+	), nil
+}
+
+func parseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+
+	if err := l.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
 
-	slog.SetDefault(logger)
+	return l, nil
 }
@@ -0,0 +1,120 @@
+package telemetry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// DefaultCardinalityLimit caps the number of attribute sets kept per metric
+// stream. Measurements past the limit are aggregated into a single series
+// with the otel.metric.overflow=true attribute.
+const DefaultCardinalityLimit = "2000"
+
+// UnmatchedRoute is the route reported for requests that matched no route
+// template, so arbitrary paths don't each become a time series.
+const UnmatchedRoute = "unmatched"
+
+// metricAttributes is the allow-list of attribute keys each instrument keeps.
+// Anything else recorded on them, PII included, is dropped by the views of
+// the MeterProvider. Instruments not listed keep their attributes, so every
+// new instrument recording user supplied values must be added here.
+var metricAttributes = map[string][]attribute.Key{
+	"http.server.request.duration":             {"http.route", "http.request.method", "http.response.status_class"},
+	"http.server.active_requests":              {"http.route", "http.request.method"},
+	"http.server.request.body.size":            {"http.route", "http.request.method", "http.response.status_class"},
+	"http.server.response.body.size":           {"http.route", "http.request.method", "http.response.status_class"},
+	"capybelga.new.plan.count":                 {"club_name", "plan_type", "aquisition_channel", "aquisition_location", "store_id", "utm_source", "utm_medium", "utm_campaign"},
+	"capybelga.cancel.plan.count":              {"club_name", "plan_type", "aquisition_channel", "aquisition_location"},
+	"capybelga.users.registered":               {},
+	"capybelga.signup.failures":                {"reason"},
+	"capybelga.signup.time_to_first":           {"plan_type", "aquisition_channel", "aquisition_location"},
+	"capybelga.membership.tenure":              {"club_name", "plan_type", "aquisition_channel", "aquisition_location"},
+	"capybelga.memberships.active":             {"club_name", "plan_type", "aquisition_channel"},
+	"capybelga.billing.transitions":            {"transition", "plan_type"},
+	"capybelga.billing.revenue":                {"currency", "plan_type"},
+	"capybelga.coupon.redemptions":             {"coupon_code", "plan_type"},
+	"capybelga.coupon.discount":                {"coupon_code", "currency"},
+	"capybelga.benefit.redemptions":            {"partner", "club_name", "benefit"},
+	"capybelga.referrals":                      {"stage", "reason"},
+	"capybelga.notifications":                  {"channel", "kind", "outcome"},
+	"capybelga.notification.delivery.duration": {"channel", "outcome"},
+	"capybelga.messages.consumed":              {"queue_name", "outcome"},
+	"capybelga.messages.process.duration":      {"queue_name", "outcome"},
+	"capybelga.messages.lag":                   {"queue_name"},
+	"messaging.client.sent.messages":           {"messaging.system", "messaging.operation.name", "messaging.destination.name", "error.type"},
+	"messaging.client.operation.duration":      {"messaging.system", "messaging.operation.name", "messaging.destination.name", "error.type"},
+	"capybelga.queue.depth":                    {"messaging.system", "messaging.destination.name"},
+	"capybelga.queue.consumers":                {"messaging.system", "messaging.destination.name"},
+	"db.client.operation.duration":             {"db.system.name", "db.operation.name", "db.collection.name", "error.type"},
+}
+
+func metricViews() []otelmetric.View {
+	return []otelmetric.View{metricView}
+}
+
+// metricView applies the attribute allow-list and drops annotation units
+// such as {request}. Those only describe what is counted, and the Prometheus
+// exporter would otherwise render them into the metric name, where the
+// collector leaves them out.
+func metricView(i otelmetric.Instrument) (otelmetric.Stream, bool) {
+	s := otelmetric.Stream{Name: i.Name, Description: i.Description, Unit: i.Unit}
+	matched := false
+
+	if keys, ok := metricAttributes[i.Name]; ok {
+		s.AttributeFilter = attribute.NewAllowKeysFilter(keys...)
+		matched = true
+	}
+
+	if strings.HasPrefix(i.Unit, "{") && strings.HasSuffix(i.Unit, "}") {
+		s.Unit = ""
+		matched = true
+	}
+
+	return s, matched
+}
+
+// enableCardinalityLimit turns on the SDK overflow aggregation unless the
+// limit was configured through OTEL_GO_X_CARDINALITY_LIMIT.
+func enableCardinalityLimit() {
+	if os.Getenv("OTEL_GO_X_CARDINALITY_LIMIT") == "" {
+		os.Setenv("OTEL_GO_X_CARDINALITY_LIMIT", DefaultCardinalityLimit)
+	}
+}
+
+// HashPII returns a stable pseudonym for a PII value, salted with
+// TELEMETRY_PII_SALT, so it can still be correlated across spans without
+// exposing the value.
+func HashPII(value string) string {
+	sum := sha256.Sum256([]byte(os.Getenv("TELEMETRY_PII_SALT") + value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// EmailAttribute is the span attribute for a user email, hashed.
+func EmailAttribute(email string) attribute.KeyValue {
+	return attribute.String("user.email_hash", HashPII(email))
+}
+
+// RouteTemplate returns the path of the ServeMux pattern that matched r
+// instead of its raw path. The method and host of the pattern are left out,
+// as http.route only holds the path template.
+func RouteTemplate(r *http.Request) string {
+	if r.Pattern == "" {
+		return UnmatchedRoute
+	}
+
+	route := r.Pattern
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = strings.TrimLeft(path, " \t")
+	}
+	if i := strings.IndexByte(route, '/'); i > 0 {
+		route = route[i:]
+	}
+
+	return route
+}
@@ -0,0 +1,28 @@
+package telemetry
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouteTemplate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"", UnmatchedRoute},
+		{"/user/state", "/user/state"},
+		{"/plans/{code}", "/plans/{code}"},
+		{"GET /plans/{code}", "/plans/{code}"},
+		{"DELETE  /attribution/registry/{kind}/{value}", "/attribution/registry/{kind}/{value}"},
+		{"admin.example.com/admin/sampling", "/admin/sampling"},
+		{"PUT admin.example.com/admin/sampling", "/admin/sampling"},
+	}
+
+	for _, tt := range tests {
+		r := &http.Request{Pattern: tt.pattern}
+		if got := RouteTemplate(r); got != tt.want {
+			t.Errorf("RouteTemplate(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
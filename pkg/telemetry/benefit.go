@@ -0,0 +1,31 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var benefitRedemptions metric.Int64Counter
+
+func benefitStart() error {
+	var err error
+
+	benefitRedemptions, err = Meter.Int64Counter(
+		"capybelga.benefit.redemptions",
+		metric.WithDescription("Count of benefits redeemed by members at partners"),
+		metric.WithUnit("{redemption}"),
+	)
+	return err
+}
+
+// RecordBenefitRedemption counts a member of club using the benefit with code
+// at partner, which is what partners are billed by.
+func RecordBenefitRedemption(ctx context.Context, partner, club, code string) {
+	benefitRedemptions.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("partner", partner),
+		attribute.String("club_name", club),
+		attribute.String("benefit", code),
+	))
+}
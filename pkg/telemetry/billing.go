@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Billing cycle transitions, reported by capybelga.billing.transitions.
+const (
+	BillingRenewalRequested = "renewal_requested"
+	BillingRenewed          = "renewed"
+	BillingDeclined         = "declined"
+	BillingExpired          = "expired"
+	BillingStale            = "stale"
+)
+
+var (
+	billingTransitions metric.Int64Counter
+	billingRevenue     metric.Int64Counter
+)
+
+func billingStart() error {
+	var err error
+
+	billingTransitions, err = Meter.Int64Counter(
+		"capybelga.billing.transitions",
+		metric.WithDescription("Count of membership billing cycle transitions"),
+		metric.WithUnit("{membership}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	billingRevenue, err = Meter.Int64Counter(
+		"capybelga.billing.revenue",
+		metric.WithDescription("Amount collected by membership renewals, in minor units of the currency"),
+		metric.WithUnit("{minor_unit}"),
+	)
+	return err
+}
+
+// RecordBillingTransition counts a membership of planType moving through the
+// billing cycle.
+func RecordBillingTransition(ctx context.Context, transition, planType string) {
+	billingTransitions.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("transition", transition),
+		attribute.String("plan_type", planType),
+	))
+}
+
+// RecordRevenue adds amount, in minor units of currency, collected for a
+// membership of planType.
+func RecordRevenue(ctx context.Context, amount int64, currency, planType string) {
+	billingRevenue.Add(ctx, amount, metric.WithAttributes(
+		attribute.String("currency", currency),
+		attribute.String("plan_type", planType),
+	))
+}
@@ -0,0 +1,53 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// CouponReferral is the code under which referral reward coupons are
+// recorded, since each of them has its own code.
+const CouponReferral = "referral"
+
+var (
+	couponRedemptions metric.Int64Counter
+	couponDiscount    metric.Int64Counter
+)
+
+func couponStart() error {
+	var err error
+
+	couponRedemptions, err = Meter.Int64Counter(
+		"capybelga.coupon.redemptions",
+		metric.WithDescription("Count of coupons redeemed at signup"),
+		metric.WithUnit("{redemption}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	couponDiscount, err = Meter.Int64Counter(
+		"capybelga.coupon.discount",
+		metric.WithDescription("Discount granted by redeemed coupons, in minor units of the currency"),
+		metric.WithUnit("{minor_unit}"),
+	)
+	return err
+}
+
+// RecordCouponRedemption counts a redemption of the coupon with code by a
+// membership of planType, which got discount off in currency. Only coupons
+// that exist are recorded, so the code has the cardinality of the coupons
+// created by admins. Callers record referral reward coupons as
+// CouponReferral.
+func RecordCouponRedemption(ctx context.Context, code, planType string, discount int64, currency string) {
+	couponRedemptions.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("coupon_code", code),
+		attribute.String("plan_type", planType),
+	))
+	couponDiscount.Add(ctx, discount, metric.WithAttributes(
+		attribute.String("coupon_code", code),
+		attribute.String("currency", currency),
+	))
+}
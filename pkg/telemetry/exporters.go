@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	otelmetric "go.opentelemetry.io/otel/sdk/metric"
+	oteltrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	ExporterOTLP       = "otlp"
+	ExporterConsole    = "console"
+	ExporterPrometheus = "prometheus"
+	ExporterNone       = "none"
+
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+func newTraceExporter(ctx context.Context, name, protocol string) (oteltrace.SpanExporter, error) {
+	switch name {
+	case ExporterConsole:
+		return stdouttrace.New()
+	case ExporterOTLP:
+		switch protocol {
+		case ProtocolGRPC:
+			return otlptracegrpc.New(ctx)
+		case ProtocolHTTP:
+			return otlptracehttp.New(ctx)
+		}
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+	return nil, fmt.Errorf("unsupported traces exporter %q", name)
+}
+
+// newMetricReader returns the reader of one metrics exporter. Pull exporters
+// also return the handler that serves their scrape endpoint.
+func newMetricReader(ctx context.Context, name, protocol string) (otelmetric.Reader, http.Handler, error) {
+	var exp otelmetric.Exporter
+	var err error
+
+	switch name {
+	case ExporterPrometheus:
+		return newPrometheusReader()
+	case ExporterConsole:
+		exp, err = stdoutmetric.New()
+	case ExporterOTLP:
+		switch protocol {
+		case ProtocolGRPC:
+			exp, err = otlpmetricgrpc.New(ctx)
+		case ProtocolHTTP:
+			exp, err = otlpmetrichttp.New(ctx)
+		default:
+			err = fmt.Errorf("unsupported OTLP protocol %q", protocol)
+		}
+	default:
+		err = fmt.Errorf("unsupported metrics exporter %q", name)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return otelmetric.NewPeriodicReader(exp), nil, nil
+}
+
+// newPrometheusReader registers the metrics on a dedicated registry, so the
+// scrape endpoint only exposes what the MeterProvider produces. The endpoint
+// negotiates the OpenMetrics format, the only one that carries exemplars, so
+// histogram samples recorded inside a sampled span link to its trace.
+func newPrometheusReader() (otelmetric.Reader, http.Handler, error) {
+	registry := prometheus.NewRegistry()
+
+	exp, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return exp, promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true}), nil
+}
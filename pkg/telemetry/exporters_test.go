@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	otelmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPrometheusEndpointExemplars(t *testing.T) {
+	reader, handler, err := newMetricReader(context.Background(), ExporterPrometheus, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := otelmetric.NewMeterProvider(
+		otelmetric.WithReader(reader),
+		otelmetric.WithView(metricViews()...),
+	)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	histogram, err := provider.Meter("test").Float64Histogram("capybelga.messages.lag")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a, 0x0b},
+		SpanID:     trace.SpanID{0x0c},
+		TraceFlags: trace.FlagsSampled,
+	})
+	histogram.Record(trace.ContextWithSpanContext(context.Background(), sc), 0.2)
+
+	tests := []struct {
+		accept       string
+		wantExemplar bool
+	}{
+		{"application/openmetrics-text; version=1.0.0", true},
+		{"text/plain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", tt.accept)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			body, _ := io.ReadAll(w.Body)
+			if !strings.Contains(string(body), "capybelga_messages_lag_bucket") {
+				t.Fatalf("body = %s, want the histogram", body)
+			}
+
+			exemplar := `trace_id="` + sc.TraceID().String() + `"`
+			if got := strings.Contains(string(body), exemplar); got != tt.wantExemplar {
+				t.Errorf("exemplar %s in the body = %t, want %t", exemplar, got, tt.wantExemplar)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Reasons a signup fails, reported by capybelga.signup.failures.
+const (
+	SignupFailureInvalidPayload     = "invalid_payload"
+	SignupFailureUserNotFound       = "user_not_found"
+	SignupFailureClubNotFound       = "club_not_found"
+	SignupFailureClubArchived       = "club_archived"
+	SignupFailureInactiveUser       = "inactive_user"
+	SignupFailureAlreadyMember      = "already_member"
+	SignupFailureInvalidCoupon      = "invalid_coupon"
+	SignupFailureInvalidAttribution = "invalid_attribution"
+	SignupFailureInternal           = "internal"
+)
+
+var (
+	usersRegistered   metric.Int64Counter
+	signupFailures    metric.Int64Counter
+	timeToFirstSignup metric.Float64Histogram
+	membershipTenure  metric.Float64Histogram
+)
+
+// timeToFirstSignupBuckets go from a signup right after registration to a
+// month later, in seconds.
+var timeToFirstSignupBuckets = []float64{1, 5, 30, 60, 300, 1800, 3600, 21600, 86400, 259200, 604800, 2592000}
+
+// tenureBuckets are membership lengths in days.
+var tenureBuckets = []float64{1, 7, 14, 30, 60, 90, 180, 365, 730}
+
+// Plan is the club a business KPI is recorded for. The store and UTM fields
+// are only set, and only kept by the views, for signups.
+type Plan struct {
+	Club     string
+	PlanType string
+	Channel  string
+	Location string
+	StoreID  string
+	Source   string
+	Medium   string
+	Campaign string
+}
+
+func (p Plan) attributes() metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("club_name", p.Club),
+		attribute.String("plan_type", p.PlanType),
+		attribute.String("aquisition_channel", p.Channel),
+		attribute.String("aquisition_location", p.Location),
+		attribute.String("store_id", p.StoreID),
+		attribute.String("utm_source", p.Source),
+		attribute.String("utm_medium", p.Medium),
+		attribute.String("utm_campaign", p.Campaign),
+	)
+}
+
+func kpiStart() error {
+	var err error
+
+	usersRegistered, err = Meter.Int64Counter(
+		"capybelga.users.registered",
+		metric.WithDescription("Count of registered users"),
+		metric.WithUnit("{user}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	signupFailures, err = Meter.Int64Counter(
+		"capybelga.signup.failures",
+		metric.WithDescription("Count of failed Discount Club signup attempts by reason"),
+		metric.WithUnit("{signup}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	timeToFirstSignup, err = Meter.Float64Histogram(
+		"capybelga.signup.time_to_first",
+		metric.WithDescription("Time from user registration to the first Discount Club signup"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(timeToFirstSignupBuckets...),
+	)
+	if err != nil {
+		return err
+	}
+
+	membershipTenure, err = Meter.Float64Histogram(
+		"capybelga.membership.tenure",
+		metric.WithDescription("Time a Discount Club membership was active when it was cancelled"),
+		metric.WithUnit("d"),
+		metric.WithExplicitBucketBoundaries(tenureBuckets...),
+	)
+	return err
+}
+
+func RecordUserRegistered(ctx context.Context) {
+	usersRegistered.Add(ctx, 1)
+}
+
+// RecordSignup counts a signup to plan. For the first signup of a user it
+// also records how long after registration it happened.
+func RecordSignup(ctx context.Context, plan Plan, first bool, sinceRegistration time.Duration) {
+	NewPlanCounter.Add(ctx, 1, plan.attributes())
+
+	if first {
+		timeToFirstSignup.Record(ctx, sinceRegistration.Seconds(), plan.attributes())
+	}
+}
+
+// RecordSignupFailure counts a failed signup attempt. Redelivered messages
+// are counted once per attempt.
+func RecordSignupFailure(ctx context.Context, reason string) {
+	signupFailures.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+// RecordCancellation counts a cancelled membership and how long it lasted.
+func RecordCancellation(ctx context.Context, plan Plan, tenure time.Duration) {
+	CancelPlanCounter.Add(ctx, 1, plan.attributes())
+	membershipTenure.Record(ctx, tenure.Hours()/24, plan.attributes())
+}
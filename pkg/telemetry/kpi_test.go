@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRecordSignupAndCancellation(t *testing.T) {
+	reader := manualMeter(t)
+	if err := MetricsStart(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	plan := Plan{
+		Club:     "Clube Capy",
+		PlanType: "premium",
+		Channel:  "store",
+		Location: "SP",
+		StoreID:  "loja-42",
+		Source:   "newsletter",
+	}
+
+	RecordSignup(ctx, plan, true, 90*time.Second)
+	RecordSignup(ctx, plan, false, 48*time.Hour)
+	RecordCancellation(ctx, plan, 36*time.Hour)
+
+	signups := collect(t, reader, "capybelga.new.plan.count").Data.(metricdata.Sum[int64]).DataPoints
+	if len(signups) != 1 || signups[0].Value != 2 {
+		t.Fatalf("capybelga.new.plan.count = %+v, want 2 signups", signups)
+	}
+	if !signups[0].Attributes.HasValue("store_id") || !signups[0].Attributes.HasValue("utm_source") {
+		t.Errorf("signup attributes = %v, want the store and UTM attribution", signups[0].Attributes.ToSlice())
+	}
+
+	first := collect(t, reader, "capybelga.signup.time_to_first").Data.(metricdata.Histogram[float64]).DataPoints
+	if len(first) != 1 || first[0].Count != 1 || first[0].Sum != 90 {
+		t.Errorf("capybelga.signup.time_to_first = %+v, want only the first signup, 90s after registration", first)
+	}
+
+	tenure := collect(t, reader, "capybelga.membership.tenure").Data.(metricdata.Histogram[float64]).DataPoints
+	if len(tenure) != 1 || tenure[0].Sum != 1.5 {
+		t.Fatalf("capybelga.membership.tenure = %+v, want 1.5 days", tenure)
+	}
+	if tenure[0].Attributes.HasValue("store_id") || tenure[0].Attributes.HasValue("utm_source") {
+		t.Errorf("tenure attributes = %v, want no store or UTM attribution", tenure[0].Attributes.ToSlice())
+	}
+}
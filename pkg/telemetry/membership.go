@@ -0,0 +1,83 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MembershipCount is the number of active memberships of one club.
+type MembershipCount struct {
+	Club     string
+	PlanType string
+	Channel  string
+	Count    int64
+}
+
+// MembershipSource loads the current active membership counts.
+type MembershipSource func(ctx context.Context) ([]MembershipCount, error)
+
+// RegisterActiveMembershipGauge registers capybelga.memberships.active as an
+// observable gauge read from source. Results are cached for ttl so frequent
+// collections don't hit the database; when a refresh fails the last known
+// counts keep being reported.
+func RegisterActiveMembershipGauge(source MembershipSource, ttl time.Duration) error {
+	cache := &membershipCache{source: source, ttl: ttl}
+
+	gauge, err := Meter.Int64ObservableGauge(
+		"capybelga.memberships.active",
+		metric.WithDescription("Number of active Discount Club memberships"),
+		metric.WithUnit("{membership}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = Meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, c := range cache.get(ctx) {
+			o.ObserveInt64(gauge, c.Count,
+				metric.WithAttributes(
+					attribute.String("club_name", c.Club),
+					attribute.String("plan_type", c.PlanType),
+					attribute.String("aquisition_channel", c.Channel),
+				),
+			)
+		}
+		return nil
+	}, gauge)
+
+	return err
+}
+
+type membershipCache struct {
+	source MembershipSource
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	counts    []MembershipCount
+	fetchedAt time.Time
+}
+
+func (c *membershipCache) get(ctx context.Context) []MembershipCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.ttl {
+		return c.counts
+	}
+
+	counts, err := c.source(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to refresh active memberships, reporting cached counts", "error", err)
+		return c.counts
+	}
+
+	c.counts = counts
+	c.fetchedAt = time.Now()
+
+	return c.counts
+}
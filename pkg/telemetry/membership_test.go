@@ -0,0 +1,155 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	otelmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// manualMeter points Meter at a MeterProvider with the views of Setup and
+// returns the reader collecting from it.
+func manualMeter(t *testing.T) *otelmetric.ManualReader {
+	t.Helper()
+
+	reader := otelmetric.NewManualReader()
+	provider := otelmetric.NewMeterProvider(
+		otelmetric.WithReader(reader),
+		otelmetric.WithView(metricViews()...),
+	)
+
+	previous := Meter
+	Meter = provider.Meter("test")
+	t.Cleanup(func() {
+		Meter = previous
+		provider.Shutdown(context.Background())
+	})
+
+	return reader
+}
+
+// collect returns the metric called name from reader.
+func collect(t *testing.T, reader *otelmetric.ManualReader, name string) metricdata.Metrics {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+
+	t.Fatalf("metric %s was not collected", name)
+	return metricdata.Metrics{}
+}
+
+func TestActiveMembershipGauge(t *testing.T) {
+	reader := manualMeter(t)
+
+	calls := 0
+	source := func(ctx context.Context) ([]MembershipCount, error) {
+		calls++
+		return []MembershipCount{
+			{Club: "Clube Capy", PlanType: "premium", Channel: "store", Count: 3},
+			{Club: "Clube Belga", PlanType: "basic", Channel: "app", Count: 1},
+		}, nil
+	}
+
+	if err := RegisterActiveMembershipGauge(source, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	m := collect(t, reader, "capybelga.memberships.active")
+	if m.Unit != "" {
+		t.Errorf("unit = %q, want the annotation dropped", m.Unit)
+	}
+
+	gauge, ok := m.Data.(metricdata.Gauge[int64])
+	if !ok {
+		t.Fatalf("data = %T, want an int64 gauge", m.Data)
+	}
+
+	capy := attribute.NewSet(
+		attribute.String("club_name", "Clube Capy"),
+		attribute.String("plan_type", "premium"),
+		attribute.String("aquisition_channel", "store"),
+	)
+	belga := attribute.NewSet(
+		attribute.String("club_name", "Clube Belga"),
+		attribute.String("plan_type", "basic"),
+		attribute.String("aquisition_channel", "app"),
+	)
+	want := map[attribute.Distinct]int64{capy.Equivalent(): 3, belga.Equivalent(): 1}
+
+	if len(gauge.DataPoints) != len(want) {
+		t.Fatalf("got %d data points, want %d", len(gauge.DataPoints), len(want))
+	}
+	for _, dp := range gauge.DataPoints {
+		if v, ok := want[dp.Attributes.Equivalent()]; !ok || v != dp.Value {
+			t.Errorf("unexpected data point %v = %d", dp.Attributes.ToSlice(), dp.Value)
+		}
+	}
+
+	// Within the TTL the cached counts are reported again.
+	collect(t, reader, "capybelga.memberships.active")
+	if calls != 1 {
+		t.Errorf("source called %d times within the TTL, want 1", calls)
+	}
+}
+
+func TestActiveMembershipGaugeKeepsCountsOnFailure(t *testing.T) {
+	cache := &membershipCache{ttl: time.Minute}
+
+	counts := []MembershipCount{{Club: "Clube Capy", PlanType: "premium", Count: 3}}
+	cache.source = func(ctx context.Context) ([]MembershipCount, error) { return counts, nil }
+	cache.get(context.Background())
+
+	cache.fetchedAt = time.Now().Add(-2 * time.Minute)
+	cache.source = func(ctx context.Context) ([]MembershipCount, error) { return nil, errors.New("db down") }
+
+	got := cache.get(context.Background())
+	if len(got) != 1 || got[0].Count != 3 {
+		t.Errorf("get() = %v after a failed refresh, want the cached %v", got, counts)
+	}
+}
+
+func TestMetricViewAllowList(t *testing.T) {
+	reader := manualMeter(t)
+
+	counter, err := Meter.Int64Counter("capybelga.cancel.plan.count", metric.WithUnit("{membership}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlisted, err := Meter.Int64Counter("capybelga.test.unlisted")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String("club_name", "Clube Capy"),
+		attribute.String("email", "capy@email.com"),
+	)
+	counter.Add(context.Background(), 1, attrs)
+	unlisted.Add(context.Background(), 1, attrs)
+
+	sum := collect(t, reader, "capybelga.cancel.plan.count").Data.(metricdata.Sum[int64])
+	if got := sum.DataPoints[0].Attributes; got.HasValue("email") || !got.HasValue("club_name") {
+		t.Errorf("allow-listed attributes = %v, want club_name without email", got.ToSlice())
+	}
+
+	sum = collect(t, reader, "capybelga.test.unlisted").Data.(metricdata.Sum[int64])
+	if got := sum.DataPoints[0].Attributes; !got.HasValue("email") {
+		t.Errorf("unlisted attributes = %v, want them kept", got.ToSlice())
+	}
+}
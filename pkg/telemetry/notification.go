@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Outcomes of a notification delivery, reported by capybelga.notifications.
+const (
+	NotificationSent      = "sent"
+	NotificationRetried   = "retried"
+	NotificationFailed    = "failed"
+	NotificationDuplicate = "duplicate"
+)
+
+var (
+	notifications        metric.Int64Counter
+	notificationDuration metric.Float64Histogram
+)
+
+func notificationStart() error {
+	var err error
+
+	notifications, err = Meter.Int64Counter(
+		"capybelga.notifications",
+		metric.WithDescription("Count of notification deliveries by channel, event kind and outcome"),
+		metric.WithUnit("{notification}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	notificationDuration, err = Meter.Float64Histogram(
+		"capybelga.notification.delivery.duration",
+		metric.WithDescription("Time taken by a channel to deliver a notification"),
+		metric.WithUnit("s"),
+	)
+	return err
+}
+
+// RecordNotification counts a notification of kind reaching outcome on
+// channel. Duplicates, which were not sent again, record no duration.
+func RecordNotification(ctx context.Context, channel, kind, outcome string, took time.Duration) {
+	notifications.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("channel", channel),
+		attribute.String("kind", kind),
+		attribute.String("outcome", outcome),
+	))
+
+	if outcome == NotificationDuplicate {
+		return
+	}
+
+	notificationDuration.Record(ctx, took.Seconds(), metric.WithAttributes(
+		attribute.String("channel", channel),
+		attribute.String("outcome", outcome),
+	))
+}
@@ -0,0 +1,37 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Stages of the referral funnel, reported by capybelga.referrals.
+const (
+	ReferralReferred = "referred"
+	ReferralRejected = "rejected"
+	ReferralRewarded = "rewarded"
+)
+
+var referrals metric.Int64Counter
+
+func referralStart() error {
+	var err error
+
+	referrals, err = Meter.Int64Counter(
+		"capybelga.referrals",
+		metric.WithDescription("Count of referrals reaching each stage of the referral funnel"),
+		metric.WithUnit("{referral}"),
+	)
+	return err
+}
+
+// RecordReferral counts a referral reaching stage. Rejected referrals carry
+// the reason they were rejected for.
+func RecordReferral(ctx context.Context, stage, reason string) {
+	referrals.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("stage", stage),
+		attribute.String("reason", reason),
+	))
+}
@@ -0,0 +1,221 @@
+package telemetry
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RouteDecision overrides the sampling decision of the server spans of a
+// route.
+type RouteDecision string
+
+const (
+	RouteAlways RouteDecision = "always"
+	RouteNever  RouteDecision = "never"
+)
+
+// DefaultRouteOverrides keeps health checks out of the traces.
+const DefaultRouteOverrides = "/healthz=never"
+
+// SamplerConfig mirrors the OTEL_TRACES_SAMPLER family of env vars.
+type SamplerConfig struct {
+	// Name is one of always_on, always_off, traceidratio,
+	// parentbased_always_on, parentbased_always_off or
+	// parentbased_traceidratio.
+	Name  string
+	Ratio float64
+	// Routes maps http.route values to a decision that wins over Name.
+	Routes map[string]RouteDecision
+	// SampleErrors exports spans that end with an error status even when
+	// the trace was not sampled. To know how a span ends, the sampler
+	// records every span it would have dropped, so a low ratio then saves
+	// export but not the cost of recording attributes and events.
+	SampleErrors bool
+}
+
+// SamplerConfigFromEnv reads OTEL_TRACES_SAMPLER, OTEL_TRACES_SAMPLER_ARG,
+// OTEL_TRACES_SAMPLER_ROUTES ("route=always|never" pairs separated by commas)
+// and OTEL_TRACES_SAMPLE_ERRORS.
+func SamplerConfigFromEnv() (SamplerConfig, error) {
+	cfg := SamplerConfig{
+		Name:         os.Getenv("OTEL_TRACES_SAMPLER"),
+		Ratio:        1,
+		SampleErrors: true,
+	}
+
+	if cfg.Name == "" {
+		cfg.Name = "parentbased_always_on"
+	}
+
+	if arg := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return cfg, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q: must be a ratio between 0 and 1", arg)
+		}
+		cfg.Ratio = ratio
+	}
+
+	routes, ok := os.LookupEnv("OTEL_TRACES_SAMPLER_ROUTES")
+	if !ok {
+		routes = DefaultRouteOverrides
+	}
+
+	var err error
+	if cfg.Routes, err = parseRouteOverrides(routes); err != nil {
+		return cfg, err
+	}
+
+	if v := os.Getenv("OTEL_TRACES_SAMPLE_ERRORS"); v != "" {
+		if cfg.SampleErrors, err = strconv.ParseBool(v); err != nil {
+			return cfg, fmt.Errorf("invalid OTEL_TRACES_SAMPLE_ERRORS %q: %w", v, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseRouteOverrides(s string) (map[string]RouteDecision, error) {
+	routes := make(map[string]RouteDecision)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		route, decision, ok := strings.Cut(pair, "=")
+		d := RouteDecision(strings.TrimSpace(decision))
+		if !ok || (d != RouteAlways && d != RouteNever) {
+			return nil, fmt.Errorf("invalid route sampling override %q", pair)
+		}
+
+		routes[strings.TrimSpace(route)] = d
+	}
+
+	return routes, nil
+}
+
+// Sampler is the head sampler of the service. The ratio of the root
+// decision can be changed at runtime with SetRatio; always_on and always_off
+// are treated as the ratios 1 and 0.
+type Sampler struct {
+	parentBased  bool
+	routes       map[string]RouteDecision
+	sampleErrors bool
+
+	ratio atomic.Uint64
+	root  atomic.Pointer[oteltrace.Sampler]
+}
+
+func NewSampler(cfg SamplerConfig) (*Sampler, error) {
+	s := &Sampler{routes: cfg.Routes, sampleErrors: cfg.SampleErrors}
+
+	name := cfg.Name
+	if rest, ok := strings.CutPrefix(name, "parentbased_"); ok {
+		s.parentBased = true
+		name = rest
+	}
+
+	switch name {
+	case "always_on":
+		s.SetRatio(1)
+	case "always_off":
+		s.SetRatio(0)
+	case "traceidratio":
+		s.SetRatio(cfg.Ratio)
+	default:
+		return nil, fmt.Errorf("unknown traces sampler %q", cfg.Name)
+	}
+
+	return s, nil
+}
+
+// SetRatio changes the fraction of new traces that are sampled.
+func (s *Sampler) SetRatio(ratio float64) {
+	root := oteltrace.TraceIDRatioBased(ratio)
+	if s.parentBased {
+		root = oteltrace.ParentBased(root)
+	}
+
+	s.root.Store(&root)
+	s.ratio.Store(math.Float64bits(ratio))
+
+	slog.Info("Trace sampling ratio set", "ratio", ratio, "parent_based", s.parentBased)
+}
+
+func (s *Sampler) Ratio() float64 {
+	return math.Float64frombits(s.ratio.Load())
+}
+
+func (s *Sampler) ShouldSample(p oteltrace.SamplingParameters) oteltrace.SamplingResult {
+	switch s.routeDecision(p) {
+	case RouteAlways:
+		return oteltrace.SamplingResult{
+			Decision:   oteltrace.RecordAndSample,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	case RouteNever:
+		// Health checks stay out of the traces even when they fail.
+		return oteltrace.SamplingResult{Decision: oteltrace.Drop}
+	}
+
+	result := (*s.root.Load()).ShouldSample(p)
+
+	// Spans of unsampled traces are still recorded, so errorSampling can
+	// export the ones that fail.
+	if s.sampleErrors && result.Decision == oteltrace.Drop {
+		result.Decision = oteltrace.RecordOnly
+	}
+
+	return result
+}
+
+func (s *Sampler) routeDecision(p oteltrace.SamplingParameters) RouteDecision {
+	for _, attr := range p.Attributes {
+		if attr.Key == "http.route" {
+			return s.routes[attr.Value.AsString()]
+		}
+	}
+	return ""
+}
+
+func (s *Sampler) Description() string {
+	return fmt.Sprintf("CapyBelgaSampler{ratio:%g,parentBased:%t,sampleErrors:%t}", s.Ratio(), s.parentBased, s.sampleErrors)
+}
+
+// errorSampling forwards to the wrapped processor the sampled spans, plus the spans of unsampled
+// traces that ended with an error status.
+type errorSampling struct {
+	oteltrace.SpanProcessor
+}
+
+func (p errorSampling) OnEnd(s oteltrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+
+	if s.Status().Code == codes.Error {
+		p.SpanProcessor.OnEnd(sampledSpan{s})
+	}
+}
+
+// sampledSpan marks a recorded span as sampled so exporting processors
+// accept it.
+type sampledSpan struct {
+	oteltrace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
@@ -0,0 +1,128 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSamplerDecision(t *testing.T) {
+	routes := map[string]RouteDecision{
+		"/healthz":          RouteNever,
+		"/user/cancel/club": RouteAlways,
+	}
+
+	tests := []struct {
+		name         string
+		sampler      string
+		sampleErrors bool
+		route        string
+		want         oteltrace.SamplingDecision
+	}{
+		{"sampled", "always_on", true, "/user/signup/club", oteltrace.RecordAndSample},
+		{"unsampled recorded for errors", "always_off", true, "/user/signup/club", oteltrace.RecordOnly},
+		{"unsampled dropped", "always_off", false, "/user/signup/club", oteltrace.Drop},
+		{"route always wins over the ratio", "always_off", false, "/user/cancel/club", oteltrace.RecordAndSample},
+		{"route never wins over the ratio", "always_on", true, "/healthz", oteltrace.Drop},
+		{"no route", "parentbased_always_off", true, "", oteltrace.RecordOnly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSampler(SamplerConfig{Name: tt.sampler, Routes: routes, SampleErrors: tt.sampleErrors})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := oteltrace.SamplingParameters{
+				ParentContext: context.Background(),
+				TraceID:       trace.TraceID{1},
+				Name:          "GET " + tt.route,
+				Kind:          trace.SpanKindServer,
+			}
+			if tt.route != "" {
+				p.Attributes = []attribute.KeyValue{attribute.String("http.route", tt.route)}
+			}
+
+			if got := s.ShouldSample(p).Decision; got != tt.want {
+				t.Errorf("ShouldSample() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamplerSetRatio(t *testing.T) {
+	s, err := NewSampler(SamplerConfig{Name: "traceidratio", Ratio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := oteltrace.SamplingParameters{ParentContext: context.Background(), TraceID: trace.TraceID{1}}
+
+	if got := s.ShouldSample(p).Decision; got != oteltrace.RecordAndSample {
+		t.Fatalf("ShouldSample() at ratio 1 = %v", got)
+	}
+
+	s.SetRatio(0)
+
+	if got := s.ShouldSample(p).Decision; got != oteltrace.Drop {
+		t.Errorf("ShouldSample() at ratio 0 = %v", got)
+	}
+	if s.Ratio() != 0 {
+		t.Errorf("Ratio() = %g, want 0", s.Ratio())
+	}
+}
+
+func TestErrorSamplingExportsFailedSpans(t *testing.T) {
+	s, err := NewSampler(SamplerConfig{Name: "always_off", SampleErrors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := oteltrace.NewTracerProvider(
+		oteltrace.WithSampler(s),
+		oteltrace.WithSpanProcessor(errorSampling{oteltrace.NewSimpleSpanProcessor(exp)}),
+	)
+	defer tp.Shutdown(context.Background())
+
+	tracer := tp.Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "ok")
+	ok.End()
+
+	_, failed := tracer.Start(context.Background(), "failed")
+	failed.RecordError(errors.New("boom"))
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "failed" {
+		t.Fatalf("exported %d spans, want only the failed one", len(spans))
+	}
+	if !spans[0].SpanContext.IsSampled() {
+		t.Errorf("exported span is not marked sampled")
+	}
+}
+
+func TestParseRouteOverrides(t *testing.T) {
+	routes, err := parseRouteOverrides(" /healthz=never, /user/cancel/club = always ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes["/healthz"] != RouteNever || routes["/user/cancel/club"] != RouteAlways || len(routes) != 2 {
+		t.Errorf("parseRouteOverrides() = %v", routes)
+	}
+
+	for _, s := range []string{"/healthz", "/healthz=sometimes"} {
+		if _, err := parseRouteOverrides(s); err == nil {
+			t.Errorf("parseRouteOverrides(%q) succeeded", s)
+		}
+	}
+}
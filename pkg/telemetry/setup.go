@@ -0,0 +1,175 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	otelmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	oteltrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type Config struct {
+	TracerName string
+	MeterName  string
+
+	// TracesExporters and MetricsExporters list the exporters of each
+	// signal: otlp, console, none and, for metrics, prometheus.
+	TracesExporters  []string
+	MetricsExporters []string
+
+	// TracesProtocol and MetricsProtocol select the OTLP transport, grpc or
+	// http/protobuf.
+	TracesProtocol  string
+	MetricsProtocol string
+}
+
+// ConfigFromEnv reads OTEL_TRACES_EXPORTER, OTEL_METRICS_EXPORTER (comma
+// separated lists, otlp by default) and OTEL_EXPORTER_OTLP_PROTOCOL with its
+// per signal variants (grpc by default).
+func ConfigFromEnv(tracerName, meterName string) Config {
+	protocol := envOr("OTEL_EXPORTER_OTLP_PROTOCOL", ProtocolGRPC)
+
+	return Config{
+		TracerName:       tracerName,
+		MeterName:        meterName,
+		TracesExporters:  splitList(envOr("OTEL_TRACES_EXPORTER", ExporterOTLP)),
+		MetricsExporters: splitList(envOr("OTEL_METRICS_EXPORTER", ExporterOTLP)),
+		TracesProtocol:   envOr("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", protocol),
+		MetricsProtocol:  envOr("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", protocol),
+	}
+}
+
+// Setup installs the tracer and meter providers and creates the instruments
+// of this package. An exporter that cannot be created is skipped with a
+// warning, so the service starts even when its telemetry backend does not;
+// only a failure to create the instruments is returned. The returned function
+// flushes and stops the providers.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	var shutdowns []func(context.Context) error
+
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		for _, fn := range shutdowns {
+			errs = append(errs, fn(ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	r, err := Resource(ctx)
+	if err != nil {
+		slog.Warn("Incomplete telemetry resource, using the attributes detected so far", "error", err)
+	}
+
+	otel.SetTextMapPropagator(getOTLPPropagators())
+
+	tp := newTraceProvider(ctx, cfg, r)
+	shutdowns = append(shutdowns, tp.Shutdown)
+	otel.SetTracerProvider(tp)
+	Tracer = tp.Tracer(cfg.TracerName)
+
+	mp := newMeterProvider(ctx, cfg, r)
+	shutdowns = append(shutdowns, mp.Shutdown)
+	otel.SetMeterProvider(mp)
+	Meter = mp.Meter(cfg.MeterName)
+
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		slog.Warn("Go runtime metrics disabled", "error", err)
+	}
+
+	if err := MetricsStart(); err != nil {
+		return shutdown, err
+	}
+
+	return shutdown, nil
+}
+
+func newTraceProvider(ctx context.Context, cfg Config, r *resource.Resource) *oteltrace.TracerProvider {
+	samplerCfg, err := SamplerConfigFromEnv()
+	if err == nil {
+		TraceSampler, err = NewSampler(samplerCfg)
+	}
+	if err != nil {
+		slog.Warn("Invalid trace sampler configuration, sampling every trace", "error", err)
+		routes, _ := parseRouteOverrides(DefaultRouteOverrides)
+		TraceSampler, _ = NewSampler(SamplerConfig{
+			Name:         "parentbased_always_on",
+			Routes:       routes,
+			SampleErrors: true,
+		})
+	}
+
+	opts := []oteltrace.TracerProviderOption{
+		oteltrace.WithResource(r),
+		oteltrace.WithSampler(TraceSampler),
+	}
+
+	for _, name := range cfg.TracesExporters {
+		if name == ExporterNone {
+			continue
+		}
+
+		exp, err := newTraceExporter(ctx, name, cfg.TracesProtocol)
+		if err != nil {
+			slog.Warn("Traces exporter disabled", "exporter", name, "error", err)
+			continue
+		}
+
+		slog.Info("Exporting traces", "exporter", name)
+		opts = append(opts, oteltrace.WithSpanProcessor(errorSampling{oteltrace.NewBatchSpanProcessor(exp)}))
+	}
+
+	return oteltrace.NewTracerProvider(opts...)
+}
+
+func newMeterProvider(ctx context.Context, cfg Config, r *resource.Resource) *otelmetric.MeterProvider {
+	enableCardinalityLimit()
+
+	opts := []otelmetric.Option{
+		otelmetric.WithResource(r),
+		otelmetric.WithView(metricViews()...),
+	}
+
+	for _, name := range cfg.MetricsExporters {
+		if name == ExporterNone {
+			continue
+		}
+
+		reader, handler, err := newMetricReader(ctx, name, cfg.MetricsProtocol)
+		if err != nil {
+			slog.Warn("Metrics exporter disabled", "exporter", name, "error", err)
+			continue
+		}
+
+		if handler != nil {
+			MetricsHandler = handler
+		}
+
+		slog.Info("Exporting metrics", "exporter", name)
+		opts = append(opts, otelmetric.WithReader(reader))
+	}
+
+	return otelmetric.NewMeterProvider(opts...)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
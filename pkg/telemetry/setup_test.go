@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetupSkipsFailingExporters(t *testing.T) {
+	tracer, meter, handler := Tracer, Meter, MetricsHandler
+	t.Cleanup(func() { Tracer, Meter, MetricsHandler = tracer, meter, handler })
+	MetricsHandler = nil
+
+	shutdown, err := Setup(context.Background(), Config{
+		TracerName:       "test",
+		MeterName:        "test",
+		TracesExporters:  []string{"zipkin", ExporterOTLP},
+		MetricsExporters: []string{ExporterOTLP, ExporterPrometheus},
+		TracesProtocol:   "carrier-pigeon",
+		MetricsProtocol:  "carrier-pigeon",
+	})
+	if err != nil {
+		t.Fatalf("Setup() error = %v, want the failing exporters skipped", err)
+	}
+	t.Cleanup(func() { shutdown(context.Background()) })
+
+	if MetricsHandler == nil {
+		t.Error("MetricsHandler is nil, want the prometheus exporter kept")
+	}
+
+	_, span := Tracer.Start(context.Background(), "test")
+	defer span.End()
+	if !span.SpanContext().IsValid() {
+		t.Error("Tracer does not start spans without an exporter")
+	}
+
+	if NewPlanCounter == nil || HTTPServerDuration == nil {
+		t.Error("Setup() did not create the instruments")
+	}
+}
+
+func TestNewExporterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+	}{
+		{"zipkin", ProtocolGRPC},
+		{ExporterOTLP, "carrier-pigeon"},
+	}
+
+	for _, tt := range tests {
+		if _, err := newTraceExporter(context.Background(), tt.name, tt.protocol); err == nil {
+			t.Errorf("newTraceExporter(%q, %q) error = nil, want unsupported", tt.name, tt.protocol)
+		}
+		if _, _, err := newMetricReader(context.Background(), tt.name, tt.protocol); err == nil {
+			t.Errorf("newMetricReader(%q, %q) error = nil, want unsupported", tt.name, tt.protocol)
+		}
+	}
+}
@@ -2,76 +2,53 @@ package telemetry
 
 import (
 	"context"
-	"log/slog"
-	"os"
+	"net/http"
 
-	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/contrib/propagators/jaeger"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
-	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
-	otelmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
-	oteltrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	Tracer         trace.Tracer
-	Meter          metric.Meter
-	RequestCounter metric.Int64Counter
-	PlanGauge      metric.Int64Gauge
-	NewPlanCounter metric.Int64Counter
+	Tracer            trace.Tracer
+	TraceSampler      *Sampler
+	Meter             metric.Meter
+	NewPlanCounter    metric.Int64Counter
+	CancelPlanCounter metric.Int64Counter
+
+	MessagesConsumedCounter metric.Int64Counter
+	MessageProcessDuration  metric.Float64Histogram
+	MessageLag              metric.Float64Histogram
+
+	HTTPServerDuration         metric.Float64Histogram
+	HTTPServerActiveRequests   metric.Int64UpDownCounter
+	HTTPServerRequestBodySize  metric.Int64Histogram
+	HTTPServerResponseBodySize metric.Int64Histogram
+
+	// MetricsHandler serves the Prometheus scrape endpoint. It is nil unless
+	// the prometheus metrics exporter is enabled.
+	MetricsHandler http.Handler
 )
 
-func newConsoleTraceExporter() (*stdouttrace.Exporter, error) {
-	return stdouttrace.New()
-}
-
-func newConsoleMetricExporter() (otelmetric.Exporter, error) {
-	return stdoutmetric.New()
-}
-
-func newOTLPGRPCTraceExporter(ctx context.Context) (oteltrace.SpanExporter, error) {
-	return otlptracegrpc.New(ctx)
-}
-
-func newOTLPGRPCMetricExporter(ctx context.Context) (*otlpmetricgrpc.Exporter, error) {
-	return otlpmetricgrpc.New(ctx)
-}
-
-func newTraceProvider(ctx context.Context, exp oteltrace.SpanExporter) *oteltrace.TracerProvider {
-	r := getOTLPResource(ctx)
-
-	return oteltrace.NewTracerProvider(
-		oteltrace.WithResource(r),
-		oteltrace.WithSpanProcessor(oteltrace.NewBatchSpanProcessor(exp)),
-		oteltrace.WithSampler(oteltrace.AlwaysSample()),
-	)
-}
+// messageLagBuckets span from sub-second delivery to a backlog of an hour.
+var messageLagBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 1800, 3600}
 
-func newMeterProvider(ctx context.Context, exp otelmetric.Exporter) *otelmetric.MeterProvider {
-
-	r := getOTLPResource(ctx)
-
-	return otelmetric.NewMeterProvider(
-		otelmetric.WithResource(r),
-		otelmetric.WithReader(otelmetric.NewPeriodicReader(exp)),
-	)
-
-}
+// httpDurationBuckets are the explicit bucket boundaries, in seconds,
+// recommended by the HTTP semantic conventions.
+var httpDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
 
 func GenerateCommonAttributes(attrs ...attribute.KeyValue) []attribute.KeyValue {
 	return attrs
 }
 
-func getOTLPResource(ctx context.Context) *resource.Resource {
+// Resource describes this process to every OpenTelemetry signal. When a
+// detector fails the error is returned with the attributes detected so far,
+// so the resource is never nil.
+func Resource(ctx context.Context) (*resource.Resource, error) {
 	r, err := resource.New(
 		ctx,
 		resource.WithFromEnv(),
@@ -84,12 +61,11 @@ func getOTLPResource(ctx context.Context) *resource.Resource {
 		),
 	)
 
-	if err != nil {
-		panic(err)
+	if r == nil {
+		r = resource.Default()
 	}
 
-	return r
-
+	return r, err
 }
 
 func getOTLPPropagators() propagation.TextMapPropagator {
@@ -98,96 +74,116 @@ func getOTLPPropagators() propagation.TextMapPropagator {
 		jaeger.Jaeger{})
 }
 
-func TraceInit(ctx context.Context, name string) oteltrace.SpanExporter {
-	var exp oteltrace.SpanExporter
+func MetricsStart() error {
+
 	var err error
 
-	if os.Getenv("OTEL_TRACES_EXPORTER") == "console" {
-		slog.Info("Using console exporter for traces")
-		exp, err = newConsoleTraceExporter()
-	} else {
-		slog.Info("Using OTLP exporter for traces")
-		exp, err = newOTLPGRPCTraceExporter(ctx)
+	NewPlanCounter, err = Meter.Int64Counter(
+		"capybelga.new.plan.count",
+		metric.WithDescription("Count of new Discount Club Plan Contractions"),
+		metric.WithUnit("{membership}"),
+	)
+	if err != nil {
+		return err
 	}
 
+	CancelPlanCounter, err = Meter.Int64Counter(
+		"capybelga.cancel.plan.count",
+		metric.WithDescription("Count of cancelled Discount Club Plan Contractions"),
+		metric.WithUnit("{membership}"),
+	)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	tp := newTraceProvider(ctx, exp)
-
-	otel.SetTextMapPropagator(getOTLPPropagators())
-
-	Tracer = tp.Tracer(name)
-
-	return exp
-}
-
-func MetricInit(ctx context.Context, name string) (*otelmetric.MeterProvider, otelmetric.Exporter) {
-
-	var exp otelmetric.Exporter
-	var err error
-
-	if os.Getenv("OTEL_METRICS_EXPORTER") == "console" {
-
-		slog.Info("Using console exporter for metrics")
-		exp, err = newConsoleMetricExporter()
-
-	} else {
-		slog.Info("Using OTLP exporter for metrics")
-		exp, err = newOTLPGRPCMetricExporter(ctx)
+	HTTPServerDuration, err = Meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(httpDurationBuckets...),
+	)
+	if err != nil {
+		return err
 	}
 
+	HTTPServerActiveRequests, err = Meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests"),
+		metric.WithUnit("{request}"),
+	)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	mp := newMeterProvider(ctx, exp)
-
-	otel.SetMeterProvider(mp)
+	HTTPServerRequestBodySize, err = Meter.Int64Histogram(
+		"http.server.request.body.size",
+		metric.WithDescription("Size of HTTP server request bodies"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
 
-	otel.SetTextMapPropagator(getOTLPPropagators())
+	HTTPServerResponseBodySize, err = Meter.Int64Histogram(
+		"http.server.response.body.size",
+		metric.WithDescription("Size of HTTP server response bodies"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
 
-	Meter = mp.Meter(name)
+	MessagesConsumedCounter, err = Meter.Int64Counter(
+		"capybelga.messages.consumed",
+		metric.WithDescription("Count of consumed queue messages by outcome"),
+		metric.WithUnit("{message}"),
+	)
 
-	return mp, exp
-}
+	if err != nil {
+		return err
+	}
 
-func RuntimeStart(m metric.MeterProvider) {
-	if err := runtime.Start(
-		runtime.WithMeterProvider(m),
-	); err != nil {
-		panic(err)
+	MessageProcessDuration, err = Meter.Float64Histogram(
+		"capybelga.messages.process.duration",
+		metric.WithDescription("Duration of queue message handling, including acknowledgement"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(httpDurationBuckets...),
+	)
+	if err != nil {
+		return err
 	}
 
-}
+	MessageLag, err = Meter.Float64Histogram(
+		"capybelga.messages.lag",
+		metric.WithDescription("Time from message publication to the start of its processing"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(messageLagBuckets...),
+	)
+	if err != nil {
+		return err
+	}
 
-func MetricsStart() error {
+	if err := kpiStart(); err != nil {
+		return err
+	}
 
-	var err error
+	if err := billingStart(); err != nil {
+		return err
+	}
 
-	PlanGauge, err = Meter.Int64Gauge(
-		"capybelga.active.clubs",
-		metric.WithDescription("Number of active Discount Club Plan Contractions"),
-		metric.WithUnit("1"),
-	)
+	if err := couponStart(); err != nil {
+		return err
+	}
 
-	NewPlanCounter, err = Meter.Int64Counter(
-		"capybelga.new.plan.count",
-		metric.WithDescription("Count of new Discount Club Plan Contractions"),
-		metric.WithUnit("1"),
-	)
-	if err != nil {
+	if err := benefitStart(); err != nil {
 		return err
 	}
 
-	RequestCounter, err = Meter.Int64Counter(
-		"capybelga.requests.count",
-		metric.WithDescription("Count of HTTP requests"),
-		metric.WithUnit("1"),
-	)
+	if err := referralStart(); err != nil {
+		return err
+	}
 
-	if err != nil {
+	if err := notificationStart(); err != nil {
 		return err
 	}
 